@@ -0,0 +1,399 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Account types.
+const (
+	accountChecking   = "checking"
+	accountSavings    = "savings"
+	accountCreditCard = "credit_card"
+	accountCash       = "cash"
+)
+
+// Account is where money is kept: a bank account, a card or a wallet. Its
+// balance is the opening balance plus the incomes and less the expenses
+// booked to it. A credit card's balance is negative while money is owed.
+type Account struct {
+	ID             uint      `json:"id" gorm:"primaryKey"`
+	UserID         uint      `json:"user_id" gorm:"not null;index"`
+	Name           string    `json:"name" gorm:"not null"`
+	Type           string    `json:"type" gorm:"not null"`
+	Currency       string    `json:"currency" gorm:"size:3;not null;default:USD"`
+	OpeningBalance Money     `json:"opening_balance"`
+	CreditLimit    Money     `json:"credit_limit"`  // credit cards only
+	StatementDay   int       `json:"statement_day"` // credit cards only, 1 to 28
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+	Balance        *Money    `json:"balance,omitempty" gorm:"-"`
+}
+
+func (a Account) OwnerID() uint { return a.UserID }
+
+var (
+	errUnknownAccount  = errors.New("account_id must name one of your accounts")
+	errAccountCurrency = errors.New("currency must match the account's currency")
+)
+
+func (a Account) validate() error {
+	if strings.TrimSpace(a.Name) == "" {
+		return errors.New("name is required")
+	}
+	switch a.Type {
+	case accountChecking, accountSavings, accountCash:
+		if a.CreditLimit != 0 || a.StatementDay != 0 {
+			return errors.New("only credit cards have a credit_limit or statement_day")
+		}
+	case accountCreditCard:
+		if a.CreditLimit < 0 {
+			return errors.New("credit_limit must not be negative")
+		}
+		if a.StatementDay < 1 || a.StatementDay > 28 {
+			return errors.New("statement_day must be between 1 and 28")
+		}
+	default:
+		return errors.New("type must be checking, savings, credit_card or cash")
+	}
+	if !validCurrency(a.Currency) {
+		return errInvalidCurrency
+	}
+	if !a.OpeningBalance.fits(a.Currency) {
+		return fractionError("opening_balance", a.Currency)
+	}
+	if !a.CreditLimit.fits(a.Currency) {
+		return fractionError("credit_limit", a.Currency)
+	}
+	return nil
+}
+
+// checkAccount verifies that a transaction in currency may be booked to
+// the user's account id, which may be nil for none.
+func checkAccount(userID uint, id *uint, currency string) error {
+	if id == nil {
+		return nil
+	}
+	var account Account
+	if err := db.Where("id = ? AND user_id = ?", *id, userID).First(&account).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errUnknownAccount
+		}
+		return err
+	}
+	if account.Currency != currency {
+		return errAccountCurrency
+	}
+	return nil
+}
+
+// accountError answers a failed account check.
+func accountError(c *gin.Context, err error) {
+	if errors.Is(err, errUnknownAccount) || errors.Is(err, errAccountCurrency) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to look up account"})
+}
+
+// sumAmount returns the total of the given amount column of query.
+func sumAmount(query *gorm.DB, column string) (Money, error) {
+	var total Money
+	err := query.Select("COALESCE(SUM(" + column + "), 0)").Row().Scan(&total)
+	return total, err
+}
+
+// accountFlow is a kind of transaction that moves money in or out of an
+// account: amount and category are the columns to read, and sign says
+// which way the money goes.
+type accountFlow struct {
+	kind     string
+	query    *gorm.DB
+	amount   string
+	category string
+	sign     Money
+}
+
+// accountFlows returns the flows of account id. Transfers count on both
+// sides, each in the account's own currency.
+func accountFlows(id uint) []accountFlow {
+	return []accountFlow{
+		{kindIncome, db.Model(&Income{}).Where("account_id = ?", id), "amount", "category", 1},
+		{kindExpense, db.Model(&Expense{}).Where("account_id = ?", id), "amount", "category", -1},
+		{kindTransfer, db.Model(&Transfer{}).Where("to_account_id = ?", id), "to_amount", "''", 1},
+		{kindTransfer, db.Model(&Transfer{}).Where("from_account_id = ?", id), "amount", "''", -1},
+	}
+}
+
+// balance returns the account's balance at the end of day, or of all time
+// if day is zero.
+func (a Account) balance(day Date) (Money, error) {
+	total := a.OpeningBalance
+	for _, flow := range accountFlows(a.ID) {
+		sum, err := sumAmount(inDateRange(flow.query, Date{}, day), flow.amount)
+		if err != nil {
+			return 0, err
+		}
+		total += flow.sign * sum
+	}
+	return total, nil
+}
+
+// lastStatement returns the most recent statement closing day on or before
+// day.
+func (a Account) lastStatement(day Date) Date {
+	closing := NewDate(day.Year(), day.Month(), a.StatementDay)
+	if closing.After(day) {
+		closing = closing.AddMonths(-1)
+	}
+	return closing
+}
+
+// ledgerEntry is one line of an account's ledger. Amount is signed: money in
+// is positive and money out negative.
+type ledgerEntry struct {
+	Date        Date   `json:"date"`
+	Kind        string `json:"kind"`
+	ID          uint   `json:"id"`
+	Description string `json:"description"`
+	Category    string `json:"category"`
+	Amount      Money  `json:"amount"`
+	Balance     Money  `json:"balance"`
+	createdAt   time.Time
+}
+
+// ledger returns the account's transactions dated within [from, to] in
+// date order, each with the balance after it.
+func (a Account) ledger(from, to Date) (Money, []ledgerEntry, error) {
+	opening := a.OpeningBalance
+	if !from.IsZero() {
+		var err error
+		if opening, err = a.balance(from.AddDays(-1)); err != nil {
+			return 0, nil, err
+		}
+	}
+
+	entries := []ledgerEntry{}
+	for _, flow := range accountFlows(a.ID) {
+		var rows []struct {
+			ID          uint
+			Date        Date
+			Description string
+			Category    string
+			Amount      Money
+			CreatedAt   time.Time
+		}
+		err := inDateRange(flow.query, from, to).
+			Select("id, date, description, " + flow.category + " AS category, " + flow.amount + " AS amount, created_at").
+			Scan(&rows).Error
+		if err != nil {
+			return 0, nil, err
+		}
+		for _, row := range rows {
+			entries = append(entries, ledgerEntry{Date: row.Date, Kind: flow.kind, ID: row.ID, Description: row.Description,
+				Category: row.Category, Amount: flow.sign * row.Amount, createdAt: row.CreatedAt})
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		x, y := entries[i], entries[j]
+		if x.Date != y.Date {
+			return x.Date.Before(y.Date)
+		}
+		if !x.createdAt.Equal(y.createdAt) {
+			return x.createdAt.Before(y.createdAt)
+		}
+		if x.Kind != y.Kind {
+			return x.Kind < y.Kind
+		}
+		return x.ID < y.ID
+	})
+
+	running := opening
+	for i := range entries {
+		running += entries[i].Amount
+		entries[i].Balance = running
+	}
+	return opening, entries, nil
+}
+
+// GetAccounts lists the caller's accounts with their current balances.
+func GetAccounts(c *gin.Context) {
+	userID := currentUserID(c)
+	accounts := []Account{}
+	if err := db.Where("user_id = ?", userID).Order("name, id").Find(&accounts).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve accounts"})
+		return
+	}
+	day := today(userID)
+	for i := range accounts {
+		balance, err := accounts[i].balance(day)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute balances"})
+			return
+		}
+		accounts[i].Balance = &balance
+	}
+	c.JSON(http.StatusOK, accounts)
+}
+
+func AddAccount(c *gin.Context) {
+	var account Account
+	if err := c.ShouldBindJSON(&account); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	account.ID = 0
+	account.UserID = currentUserID(c)
+	account.CreatedAt = time.Time{}
+	account.Name = strings.TrimSpace(account.Name)
+	account.Currency = currencyFor(account.UserID, account.Currency)
+	if err := account.validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := db.Create(&account).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save account"})
+		return
+	}
+	c.JSON(http.StatusOK, account)
+}
+
+// UpdateAccount replaces or patches an account. Its currency cannot change
+// once transactions are booked to it.
+func UpdateAccount(c *gin.Context) {
+	var account Account
+	if !findOwned(c, &account, "Account not found") {
+		return
+	}
+
+	var updated Account
+	if err := bindUpdate(c, account, &updated); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	updated.ID, updated.UserID, updated.CreatedAt = account.ID, account.UserID, account.CreatedAt
+	updated.Name = strings.TrimSpace(updated.Name)
+	updated.Currency = currencyFor(updated.UserID, updated.Currency)
+	updated.Balance = nil
+	if err := updated.validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if updated.Currency != account.Currency && accountInUse(account.ID) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "currency cannot change once transactions are booked to the account"})
+		return
+	}
+	if err := db.Save(&updated).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update account"})
+		return
+	}
+	c.JSON(http.StatusOK, updated)
+}
+
+// accountInUse reports whether anything is booked to account id.
+func accountInUse(id uint) bool {
+	queries := []*gorm.DB{
+		db.Model(&Expense{}).Where("account_id = ?", id),
+		db.Model(&Income{}).Where("account_id = ?", id),
+		db.Model(&RecurringRule{}).Where("account_id = ?", id),
+		db.Model(&TransactionRule{}).Where("account_id = ?", id),
+		db.Model(&Transfer{}).Where("from_account_id = ? OR to_account_id = ?", id, id),
+	}
+	for _, query := range queries {
+		var n int64
+		query.Count(&n)
+		if n > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func DeleteAccount(c *gin.Context) {
+	var account Account
+	if !findOwned(c, &account, "Account not found") {
+		return
+	}
+	if accountInUse(account.ID) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Account is still in use"})
+		return
+	}
+	if err := db.Delete(&account).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete account"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Account deleted"})
+}
+
+// GetAccountBalance reports an account's balance at the end of the day
+// given by the date parameter, today by default. For credit cards it adds
+// the balance on the last statement and the credit still available.
+func GetAccountBalance(c *gin.Context) {
+	var account Account
+	if !findOwned(c, &account, "Account not found") {
+		return
+	}
+	day := today(account.UserID)
+	if s := c.Query("date"); s != "" {
+		var err error
+		if day, err = ParseDate(s); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	balance, err := account.balance(day)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute balance"})
+		return
+	}
+	resp := gin.H{"account_id": account.ID, "currency": account.Currency, "date": day, "balance": balance}
+	if account.Type == accountCreditCard {
+		closing := account.lastStatement(day)
+		statement, err := account.balance(closing)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute balance"})
+			return
+		}
+		resp["statement_date"] = closing
+		resp["statement_balance"] = statement
+		resp["credit_limit"] = account.CreditLimit
+		resp["available_credit"] = account.CreditLimit + balance
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// GetAccountLedger lists an account's transactions between the optional
+// from and to dates with a running balance.
+func GetAccountLedger(c *gin.Context) {
+	var account Account
+	if !findOwned(c, &account, "Account not found") {
+		return
+	}
+	from, to, ok := dateRange(c)
+	if !ok {
+		return
+	}
+	opening, entries, err := account.ledger(from, to)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load ledger"})
+		return
+	}
+	closing := opening
+	if len(entries) > 0 {
+		closing = entries[len(entries)-1].Balance
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"account_id":      account.ID,
+		"currency":        account.Currency,
+		"opening_balance": opening,
+		"closing_balance": closing,
+		"entries":         entries,
+	})
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAccountBalancesAndLedger(t *testing.T) {
+	setupTestDB()
+	r := setupRouter()
+	db.Create(&User{FullName: "A", Username: "a", Email: "a@x.com", Password: "p", BaseCurrency: "USD"})
+
+	for _, body := range []string{
+		`{"type":"checking"}`,
+		`{"name":"Main","type":"brokerage"}`,
+		`{"name":"Main","type":"checking","credit_limit":100}`,
+		`{"name":"Visa","type":"credit_card","credit_limit":1000,"statement_day":31}`,
+	} {
+		assert.Equal(t, http.StatusBadRequest, sendJSON(r, "POST", "/accounts", body, 1).Code, body)
+	}
+	assert.Equal(t, http.StatusOK, sendJSON(r, "POST", "/accounts", `{"name":"Main","type":"checking","opening_balance":"1000.00"}`, 1).Code)
+	assert.Equal(t, http.StatusOK, sendJSON(r, "POST", "/accounts", `{"name":"Visa","type":"credit_card","credit_limit":"2000.00","statement_day":15}`, 1).Code)
+	assert.Equal(t, http.StatusOK, sendJSON(r, "POST", "/accounts", `{"name":"Euros","type":"cash","currency":"EUR"}`, 1).Code)
+
+	for _, body := range []string{
+		`{"amount":500,"category":"Salary","date":"2025-04-01","account_id":1}`,
+		`{"amount":200,"category":"Salary","date":"2025-04-20","account_id":1}`,
+	} {
+		assert.Equal(t, http.StatusOK, sendJSON(r, "POST", "/incomes", body, 1).Code, body)
+	}
+	for _, body := range []string{
+		`{"amount":100,"category":"Rent","description":"April","date":"2025-04-05","account_id":1}`,
+		`{"amount":40,"category":"Food","date":"2025-04-10","account_id":2}`,
+		`{"amount":60,"category":"Food","date":"2025-04-16","account_id":2}`,
+		`{"amount":5,"category":"Food","date":"2025-04-16"}`,
+	} {
+		assert.Equal(t, http.StatusOK, sendJSON(r, "POST", "/expenses", body, 1).Code, body)
+	}
+	// the account must be the user's and in the same currency
+	assert.Equal(t, http.StatusBadRequest, sendJSON(r, "POST", "/expenses", `{"amount":5,"category":"Food","date":"2025-04-16","account_id":3}`, 1).Code)
+	assert.Equal(t, http.StatusBadRequest, sendJSON(r, "POST", "/expenses", `{"amount":5,"category":"Food","date":"2025-04-16","account_id":1}`, 2).Code)
+
+	var balance struct {
+		Balance          Money `json:"balance"`
+		StatementDate    Date  `json:"statement_date"`
+		StatementBalance Money `json:"statement_balance"`
+		AvailableCredit  Money `json:"available_credit"`
+	}
+	assert.Equal(t, http.StatusOK, getJSON(r, "/accounts/1/balance?date=2025-04-30", 1, &balance))
+	assert.Equal(t, Money(160000), balance.Balance)
+	assert.Equal(t, http.StatusOK, getJSON(r, "/accounts/1/balance?date=2025-04-10", 1, &balance))
+	assert.Equal(t, Money(140000), balance.Balance)
+
+	assert.Equal(t, http.StatusOK, getJSON(r, "/accounts/2/balance?date=2025-04-30", 1, &balance))
+	assert.Equal(t, Money(-10000), balance.Balance)
+	assert.Equal(t, mustDate("2025-04-15"), balance.StatementDate)
+	assert.Equal(t, Money(-4000), balance.StatementBalance)
+	assert.Equal(t, Money(190000), balance.AvailableCredit)
+	assert.Equal(t, http.StatusOK, getJSON(r, "/accounts/2/balance?date=2025-04-10", 1, &balance))
+	assert.Equal(t, mustDate("2025-03-15"), balance.StatementDate)
+
+	var ledger struct {
+		OpeningBalance Money         `json:"opening_balance"`
+		ClosingBalance Money         `json:"closing_balance"`
+		Entries        []ledgerEntry `json:"entries"`
+	}
+	assert.Equal(t, http.StatusOK, getJSON(r, "/accounts/1/ledger?from=2025-04-02", 1, &ledger))
+	assert.Equal(t, Money(150000), ledger.OpeningBalance)
+	assert.Equal(t, Money(160000), ledger.ClosingBalance)
+	if assert.Len(t, ledger.Entries, 2) {
+		assert.Equal(t, ledgerEntry{Date: mustDate("2025-04-05"), Kind: kindExpense, ID: 1, Description: "April", Category: "Rent",
+			Amount: -10000, Balance: 140000}, ledger.Entries[0])
+		assert.Equal(t, Money(20000), ledger.Entries[1].Amount)
+	}
+
+	var accounts []Account
+	assert.Equal(t, http.StatusOK, getJSON(r, "/accounts", 1, &accounts))
+	if assert.Len(t, accounts, 3) {
+		assert.Equal(t, "Euros", accounts[0].Name)
+		assert.Equal(t, Money(160000), *accounts[1].Balance)
+	}
+
+	// lists filter by account
+	var expenses listResponse[Expense]
+	assert.Equal(t, http.StatusOK, getJSON(r, "/expenses?account_id=2", 1, &expenses))
+	assert.Len(t, expenses.Data, 2)
+
+	assert.Equal(t, http.StatusBadRequest, sendJSON(r, "PATCH", "/accounts/1", `{"currency":"EUR"}`, 1).Code)
+	assert.Equal(t, http.StatusOK, sendJSON(r, "PATCH", "/accounts/1", `{"name":"Everyday"}`, 1).Code)
+	assert.Equal(t, http.StatusConflict, sendJSON(r, "DELETE", "/accounts/1", "", 1).Code)
+	assert.Equal(t, http.StatusForbidden, sendJSON(r, "DELETE", "/accounts/3", "", 2).Code)
+	assert.Equal(t, http.StatusOK, sendJSON(r, "DELETE", "/accounts/3", "", 1).Code)
+}
@@ -0,0 +1,720 @@
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// archiveFormat and archiveVersion identify export archives. The version
+// goes up whenever a change to the archive would make an older server
+// misread it; restores refuse archives newer than they know.
+const (
+	archiveFormat  = "fintrack-archive"
+	archiveVersion = 2 // 2 added transaction rules
+	maxArchiveSize = 100 << 20
+)
+
+// archiveProfile is the part of a user's profile an archive carries. The
+// password is never exported.
+type archiveProfile struct {
+	FullName     string `json:"full_name"`
+	Username     string `json:"username"`
+	Email        string `json:"email"`
+	BaseCurrency string `json:"base_currency"`
+	Timezone     string `json:"timezone"`
+}
+
+// archive is the whole of a user's data as exported. IDs are those of the
+// exporting server; a restore gives every record a new one. Links to
+// import batches are not kept.
+type archive struct {
+	Format             string              `json:"format"`
+	Version            int                 `json:"version"`
+	ExportedAt         time.Time           `json:"exported_at"`
+	Profile            archiveProfile      `json:"profile"`
+	Categories         []Category          `json:"categories"`
+	Tags               []Tag               `json:"tags"`
+	Accounts           []Account           `json:"accounts"`
+	RecurringRules     []RecurringRule     `json:"recurring_rules"`
+	RecurringOverrides []RecurringOverride `json:"recurring_overrides"`
+	Expenses           []Expense           `json:"expenses"` // with tags and splits
+	Incomes            []Income            `json:"incomes"`  // with tags
+	Budgets            []Budget            `json:"budgets"`
+	Transfers          []Transfer          `json:"transfers"`
+	Bills              []Bill              `json:"bills"`             // with payments
+	TransactionRules   []TransactionRule   `json:"transaction_rules"` // with tags
+}
+
+// archiveWriter writes an archive as a JSON object one member at a time,
+// so that large archives are never held in memory. The first error sticks.
+type archiveWriter struct {
+	w     *bufio.Writer
+	first bool
+	err   error
+}
+
+func (aw *archiveWriter) raw(s string) {
+	if aw.err == nil {
+		_, aw.err = aw.w.WriteString(s)
+	}
+}
+
+func (aw *archiveWriter) value(v interface{}) {
+	if aw.err != nil {
+		return
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		aw.err = err
+		return
+	}
+	_, aw.err = aw.w.Write(b)
+}
+
+// member starts the next member of the object.
+func (aw *archiveWriter) member(name string) {
+	if !aw.first {
+		aw.raw(",")
+	}
+	aw.first = false
+	aw.value(name)
+	aw.raw(":")
+}
+
+// archiveRows writes the rows query finds as the array member name,
+// reading them in batches.
+func archiveRows[T any](aw *archiveWriter, name string, query *gorm.DB) {
+	aw.member(name)
+	aw.raw("[")
+	var batch []T
+	n := 0
+	err := query.FindInBatches(&batch, 500, func(*gorm.DB, int) error {
+		for _, row := range batch {
+			if n > 0 {
+				aw.raw(",")
+			}
+			aw.value(row)
+			n++
+		}
+		return aw.err
+	}).Error
+	if aw.err == nil {
+		aw.err = err
+	}
+	aw.raw("]")
+}
+
+// writeArchive writes user's archive to w.
+func writeArchive(w io.Writer, user User) error {
+	aw := &archiveWriter{w: bufio.NewWriter(w), first: true}
+	owned := func() *gorm.DB { return db.Where("user_id = ?", user.ID) }
+	aw.raw("{")
+	aw.member("format")
+	aw.value(archiveFormat)
+	aw.member("version")
+	aw.value(archiveVersion)
+	aw.member("exported_at")
+	aw.value(time.Now().UTC())
+	aw.member("profile")
+	aw.value(archiveProfile{FullName: user.FullName, Username: user.Username, Email: user.Email,
+		BaseCurrency: user.BaseCurrency, Timezone: user.Timezone})
+	archiveRows[Category](aw, "categories", owned())
+	archiveRows[Tag](aw, "tags", owned())
+	archiveRows[Account](aw, "accounts", owned())
+	archiveRows[RecurringRule](aw, "recurring_rules", owned())
+	archiveRows[RecurringOverride](aw, "recurring_overrides",
+		db.Where("rule_id IN (?)", db.Model(&RecurringRule{}).Select("id").Where("user_id = ?", user.ID)))
+	archiveRows[Expense](aw, "expenses", owned().Preload("Tags").Preload("Splits"))
+	archiveRows[Income](aw, "incomes", owned().Preload("Tags"))
+	archiveRows[Budget](aw, "budgets", owned())
+	archiveRows[Transfer](aw, "transfers", owned())
+	archiveRows[Bill](aw, "bills", owned().Preload("Payments"))
+	archiveRows[TransactionRule](aw, "transaction_rules", owned().Preload("Tags").Order("position, id"))
+	aw.raw("}\n")
+	if aw.err != nil {
+		return aw.err
+	}
+	return aw.w.Flush()
+}
+
+// ExportArchive streams the user's data as a JSON archive, or with
+// format=zip as a zip file holding it, for backups and for moving to
+// another server with RestoreArchive.
+func ExportArchive(c *gin.Context) {
+	userID := currentUserID(c)
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "zip" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be json or zip"})
+		return
+	}
+	var user User
+	if err := db.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	name := "fintrack-" + today(userID).String()
+	c.Header("Content-Disposition", `attachment; filename="`+name+"."+format+`"`)
+	var err error
+	if format == "zip" {
+		c.Header("Content-Type", "application/zip")
+		c.Status(http.StatusOK)
+		zw := zip.NewWriter(c.Writer)
+		var f io.Writer
+		if f, err = zw.Create(name + ".json"); err == nil {
+			err = writeArchive(f, user)
+		}
+		if err == nil {
+			err = zw.Close()
+		}
+	} else {
+		c.Header("Content-Type", "application/json")
+		c.Status(http.StatusOK)
+		err = writeArchive(c.Writer, user)
+	}
+	// The response has begun, so a failure can only cut it short; the
+	// archive is then unreadable rather than silently incomplete.
+	if err != nil {
+		log.Printf("export for user %d failed: %v", userID, err)
+	}
+}
+
+var errBadArchive = errors.New("archive is invalid")
+
+func badArchive(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", errBadArchive, fmt.Sprintf(format, args...))
+}
+
+// readArchive decodes an archive uploaded as JSON or as a zip file holding
+// it, after checking that it is one and that its version is known.
+func readArchive(data string) (archive, error) {
+	if strings.HasPrefix(data, "PK\x03\x04") {
+		zr, err := zip.NewReader(strings.NewReader(data), int64(len(data)))
+		if err != nil {
+			return archive{}, badArchive("zip file cannot be read")
+		}
+		var found *zip.File
+		for _, f := range zr.File {
+			if strings.HasSuffix(f.Name, ".json") {
+				found = f
+				break
+			}
+		}
+		if found == nil {
+			return archive{}, badArchive("zip file holds no .json file")
+		}
+		rc, err := found.Open()
+		if err != nil {
+			return archive{}, badArchive("zip file cannot be read")
+		}
+		defer rc.Close()
+		b, err := io.ReadAll(io.LimitReader(rc, maxArchiveSize+1))
+		if err != nil {
+			return archive{}, badArchive("zip file cannot be read")
+		}
+		if len(b) > maxArchiveSize {
+			return archive{}, badArchive("archive is larger than %d MB", maxArchiveSize>>20)
+		}
+		data = string(b)
+	}
+
+	var head struct {
+		Format  string `json:"format"`
+		Version int    `json:"version"`
+	}
+	if err := json.Unmarshal([]byte(data), &head); err != nil || head.Format != archiveFormat {
+		return archive{}, errors.New("file is not a FinTrack archive")
+	}
+	if head.Version < 1 || head.Version > archiveVersion {
+		return archive{}, fmt.Errorf("archive version %d is not supported; this server reads versions 1 to %d", head.Version, archiveVersion)
+	}
+	var a archive
+	if err := json.Unmarshal([]byte(data), &a); err != nil {
+		return archive{}, badArchive("%v", err)
+	}
+	return a, nil
+}
+
+// restoreResult counts what a restore created. Categories, tags and
+// accounts that match ones the user already has are merged into them.
+type restoreResult struct {
+	Categories       int `json:"categories"`
+	Tags             int `json:"tags"`
+	Accounts         int `json:"accounts"`
+	Merged           int `json:"merged"`
+	RecurringRules   int `json:"recurring_rules"`
+	Expenses         int `json:"expenses"`
+	Incomes          int `json:"incomes"`
+	Budgets          int `json:"budgets"`
+	Transfers        int `json:"transfers"`
+	Bills            int `json:"bills"`
+	TransactionRules int `json:"transaction_rules"`
+}
+
+// idMap translates the ids of an archive into those of the records
+// restored from it.
+type idMap struct {
+	what string
+	ids  map[uint]uint
+}
+
+func newIDMap(what string) idMap { return idMap{what, map[uint]uint{}} }
+
+// get translates id, which must have been restored.
+func (m idMap) get(id uint) (uint, error) {
+	n, ok := m.ids[id]
+	if !ok {
+		return 0, badArchive("%s %d is not in the archive", m.what, id)
+	}
+	return n, nil
+}
+
+// ptr translates an optional id.
+func (m idMap) ptr(id *uint) (*uint, error) {
+	if id == nil {
+		return nil, nil
+	}
+	n, err := m.get(*id)
+	return &n, err
+}
+
+// restorer holds what a restore has done so far.
+type restorer struct {
+	tx       *gorm.DB
+	userID   uint
+	result   restoreResult
+	category idMap
+	names    map[uint]string // restored category names by new id
+	tag      idMap
+	account  idMap
+	currency map[uint]string // restored account currencies by new id
+	rule     idMap
+	expense  idMap
+}
+
+// categoryName remaps a category reference, returning the name to store
+// beside it.
+func (r *restorer) categoryName(id **uint, name string) (string, error) {
+	n, err := r.category.ptr(*id)
+	if err != nil {
+		return "", err
+	}
+	*id = n
+	if n != nil {
+		return r.names[*n], nil
+	}
+	return name, nil
+}
+
+// accountFor remaps an account reference, checking the currency booked to
+// it.
+func (r *restorer) accountFor(id **uint, currency string) error {
+	n, err := r.account.ptr(*id)
+	if err != nil {
+		return err
+	}
+	if n != nil && r.currency[*n] != currency {
+		return badArchive("a %s transaction is booked to a %s account", currency, r.currency[*n])
+	}
+	*id = n
+	return nil
+}
+
+// categories restores categories parents first, merging each into the
+// user's category of the same kind and name if there is one.
+func (r *restorer) categories(all []Category) error {
+	pending := all
+	for len(pending) > 0 {
+		var later []Category
+		for _, cat := range pending {
+			if cat.ParentID != nil {
+				if _, ok := r.category.ids[*cat.ParentID]; !ok {
+					later = append(later, cat)
+					continue
+				}
+			}
+			if strings.TrimSpace(cat.Name) == "" || cat.Kind != kindExpense && cat.Kind != kindIncome {
+				return badArchive("category %d needs a name and a kind of expense or income", cat.ID)
+			}
+			old := cat.ID
+			existing, err := findCategoryByName(r.tx, r.userID, cat.Kind, cat.Name)
+			if err == nil {
+				r.category.ids[old], r.names[existing.ID] = existing.ID, existing.Name
+				r.result.Merged++
+				continue
+			}
+			if !errors.Is(err, gorm.ErrRecordNotFound) {
+				return err
+			}
+			cat.ID, cat.UserID = 0, r.userID
+			if cat.ParentID, err = r.category.ptr(cat.ParentID); err != nil {
+				return err
+			}
+			if err := r.tx.Create(&cat).Error; err != nil {
+				return err
+			}
+			r.category.ids[old], r.names[cat.ID] = cat.ID, cat.Name
+			r.result.Categories++
+		}
+		if len(later) == len(pending) {
+			return badArchive("category %d has a parent that is not in the archive", later[0].ID)
+		}
+		pending = later
+	}
+	return nil
+}
+
+func (r *restorer) tags(all []Tag) error {
+	for _, tag := range all {
+		if strings.TrimSpace(tag.Name) == "" {
+			return badArchive("tag %d needs a name", tag.ID)
+		}
+		old := tag.ID
+		existing, err := findTagByName(r.tx, r.userID, tag.Name)
+		if err == nil {
+			r.tag.ids[old] = existing.ID
+			r.result.Merged++
+			continue
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		tag.ID, tag.UserID = 0, r.userID
+		if err := r.tx.Create(&tag).Error; err != nil {
+			return err
+		}
+		r.tag.ids[old] = tag.ID
+		r.result.Tags++
+	}
+	return nil
+}
+
+// accounts restores accounts, merging each into the user's account of the
+// same name, type and currency if there is one.
+func (r *restorer) accounts(all []Account) error {
+	for _, account := range all {
+		if err := account.validate(); err != nil {
+			return badArchive("account %d: %v", account.ID, err)
+		}
+		old := account.ID
+		var existing Account
+		err := r.tx.Where("user_id = ? AND LOWER(name) = ? AND type = ? AND currency = ?",
+			r.userID, strings.ToLower(strings.TrimSpace(account.Name)), account.Type, account.Currency).Order("id").First(&existing).Error
+		if err == nil {
+			r.account.ids[old], r.currency[existing.ID] = existing.ID, existing.Currency
+			r.result.Merged++
+			continue
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		account.ID, account.UserID, account.Balance = 0, r.userID, nil
+		if err := r.tx.Create(&account).Error; err != nil {
+			return err
+		}
+		r.account.ids[old], r.currency[account.ID] = account.ID, account.Currency
+		r.result.Accounts++
+	}
+	return nil
+}
+
+func (r *restorer) recurring(rules []RecurringRule, overrides []RecurringOverride) error {
+	var err error
+	for _, rule := range rules {
+		if err := rule.validate(); err != nil {
+			return badArchive("recurring rule %d: %v", rule.ID, err)
+		}
+		old := rule.ID
+		if rule.Category, err = r.categoryName(&rule.CategoryID, rule.Category); err != nil {
+			return err
+		}
+		if err := r.accountFor(&rule.AccountID, rule.Currency); err != nil {
+			return err
+		}
+		rule.ID, rule.UserID = 0, r.userID
+		if err := r.tx.Create(&rule).Error; err != nil {
+			return err
+		}
+		r.rule.ids[old] = rule.ID
+		r.result.RecurringRules++
+	}
+	for _, o := range overrides {
+		if o.RuleID, err = r.rule.get(o.RuleID); err != nil {
+			return err
+		}
+		o.ID = 0
+		if err := r.tx.Create(&o).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// tagRefs remaps the tags of a transaction to the restored ones.
+func (r *restorer) tagRefs(tags []Tag) ([]Tag, error) {
+	refs := make([]Tag, len(tags))
+	for i, tag := range tags {
+		id, err := r.tag.get(tag.ID)
+		if err != nil {
+			return nil, err
+		}
+		refs[i] = Tag{ID: id, UserID: r.userID}
+	}
+	return refs, nil
+}
+
+func (r *restorer) expenses(all []Expense) error {
+	var err error
+	for i := range all {
+		e := &all[i]
+		if err := e.validate(); err != nil {
+			return badArchive("expense %d: %v", e.ID, err)
+		}
+		if e.Category, err = r.categoryName(&e.CategoryID, e.Category); err != nil {
+			return err
+		}
+		if err := r.accountFor(&e.AccountID, e.Currency); err != nil {
+			return err
+		}
+		if e.RecurringRuleID, err = r.rule.ptr(e.RecurringRuleID); err != nil {
+			return err
+		}
+		if e.Tags, err = r.tagRefs(e.Tags); err != nil {
+			return err
+		}
+		for j := range e.Splits {
+			s := &e.Splits[j]
+			if s.Category, err = r.categoryName(&s.CategoryID, s.Category); err != nil {
+				return err
+			}
+			s.ID, s.ExpenseID = 0, 0
+		}
+		e.UserID, e.ImportBatchID = r.userID, nil
+	}
+	old := make([]uint, len(all))
+	for i := range all {
+		old[i], all[i].ID = all[i].ID, 0
+	}
+	if len(all) > 0 {
+		if err := r.tx.Omit("Tags.*").CreateInBatches(&all, 500).Error; err != nil {
+			return err
+		}
+	}
+	for i := range all {
+		r.expense.ids[old[i]] = all[i].ID
+	}
+	r.result.Expenses = len(all)
+	return nil
+}
+
+func (r *restorer) incomes(all []Income) error {
+	var err error
+	for i := range all {
+		in := &all[i]
+		if err := in.validate(); err != nil {
+			return badArchive("income %d: %v", in.ID, err)
+		}
+		if in.Category, err = r.categoryName(&in.CategoryID, in.Category); err != nil {
+			return err
+		}
+		if err := r.accountFor(&in.AccountID, in.Currency); err != nil {
+			return err
+		}
+		if in.RecurringRuleID, err = r.rule.ptr(in.RecurringRuleID); err != nil {
+			return err
+		}
+		if in.Tags, err = r.tagRefs(in.Tags); err != nil {
+			return err
+		}
+		in.ID, in.UserID, in.ImportBatchID = 0, r.userID, nil
+	}
+	if len(all) > 0 {
+		if err := r.tx.Omit("Tags.*").CreateInBatches(&all, 500).Error; err != nil {
+			return err
+		}
+	}
+	r.result.Incomes = len(all)
+	return nil
+}
+
+func (r *restorer) budgets(all []Budget) error {
+	for i := range all {
+		if err := all[i].validate(); err != nil {
+			return badArchive("budget %d: %v", all[i].ID, err)
+		}
+		all[i].ID, all[i].UserID, all[i].Progress = 0, r.userID, nil
+	}
+	if len(all) > 0 {
+		if err := r.tx.CreateInBatches(&all, 500).Error; err != nil {
+			return err
+		}
+	}
+	r.result.Budgets = len(all)
+	return nil
+}
+
+func (r *restorer) transfers(all []Transfer) error {
+	var err error
+	for i := range all {
+		t := &all[i]
+		if err := t.validate(); err != nil {
+			return badArchive("transfer %d: %v", t.ID, err)
+		}
+		if t.FromAccountID, err = r.account.get(t.FromAccountID); err != nil {
+			return err
+		}
+		if t.ToAccountID, err = r.account.get(t.ToAccountID); err != nil {
+			return err
+		}
+		t.ID, t.UserID = 0, r.userID
+	}
+	if len(all) > 0 {
+		if err := r.tx.CreateInBatches(&all, 500).Error; err != nil {
+			return err
+		}
+	}
+	r.result.Transfers = len(all)
+	return nil
+}
+
+func (r *restorer) bills(all []Bill) error {
+	var err error
+	for _, bill := range all {
+		if err := bill.validate(); err != nil {
+			return badArchive("bill %d: %v", bill.ID, err)
+		}
+		if bill.Category, err = r.categoryName(&bill.CategoryID, bill.Category); err != nil {
+			return err
+		}
+		for i := range bill.Payments {
+			p := &bill.Payments[i]
+			if p.ExpenseID, err = r.expense.ptr(p.ExpenseID); err != nil {
+				return err
+			}
+			p.ID, p.BillID = 0, 0
+		}
+		bill.ID, bill.UserID = 0, r.userID
+		if err := r.tx.Create(&bill).Error; err != nil {
+			return err
+		}
+		r.result.Bills++
+	}
+	return nil
+}
+
+// transactionRules restores the rules that file transactions, in their
+// order.
+func (r *restorer) transactionRules(all []TransactionRule) error {
+	var err error
+	for _, rule := range all {
+		rule.normalize()
+		if err := rule.validate(); err != nil {
+			return badArchive("transaction rule %d: %v", rule.ID, err)
+		}
+		if rule.Category, err = r.categoryName(&rule.CategoryID, rule.Category); err != nil {
+			return err
+		}
+		if rule.AccountID, err = r.account.ptr(rule.AccountID); err != nil {
+			return err
+		}
+		if rule.Tags, err = r.tagRefs(rule.Tags); err != nil {
+			return err
+		}
+		rule.ID, rule.UserID = 0, r.userID
+		if err := r.tx.Omit("Tags.*").Create(&rule).Error; err != nil {
+			return err
+		}
+		r.result.TransactionRules++
+	}
+	return nil
+}
+
+// restoreArchive adds the archive's records to the user's in a single
+// database transaction, giving them new ids and remapping every reference
+// between them. With profile, the archive's base currency and timezone
+// replace the user's; name, username and email are never changed.
+func restoreArchive(userID uint, a archive, profile bool) (restoreResult, error) {
+	r := &restorer{
+		userID:   userID,
+		category: newIDMap("category"),
+		names:    map[uint]string{},
+		tag:      newIDMap("tag"),
+		account:  newIDMap("account"),
+		currency: map[uint]string{},
+		rule:     newIDMap("recurring rule"),
+		expense:  newIDMap("expense"),
+	}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		r.tx = tx
+		if profile {
+			p := a.Profile
+			if !validCurrency(p.BaseCurrency) {
+				return badArchive("profile: %v", errInvalidCurrency)
+			}
+			if _, err := time.LoadLocation(p.Timezone); err != nil || p.Timezone == "" {
+				return badArchive("profile: timezone %q is not an IANA zone name", p.Timezone)
+			}
+			if err := tx.Model(&User{}).Where("id = ?", userID).
+				Updates(map[string]interface{}{"base_currency": p.BaseCurrency, "timezone": p.Timezone}).Error; err != nil {
+				return err
+			}
+		}
+		for _, step := range []func() error{
+			func() error { return r.categories(a.Categories) },
+			func() error { return r.tags(a.Tags) },
+			func() error { return r.accounts(a.Accounts) },
+			func() error { return r.recurring(a.RecurringRules, a.RecurringOverrides) },
+			func() error { return r.expenses(a.Expenses) },
+			func() error { return r.incomes(a.Incomes) },
+			func() error { return r.budgets(a.Budgets) },
+			func() error { return r.transfers(a.Transfers) },
+			func() error { return r.bills(a.Bills) },
+			func() error { return r.transactionRules(a.TransactionRules) },
+		} {
+			if err := step(); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return r.result, err
+}
+
+// RestoreArchive adds the records of an archive made by ExportArchive,
+// uploaded as the multipart field file, to the user's account, whether new
+// or in use. Nothing is saved unless everything is. Restoring an archive
+// twice adds its transactions twice. With restore_profile=true the
+// archive's base currency and timezone are taken too.
+func RestoreArchive(c *gin.Context) {
+	userID := currentUserID(c)
+	data, ok := readImportFile(c, maxArchiveSize)
+	if !ok {
+		return
+	}
+	a, err := readArchive(data)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	result, err := restoreArchive(userID, a, c.PostForm("restore_profile") == "true")
+	if errors.Is(err, errBadArchive) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore archive"})
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// exportArchive fetches a user's archive in format.
+func exportArchive(t *testing.T, r http.Handler, format string, userID uint) []byte {
+	req := httptest.NewRequest("GET", "/export?format="+format, nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, withAuth(req, userID))
+	assert.Equal(t, http.StatusOK, w.Code)
+	return w.Body.Bytes()
+}
+
+func seedArchiveData() {
+	db.Create(&User{FullName: "A", Username: "a", Email: "a@x.com", Password: "p", BaseCurrency: "EUR", Timezone: "Europe/Berlin"})
+	db.Create(&User{FullName: "B", Username: "b", Email: "b@x.com", Password: "p", BaseCurrency: "USD"})
+	db.Create(&User{FullName: "C", Username: "c", Email: "c@x.com", Password: "p", BaseCurrency: "USD"})
+	food := Category{UserID: 1, Name: "Food", Kind: kindExpense}
+	db.Create(&food)
+	groceries := Category{UserID: 1, Name: "Groceries", Kind: kindExpense, ParentID: &food.ID}
+	db.Create(&groceries)
+	salary := Category{UserID: 1, Name: "Salary", Kind: kindIncome}
+	db.Create(&salary)
+	trip := Tag{UserID: 1, Name: "Trip"}
+	db.Create(&trip)
+	checking := Account{UserID: 1, Name: "Checking", Type: accountChecking, Currency: "EUR", OpeningBalance: 100000}
+	savings := Account{UserID: 1, Name: "Savings", Type: accountSavings, Currency: "EUR"}
+	db.Create(&checking)
+	db.Create(&savings)
+	rule := RecurringRule{UserID: 1, Kind: kindIncome, Frequency: freqMonthly, Interval: 1, StartDate: mustDate("2025-04-01"),
+		Amount: 300000, Currency: "EUR", CategoryID: &salary.ID, Category: "Salary", Generated: 1, NextDate: mustDate("2025-05-01")}
+	db.Create(&rule)
+	db.Create(&RecurringOverride{RuleID: rule.ID, Occurrence: mustDate("2025-06-01"), Skip: true})
+
+	shop := Expense{UserID: 1, Amount: 5000, Currency: "EUR", CategoryID: &groceries.ID, Category: "Groceries", Date: mustDate("2025-04-03"),
+		AccountID: &checking.ID, Tags: []Tag{trip}, Splits: []ExpenseSplit{
+			{CategoryID: &groceries.ID, Category: "Groceries", Amount: 3000},
+			{CategoryID: &food.ID, Category: "Food", Amount: 2000},
+		}}
+	db.Create(&shop)
+	db.Create(&Income{UserID: 1, Amount: 300000, Currency: "EUR", CategoryID: &salary.ID, Category: "Salary", Date: mustDate("2025-04-01"),
+		AccountID: &checking.ID, RecurringRuleID: &rule.ID, Occurrence: mustDate("2025-04-01"), Tags: []Tag{trip}})
+	db.Create(&Budget{UserID: 1, BudgetName: "April", BudgetAmount: 50000, Currency: "EUR", StartDate: mustDate("2025-04-01"),
+		EndDate: mustDate("2025-04-30"), Categories: []string{"Groceries"}})
+	db.Create(&Transfer{UserID: 1, FromAccountID: checking.ID, ToAccountID: savings.ID, Amount: 10000, ToAmount: 10000, Rate: 1, Date: mustDate("2025-04-05")})
+	db.Create(&Bill{UserID: 1, Name: "Shop", Amount: 5000, Currency: "EUR", CategoryID: &groceries.ID, Category: "Groceries", DueDate: mustDate("2025-04-03"),
+		Payments: []BillPayment{{Amount: 5000, Date: mustDate("2025-04-03"), ExpenseID: &shop.ID}}})
+	db.Create(&TransactionRule{UserID: 1, Kind: kindExpense, DescriptionContains: "market", AccountID: &checking.ID,
+		CategoryID: &groceries.ID, Category: "Groceries", Tags: []Tag{trip}})
+}
+
+func TestExportArchive(t *testing.T) {
+	setupTestDB()
+	r := setupRouter()
+	seedArchiveData()
+
+	var a archive
+	assert.NoError(t, json.Unmarshal(exportArchive(t, r, "json", 1), &a))
+	assert.Equal(t, archiveFormat, a.Format)
+	assert.Equal(t, archiveVersion, a.Version)
+	assert.Equal(t, archiveProfile{FullName: "A", Username: "a", Email: "a@x.com", BaseCurrency: "EUR", Timezone: "Europe/Berlin"}, a.Profile)
+	assert.Len(t, a.Categories, 3)
+	assert.Len(t, a.RecurringOverrides, 1)
+	if assert.Len(t, a.Expenses, 1) {
+		assert.Len(t, a.Expenses[0].Splits, 2)
+		assert.Len(t, a.Expenses[0].Tags, 1)
+	}
+	if assert.Len(t, a.Bills, 1) {
+		assert.Len(t, a.Bills[0].Payments, 1)
+	}
+	if assert.Len(t, a.TransactionRules, 1) {
+		assert.Len(t, a.TransactionRules[0].Tags, 1)
+	}
+	assert.NotContains(t, string(exportArchive(t, r, "json", 1)), `"password"`)
+
+	// another user's archive holds none of it
+	assert.NoError(t, json.Unmarshal(exportArchive(t, r, "json", 2), &a))
+	assert.Empty(t, a.Expenses)
+	assert.Empty(t, a.RecurringOverrides)
+
+	// the zip file holds the same archive
+	data := exportArchive(t, r, "zip", 1)
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if assert.NoError(t, err) && assert.Len(t, zr.File, 1) {
+		f, _ := zr.File[0].Open()
+		b, _ := io.ReadAll(f)
+		assert.NoError(t, json.Unmarshal(b, &a))
+		assert.Len(t, a.Expenses, 1)
+	}
+
+	assert.Equal(t, http.StatusBadRequest, sendJSON(r, "GET", "/export?format=xml", "", 1).Code)
+}
+
+func TestRestoreArchive(t *testing.T) {
+	setupTestDB()
+	r := setupRouter()
+	seedArchiveData()
+	archiveJSON := string(exportArchive(t, r, "json", 1))
+
+	// into a fresh account, with the profile
+	w := uploadFile(r, "/import/archive", archiveJSON, map[string]string{"restore_profile": "true"}, 2)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var result restoreResult
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+	assert.Equal(t, restoreResult{Categories: 3, Tags: 1, Accounts: 2, RecurringRules: 1, Expenses: 1, Incomes: 1,
+		Budgets: 1, Transfers: 1, Bills: 1, TransactionRules: 1}, result)
+
+	var user User
+	db.First(&user, 2)
+	assert.Equal(t, "EUR", user.BaseCurrency)
+	assert.Equal(t, "Europe/Berlin", user.Timezone)
+	assert.Equal(t, "b", user.Username)
+
+	// every reference points at the restored records
+	var accounts []Account
+	db.Where("user_id = 2").Order("id").Find(&accounts)
+	var groceries, food Category
+	db.Where("user_id = 2 AND name = ?", "Groceries").First(&groceries)
+	db.Where("user_id = 2 AND name = ?", "Food").First(&food)
+	assert.Equal(t, &food.ID, groceries.ParentID)
+
+	var expense Expense
+	db.Preload("Tags").Preload("Splits").Where("user_id = 2").First(&expense)
+	assert.Equal(t, &groceries.ID, expense.CategoryID)
+	assert.Equal(t, &accounts[0].ID, expense.AccountID)
+	if assert.Len(t, expense.Tags, 1) {
+		assert.Equal(t, uint(2), expense.Tags[0].UserID)
+	}
+	if assert.Len(t, expense.Splits, 2) {
+		assert.Equal(t, &food.ID, expense.Splits[1].CategoryID)
+	}
+	var rule RecurringRule
+	db.Where("user_id = 2").First(&rule)
+	var income Income
+	db.Where("user_id = 2").First(&income)
+	assert.Equal(t, &rule.ID, income.RecurringRuleID)
+	var override RecurringOverride
+	db.Where("rule_id = ?", rule.ID).First(&override)
+	assert.True(t, override.Skip)
+	var transfer Transfer
+	db.Where("user_id = 2").First(&transfer)
+	assert.Equal(t, accounts[1].ID, transfer.ToAccountID)
+	var bill Bill
+	db.Preload("Payments").Where("user_id = 2").First(&bill)
+	if assert.Len(t, bill.Payments, 1) {
+		assert.Equal(t, &expense.ID, bill.Payments[0].ExpenseID)
+	}
+
+	var filing TransactionRule
+	db.Preload("Tags").Where("user_id = 2").First(&filing)
+	assert.Equal(t, &groceries.ID, filing.CategoryID)
+	assert.Equal(t, &accounts[0].ID, filing.AccountID)
+	if assert.Len(t, filing.Tags, 1) {
+		assert.Equal(t, expense.Tags[0].ID, filing.Tags[0].ID)
+	}
+
+	// the restored account reports the same balance
+	var balance struct {
+		Balance Money `json:"balance"`
+	}
+	getJSON(r, fmt.Sprintf("/accounts/%d/balance?date=2025-04-30", accounts[0].ID), 2, &balance)
+	assert.Equal(t, Money(100000+300000-5000-10000), balance.Balance)
+
+	// into an account in use, merging categories, tags and accounts
+	w = uploadFile(r, "/import/archive", archiveJSON, nil, 1)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+	assert.Equal(t, 6, result.Merged)
+	assert.Zero(t, result.Categories+result.Tags+result.Accounts)
+	assert.Equal(t, 1, result.Expenses)
+
+	// archives from before transaction rules still restore
+	w = uploadFile(r, "/import/archive", strings.Replace(archiveJSON, `"version":2`, `"version":1`, 1), nil, 3)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// from a zip file
+	w = uploadFile(r, "/import/archive", string(exportArchive(t, r, "zip", 2)), nil, 3)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// archives of other versions, other files and broken archives are
+	// refused, and nothing of them is saved
+	var before int64
+	db.Model(&Expense{}).Count(&before)
+	for _, bad := range []string{
+		strings.Replace(archiveJSON, `"version":2`, `"version":3`, 1),
+		strings.Replace(archiveJSON, `"format":"fintrack-archive"`, `"format":"other"`, 1),
+		`date,amount`,
+		strings.Replace(archiveJSON, `"to_account_id":2`, `"to_account_id":9`, 1),
+		strings.Replace(archiveJSON, `"budget_amount":500.00`, `"budget_amount":0`, 1),
+	} {
+		assert.Equal(t, http.StatusBadRequest, uploadFile(r, "/import/archive", bad, nil, 3).Code)
+	}
+	var after int64
+	db.Model(&Expense{}).Count(&after)
+	assert.Equal(t, before, after)
+}
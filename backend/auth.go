@@ -0,0 +1,121 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// userIDKey is the gin context key under which AuthMiddleware stores the
+// authenticated user's ID, and sessionIDKey the session family the access
+// token was issued for.
+const (
+	userIDKey    = "userID"
+	sessionIDKey = "sessionID"
+)
+
+// owned is implemented by every model that belongs to a single user.
+type owned interface {
+	OwnerID() uint
+}
+
+func (e Expense) OwnerID() uint { return e.UserID }
+func (i Income) OwnerID() uint  { return i.UserID }
+func (b Budget) OwnerID() uint  { return b.UserID }
+
+// AuthMiddleware rejects requests without a valid HS256 bearer token signed
+// with jwtKey for an active session, and stores the token's user ID and
+// session in the request context.
+func AuthMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tokenStr, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if !ok || tokenStr == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Missing bearer token"})
+			return
+		}
+
+		claims := jwt.MapClaims{}
+		_, err := jwt.ParseWithClaims(tokenStr, claims, func(t *jwt.Token) (interface{}, error) {
+			return jwtKey, nil
+		}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired())
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
+			return
+		}
+
+		id, ok := claims["userId"].(float64)
+		if !ok || id <= 0 {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
+			return
+		}
+
+		sid, _ := claims["sid"].(string)
+		if sid == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
+			return
+		}
+		active, err := sessionActive(uint(id), sid)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to check session"})
+			return
+		}
+		if !active {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Session revoked"})
+			return
+		}
+		c.Set(userIDKey, uint(id))
+		c.Set(sessionIDKey, sid)
+		c.Next()
+	}
+}
+
+// currentUserID returns the ID of the authenticated caller. It must only be
+// used on routes behind AuthMiddleware.
+func currentUserID(c *gin.Context) uint {
+	return c.MustGet(userIDKey).(uint)
+}
+
+// currentSessionID returns the session family of the caller's access token.
+// It must only be used on routes behind AuthMiddleware.
+func currentSessionID(c *gin.Context) string {
+	return c.GetString(sessionIDKey)
+}
+
+// authorizeUserParam parses the :id route parameter of the /users routes and
+// checks that it refers to the caller. It writes the error response itself
+// and reports whether the handler should continue.
+func authorizeUserParam(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return 0, false
+	}
+	if uint(id) != currentUserID(c) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// findOwned loads the record named by the :id route parameter into dest and
+// checks that it belongs to the caller. It writes the error response itself
+// and reports whether the handler should continue.
+func findOwned(c *gin.Context, dest owned, notFound string) bool {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return false
+	}
+	if err := db.First(dest, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": notFound})
+		return false
+	}
+	if dest.OwnerID() != currentUserID(c) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+		return false
+	}
+	return true
+}
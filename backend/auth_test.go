@@ -0,0 +1,78 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuthMiddleware(t *testing.T) {
+	setupTestDB()
+	gin.SetMode(gin.TestMode)
+	jwtKey = []byte("test-secret")
+	r := gin.New()
+	r.GET("/me", AuthMiddleware(), func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"userId": currentUserID(c)})
+	})
+
+	send := func(header string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/me", nil)
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	sign := func(method jwt.SigningMethod, key interface{}, claims jwt.MapClaims) string {
+		s, err := jwt.NewWithClaims(method, claims).SignedString(key)
+		assert.NoError(t, err)
+		return s
+	}
+
+	// valid token
+	token := sessionToken(7)
+	w := send("Bearer " + token)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"userId":7}`, w.Body.String())
+
+	// missing or malformed header
+	assert.Equal(t, http.StatusUnauthorized, send("").Code)
+	assert.Equal(t, http.StatusUnauthorized, send(token).Code)
+	assert.Equal(t, http.StatusUnauthorized, send("Bearer not-a-jwt").Code)
+
+	// wrong key
+	wrongKey := sign(jwt.SigningMethodHS256, []byte("other"), jwt.MapClaims{
+		"userId": 7, "exp": time.Now().Add(time.Hour).Unix(),
+	})
+	assert.Equal(t, http.StatusUnauthorized, send("Bearer "+wrongKey).Code)
+
+	// unsigned token
+	none := sign(jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, jwt.MapClaims{
+		"userId": 7, "exp": time.Now().Add(time.Hour).Unix(),
+	})
+	assert.Equal(t, http.StatusUnauthorized, send("Bearer "+none).Code)
+
+	// expired or without expiry
+	expired := sign(jwt.SigningMethodHS256, jwtKey, jwt.MapClaims{
+		"userId": 7, "exp": time.Now().Add(-time.Hour).Unix(),
+	})
+	assert.Equal(t, http.StatusUnauthorized, send("Bearer "+expired).Code)
+	noExp := sign(jwt.SigningMethodHS256, jwtKey, jwt.MapClaims{"userId": 7})
+	assert.Equal(t, http.StatusUnauthorized, send("Bearer "+noExp).Code)
+
+	// no user
+	noUser := sign(jwt.SigningMethodHS256, jwtKey, jwt.MapClaims{
+		"exp": time.Now().Add(time.Hour).Unix(),
+	})
+	assert.Equal(t, http.StatusUnauthorized, send("Bearer "+noUser).Code)
+
+	// signed, but tied to no session or to one that does not exist
+	assert.Equal(t, http.StatusUnauthorized, send("Bearer "+generateJWT("a@a.com", 7, "")).Code)
+	assert.Equal(t, http.StatusUnauthorized, send("Bearer "+generateJWT("a@a.com", 7, "unknown")).Code)
+}
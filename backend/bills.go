@@ -0,0 +1,402 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Bill statuses, as of the user's current day.
+const (
+	billUpcoming = "upcoming"
+	billDue      = "due" // due today
+	billOverdue  = "overdue"
+	billPaid     = "paid"
+)
+
+// Bill is an amount owed by a due date, such as a utility invoice. It is
+// paid in one or more payments; PaidAt is the day the last of them settled
+// it, and stays empty while anything is left to pay.
+type Bill struct {
+	ID          uint          `json:"id" gorm:"primaryKey"`
+	UserID      uint          `json:"user_id" gorm:"not null;index"`
+	Name        string        `json:"name" gorm:"not null"`
+	Amount      Money         `json:"amount"`
+	Currency    string        `json:"currency" gorm:"size:3;not null;default:USD"`
+	CategoryID  *uint         `json:"category_id" gorm:"index"`
+	Category    string        `json:"category"` // name of CategoryID
+	DueDate     Date          `json:"due_date" gorm:"not null;index"`
+	PaidAt      Date          `json:"paid_at"`
+	Payments    []BillPayment `json:"payments"`
+	CreatedAt   time.Time     `json:"created_at"`
+	UpdatedAt   time.Time     `json:"updated_at"`
+	Status      string        `json:"status" gorm:"-"`
+	AmountPaid  Money         `json:"amount_paid" gorm:"-"`
+	AmountOwing Money         `json:"amount_owing" gorm:"-"`
+}
+
+func (b Bill) OwnerID() uint { return b.UserID }
+
+// BillPayment is one payment towards a bill. ExpenseID names the expense
+// booked for it, if one was asked for.
+type BillPayment struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	BillID    uint      `json:"bill_id" gorm:"not null;index"`
+	Amount    Money     `json:"amount"`
+	Date      Date      `json:"date" gorm:"not null"`
+	Note      string    `json:"note"`
+	ExpenseID *uint     `json:"expense_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// paid returns the total of the bill's payments.
+func (b Bill) paid() Money {
+	var sum Money
+	for _, p := range b.Payments {
+		sum += p.Amount
+	}
+	return sum
+}
+
+// settle sets PaidAt from the payments: the date of the latest one once they
+// cover the amount, and empty otherwise.
+func (b *Bill) settle() {
+	b.PaidAt = Date{}
+	if len(b.Payments) == 0 || b.paid() < b.Amount {
+		return
+	}
+	for _, p := range b.Payments {
+		if p.Date.After(b.PaidAt) {
+			b.PaidAt = p.Date
+		}
+	}
+}
+
+// status returns the bill's status on day.
+func (b Bill) status(day Date) string {
+	switch {
+	case !b.PaidAt.IsZero():
+		return billPaid
+	case b.DueDate.Before(day):
+		return billOverdue
+	case b.DueDate == day:
+		return billDue
+	default:
+		return billUpcoming
+	}
+}
+
+// fill sets the computed fields for day.
+func (b *Bill) fill(day Date) {
+	if b.Payments == nil {
+		b.Payments = []BillPayment{}
+	}
+	b.Status = b.status(day)
+	b.AmountPaid = b.paid()
+	b.AmountOwing = b.Amount - b.AmountPaid
+	if b.AmountOwing < 0 {
+		b.AmountOwing = 0
+	}
+}
+
+func (b Bill) validate() error {
+	if strings.TrimSpace(b.Name) == "" {
+		return errors.New("name is required")
+	}
+	if b.Amount <= 0 {
+		return errors.New("amount must be greater than zero")
+	}
+	if b.CategoryID == nil && strings.TrimSpace(b.Category) == "" {
+		return errors.New("category is required")
+	}
+	if b.DueDate.IsZero() {
+		return errors.New("due_date is required")
+	}
+	if !validCurrency(b.Currency) {
+		return errInvalidCurrency
+	}
+	if !b.Amount.fits(b.Currency) {
+		return fractionError("amount", b.Currency)
+	}
+	return nil
+}
+
+// findBill loads the caller's bill named by :id with its payments.
+func findBill(c *gin.Context, bill *Bill) bool {
+	if !findOwned(c, bill, "Bill not found") {
+		return false
+	}
+	if err := db.Preload("Payments", func(tx *gorm.DB) *gorm.DB { return tx.Order("date, id") }).First(bill, bill.ID).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load bill"})
+		return false
+	}
+	return true
+}
+
+func loadBills(query *gorm.DB) ([]Bill, error) {
+	bills := []Bill{}
+	err := query.Preload("Payments", func(tx *gorm.DB) *gorm.DB { return tx.Order("date, id") }).
+		Order("due_date, id").Find(&bills).Error
+	return bills, err
+}
+
+// GetBills lists the caller's bills by due date, optionally only those with
+// the given status.
+func GetBills(c *gin.Context) {
+	userID := currentUserID(c)
+	status := c.Query("status")
+	switch status {
+	case "", billUpcoming, billDue, billOverdue, billPaid:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "status must be upcoming, due, overdue or paid"})
+		return
+	}
+
+	bills, err := loadBills(db.Where("user_id = ?", userID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve bills"})
+		return
+	}
+	day := today(userID)
+	matching := []Bill{}
+	for i := range bills {
+		bills[i].fill(day)
+		if status == "" || bills[i].Status == status {
+			matching = append(matching, bills[i])
+		}
+	}
+	c.JSON(http.StatusOK, matching)
+}
+
+// GetUpcomingBills lists the unpaid bills due within the next days days,
+// 30 unless given, overdue ones first.
+func GetUpcomingBills(c *gin.Context) {
+	userID := currentUserID(c)
+	days := 30
+	if s := c.Query("days"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 || n > 366 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "days must be between 0 and 366"})
+			return
+		}
+		days = n
+	}
+
+	day := today(userID)
+	bills, err := loadBills(db.Where("user_id = ? AND paid_at IS NULL AND due_date <= ?", userID, day.AddDays(days)))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve bills"})
+		return
+	}
+	var owing Money
+	for i := range bills {
+		bills[i].fill(day)
+		owing += bills[i].AmountOwing
+	}
+	c.JSON(http.StatusOK, gin.H{"from": day, "to": day.AddDays(days), "bills": bills, "amount_owing": owing})
+}
+
+func AddBill(c *gin.Context) {
+	var bill Bill
+	if err := c.ShouldBindJSON(&bill); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	bill.ID = 0
+	bill.UserID = currentUserID(c)
+	bill.CreatedAt = time.Time{}
+	bill.Payments, bill.PaidAt = nil, Date{}
+	bill.Currency = currencyFor(bill.UserID, bill.Currency)
+	if err := bill.validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var err error
+	if bill.CategoryID, bill.Category, err = resolveCategory(bill.UserID, kindExpense, bill.CategoryID, bill.Category); err != nil {
+		categoryError(c, err)
+		return
+	}
+	if err := db.Create(&bill).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save bill"})
+		return
+	}
+	bill.fill(today(bill.UserID))
+	c.JSON(http.StatusOK, bill)
+}
+
+// UpdateBill replaces or patches a bill. Payments are managed through their
+// own endpoints and are left as they are.
+func UpdateBill(c *gin.Context) {
+	var bill Bill
+	if !findBill(c, &bill) {
+		return
+	}
+
+	var updated Bill
+	if err := bindUpdate(c, bill, &updated); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	updated.ID, updated.UserID, updated.CreatedAt = bill.ID, bill.UserID, bill.CreatedAt
+	updated.Payments = bill.Payments
+	updated.Currency = currencyFor(updated.UserID, updated.Currency)
+	if renamedOnly(updated.CategoryID, bill.CategoryID, updated.Category, bill.Category) {
+		updated.CategoryID = nil
+	}
+	if err := updated.validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if updated.Currency != bill.Currency && len(bill.Payments) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "currency cannot change once payments are recorded"})
+		return
+	}
+	var err error
+	if updated.CategoryID, updated.Category, err = resolveCategory(updated.UserID, kindExpense, updated.CategoryID, updated.Category); err != nil {
+		categoryError(c, err)
+		return
+	}
+	updated.settle()
+
+	if err := db.Omit("Payments").Save(&updated).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update bill"})
+		return
+	}
+	updated.fill(today(updated.UserID))
+	c.JSON(http.StatusOK, updated)
+}
+
+// DeleteBill deletes a bill and its payment history. Expenses booked for
+// the payments are kept.
+func DeleteBill(c *gin.Context) {
+	var bill Bill
+	if !findOwned(c, &bill, "Bill not found") {
+		return
+	}
+	if err := db.Select("Payments").Delete(&bill).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete bill"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Bill deleted"})
+}
+
+// AddBillPayment records a payment towards a bill. Without an amount it
+// pays whatever is left, marking the bill paid. With create_expense set it
+// also books the payment as a paid expense in the bill's category.
+func AddBillPayment(c *gin.Context) {
+	var bill Bill
+	if !findBill(c, &bill) {
+		return
+	}
+	var input struct {
+		Amount        Money  `json:"amount"`
+		Date          Date   `json:"date"`
+		Note          string `json:"note"`
+		CreateExpense bool   `json:"create_expense"`
+		AccountID     *uint  `json:"account_id"` // for the expense
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	owing := bill.Amount - bill.paid()
+	if owing <= 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Bill is already paid"})
+		return
+	}
+	if input.Amount == 0 {
+		input.Amount = owing
+	}
+	if input.Amount < 0 || input.Amount > owing {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "amount must be greater than zero and at most " + owing.Format(bill.Currency)})
+		return
+	}
+	if !input.Amount.fits(bill.Currency) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fractionError("amount", bill.Currency).Error()})
+		return
+	}
+	if input.Date.IsZero() {
+		input.Date = today(bill.UserID)
+	}
+	if input.CreateExpense {
+		if err := checkAccount(bill.UserID, input.AccountID, bill.Currency); err != nil {
+			accountError(c, err)
+			return
+		}
+	}
+
+	payment := BillPayment{BillID: bill.ID, Amount: input.Amount, Date: input.Date, Note: input.Note}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if input.CreateExpense {
+			expense := Expense{UserID: bill.UserID, Amount: payment.Amount, Currency: bill.Currency, AccountID: input.AccountID, CategoryID: bill.CategoryID,
+				Category: bill.Category, Description: bill.Name, Date: payment.Date, Paid: true}
+			if err := tx.Create(&expense).Error; err != nil {
+				return err
+			}
+			payment.ExpenseID = &expense.ID
+		}
+		if err := tx.Create(&payment).Error; err != nil {
+			return err
+		}
+		bill.Payments = append(bill.Payments, payment)
+		bill.settle()
+		return tx.Model(&bill).Update("paid_at", bill.PaidAt).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record payment"})
+		return
+	}
+	bill.fill(today(bill.UserID))
+	c.JSON(http.StatusOK, bill)
+}
+
+// DeleteBillPayment undoes a payment, along with the expense booked for it.
+func DeleteBillPayment(c *gin.Context) {
+	var bill Bill
+	if !findBill(c, &bill) {
+		return
+	}
+	id, err := strconv.ParseUint(c.Param("paymentId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+	i := 0
+	for i < len(bill.Payments) && uint64(bill.Payments[i].ID) != id {
+		i++
+	}
+	if i == len(bill.Payments) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Payment not found"})
+		return
+	}
+	payment := bill.Payments[i]
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if payment.ExpenseID != nil {
+			var expense Expense
+			if err := tx.Where("id = ? AND user_id = ?", *payment.ExpenseID, bill.UserID).First(&expense).Error; err == nil {
+				if err := tx.Select("Tags", "Splits").Delete(&expense).Error; err != nil {
+					return err
+				}
+			}
+		}
+		if err := tx.Delete(&payment).Error; err != nil {
+			return err
+		}
+		bill.Payments = append(bill.Payments[:i:i], bill.Payments[i+1:]...)
+		bill.settle()
+		return tx.Model(&bill).Update("paid_at", bill.PaidAt).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete payment"})
+		return
+	}
+	bill.fill(today(bill.UserID))
+	c.JSON(http.StatusOK, bill)
+}
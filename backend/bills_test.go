@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBillStatus(t *testing.T) {
+	day := mustDate("2025-04-15")
+	bill := Bill{Amount: 10000, DueDate: day}
+	assert.Equal(t, billDue, bill.status(day))
+	assert.Equal(t, billOverdue, bill.status(day.AddDays(1)))
+	assert.Equal(t, billUpcoming, bill.status(day.AddDays(-1)))
+
+	bill.Payments = []BillPayment{{Amount: 4000, Date: mustDate("2025-04-10")}}
+	bill.settle()
+	assert.True(t, bill.PaidAt.IsZero())
+	bill.Payments = append(bill.Payments, BillPayment{Amount: 6000, Date: mustDate("2025-04-18")})
+	bill.settle()
+	assert.Equal(t, mustDate("2025-04-18"), bill.PaidAt)
+	assert.Equal(t, billPaid, bill.status(day.AddDays(30)))
+}
+
+func TestBillEndpoints(t *testing.T) {
+	setupTestDB()
+	r := setupRouter()
+	db.Create(&User{FullName: "A", Username: "a", Email: "a@x.com", Password: "p", BaseCurrency: "USD"})
+	day := today(1)
+
+	for _, body := range []string{
+		`{"amount":10,"category":"Utilities","due_date":"2025-04-15"}`,
+		`{"name":"Power","amount":0,"category":"Utilities","due_date":"2025-04-15"}`,
+		`{"name":"Power","amount":10,"due_date":"2025-04-15"}`,
+		`{"name":"Power","amount":10,"category":"Utilities"}`,
+	} {
+		assert.Equal(t, http.StatusBadRequest, sendJSON(r, "POST", "/bills", body, 1).Code, body)
+	}
+
+	add := func(name, amount string, due Date) Bill {
+		w := sendJSON(r, "POST", "/bills", `{"name":"`+name+`","amount":"`+amount+`","category":"Utilities","due_date":"`+due.String()+`"}`, 1)
+		assert.Equal(t, http.StatusOK, w.Code)
+		var b Bill
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &b))
+		return b
+	}
+	power := add("Power", "80.00", day.AddDays(-3))
+	water := add("Water", "40.00", day)
+	phone := add("Phone", "25.00", day.AddDays(10))
+	add("Insurance", "300.00", day.AddDays(60))
+	assert.Equal(t, billOverdue, power.Status)
+	assert.Equal(t, billDue, water.Status)
+	assert.Equal(t, billUpcoming, phone.Status)
+	assert.Equal(t, Money(2500), phone.AmountOwing)
+
+	var upcoming struct {
+		Bills       []Bill `json:"bills"`
+		AmountOwing Money  `json:"amount_owing"`
+	}
+	assert.Equal(t, http.StatusOK, getJSON(r, "/bills/upcoming?days=14", 1, &upcoming))
+	assert.Len(t, upcoming.Bills, 3)
+	assert.Equal(t, Money(14500), upcoming.AmountOwing)
+	assert.Equal(t, http.StatusBadRequest, getJSON(r, "/bills/upcoming?days=-1", 1, &upcoming))
+
+	// a partial payment, then the rest with a matching expense
+	w := sendJSON(r, "POST", "/bills/1/payments", `{"amount":30,"note":"first half"}`, 1)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &power))
+	assert.Equal(t, billOverdue, power.Status)
+	assert.Equal(t, Money(5000), power.AmountOwing)
+	assert.Equal(t, http.StatusBadRequest, sendJSON(r, "POST", "/bills/1/payments", `{"amount":60}`, 1).Code)
+
+	w = sendJSON(r, "POST", "/bills/1/payments", `{"create_expense":true}`, 1)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &power))
+	assert.Equal(t, billPaid, power.Status)
+	assert.Equal(t, day, power.PaidAt)
+	if assert.Len(t, power.Payments, 2) && assert.NotNil(t, power.Payments[1].ExpenseID) {
+		var expense Expense
+		db.First(&expense, *power.Payments[1].ExpenseID)
+		assert.Equal(t, Money(5000), expense.Amount)
+		assert.Equal(t, "Power", expense.Description)
+		assert.Equal(t, "Utilities", expense.Category)
+		assert.True(t, expense.Paid)
+	}
+	assert.Equal(t, http.StatusConflict, sendJSON(r, "POST", "/bills/1/payments", `{}`, 1).Code)
+
+	var paid []Bill
+	assert.Equal(t, http.StatusOK, getJSON(r, "/bills?status=paid", 1, &paid))
+	assert.Len(t, paid, 1)
+	assert.Equal(t, http.StatusBadRequest, getJSON(r, "/bills?status=late", 1, &paid))
+
+	// raising the amount reopens the bill
+	w = sendJSON(r, "PATCH", "/bills/1", `{"amount":"90.00"}`, 1)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &power))
+	assert.Equal(t, billOverdue, power.Status)
+	assert.Len(t, power.Payments, 2)
+
+	// undoing a payment removes its expense too
+	assert.Equal(t, http.StatusNotFound, sendJSON(r, "DELETE", "/bills/1/payments/99", "", 1).Code)
+	w = sendJSON(r, "DELETE", "/bills/1/payments/2", "", 1)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &power))
+	assert.Equal(t, Money(6000), power.AmountOwing)
+	var count int64
+	db.Model(&Expense{}).Count(&count)
+	assert.Zero(t, count)
+
+	assert.Equal(t, http.StatusForbidden, sendJSON(r, "DELETE", "/bills/1", "", 2).Code)
+	assert.Equal(t, http.StatusOK, sendJSON(r, "DELETE", "/bills/1", "", 1).Code)
+	db.Model(&BillPayment{}).Count(&count)
+	assert.Zero(t, count)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"math"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// BudgetProgress compares a budget with what has been spent in its window,
+// in the budget's currency.
+type BudgetProgress struct {
+	Currency    string  `json:"currency"`
+	Spent       Money   `json:"spent"`
+	Remaining   Money   `json:"remaining"` // negative once over budget
+	PercentUsed float64 `json:"percent_used"`
+	// Projected extrapolates the spending rate so far to the whole window.
+	Projected Money `json:"projected"`
+	// DaysLeft counts the days of the window after today.
+	DaysLeft int `json:"days_left"`
+}
+
+// progress measures b against the owner's expenses dated within the budget
+// window, as of the given day. Split expenses count line by line.
+func (b Budget) progress(day Date) (BudgetProgress, error) {
+	query := expenseLines().Where("user_id = ?", b.UserID)
+	query = inDateRange(query, b.StartDate, b.EndDate)
+	if len(b.Categories) > 0 {
+		query = query.Where("category IN ?", b.Categories)
+	}
+	spent, err := sumConverted(query, newConverter(db, b.Currency))
+	if err != nil {
+		return BudgetProgress{}, err
+	}
+
+	p := BudgetProgress{
+		Currency:  b.Currency,
+		Spent:     spent,
+		Remaining: b.BudgetAmount - spent,
+		Projected: spent,
+	}
+	if b.BudgetAmount > 0 {
+		p.PercentUsed = percent(spent, b.BudgetAmount)
+	}
+
+	total := b.StartDate.DaysUntil(b.EndDate) + 1
+	switch {
+	case day.Before(b.StartDate):
+		p.DaysLeft = total
+	case !day.After(b.EndDate):
+		elapsed := b.StartDate.DaysUntil(day) + 1
+		p.DaysLeft = total - elapsed
+		p.Projected = Money(math.Round(float64(spent) * float64(total) / float64(elapsed)))
+	}
+	return p, nil
+}
+
+func GetBudgetProgress(c *gin.Context) {
+	var budget Budget
+	if !findOwned(c, &budget, "Budget not found") {
+		return
+	}
+	progress, err := budget.progress(today(budget.UserID))
+	if err != nil {
+		reportError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, progress)
+}
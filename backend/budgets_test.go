@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBudgetProgress(t *testing.T) {
+	setupTestDB()
+	budget := Budget{UserID: 1, BudgetName: "April", BudgetAmount: 30000, Currency: "USD", StartDate: mustDate("2025-04-01"), EndDate: mustDate("2025-04-30")}
+	db.Create(&budget)
+	db.Create(&[]Expense{
+		{UserID: 1, Amount: 5000, Category: "Food", Date: mustDate("2025-04-02")},
+		{UserID: 1, Amount: 7000, Category: "Fun", Date: mustDate("2025-04-10")},
+		{UserID: 1, Amount: 9900, Category: "Food", Date: mustDate("2025-03-31")}, // before the window
+		{UserID: 1, Amount: 9900, Category: "Food", Date: mustDate("2025-05-01")}, // after it
+		{UserID: 2, Amount: 9900, Category: "Food", Date: mustDate("2025-04-05")}, // someone else's
+	})
+
+	// ten days in: 120.00 of 300.00 spent, on course for 360.00
+	p, err := budget.progress(mustDate("2025-04-10"))
+	assert.NoError(t, err)
+	assert.Equal(t, BudgetProgress{Currency: "USD", Spent: 12000, Remaining: 18000, PercentUsed: 40, Projected: 36000, DaysLeft: 20}, p)
+
+	// before the window nothing is projected beyond what was spent
+	p, err = budget.progress(mustDate("2025-03-15"))
+	assert.NoError(t, err)
+	assert.Equal(t, 30, p.DaysLeft)
+	assert.Equal(t, Money(12000), p.Projected)
+
+	// after it the projection is what was spent
+	p, err = budget.progress(mustDate("2025-06-01"))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, p.DaysLeft)
+	assert.Equal(t, Money(12000), p.Projected)
+
+	// limited to some categories, and over budget
+	budget.Categories = []string{"Food"}
+	budget.BudgetAmount = 4000
+	p, err = budget.progress(mustDate("2025-04-30"))
+	assert.NoError(t, err)
+	assert.Equal(t, Money(5000), p.Spent)
+	assert.Equal(t, Money(-1000), p.Remaining)
+	assert.Equal(t, 125.0, p.PercentUsed)
+	assert.Equal(t, 0, p.DaysLeft)
+}
+
+func TestBudgetProgressEndpoints(t *testing.T) {
+	setupTestDB()
+	r := setupRouter()
+	db.Create(&Budget{UserID: 1, BudgetName: "Food", BudgetAmount: 10000, Currency: "USD", StartDate: mustDate("2025-04-01"), EndDate: mustDate("2025-04-30"), Categories: []string{"Food"}})
+	db.Create(&[]Expense{
+		{UserID: 1, Amount: 2500, Category: "Food", Date: mustDate("2025-04-02")},
+		{UserID: 1, Amount: 2500, Category: "Rent", Date: mustDate("2025-04-02")},
+	})
+
+	get := func(path string, userID uint) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, withAuth(httptest.NewRequest("GET", path, nil), userID))
+		return w
+	}
+
+	w := get("/budget/1/progress", 1)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var p BudgetProgress
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &p))
+	assert.Equal(t, Money(2500), p.Spent)
+	assert.Equal(t, 25.0, p.PercentUsed)
+
+	assert.Equal(t, http.StatusForbidden, get("/budget/1/progress", 2).Code)
+	assert.Equal(t, http.StatusNotFound, get("/budget/9/progress", 1).Code)
+
+	// the budget list carries the same progress
+	w = get("/budget", 1)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var budgets []Budget
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &budgets))
+	assert.Len(t, budgets, 1)
+	assert.Equal(t, []string{"Food"}, budgets[0].Categories)
+	assert.Equal(t, &p, budgets[0].Progress)
+}
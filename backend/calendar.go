@@ -0,0 +1,246 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// calendarPastDays is how far back the calendar feed reaches; bills,
+// unpaid expenses and budgets that ended before then are left out.
+const calendarPastDays = 90
+
+// CalendarFeed is a user's secret calendar URL. It is a capability of its
+// own, separate from logins: anyone with the URL can read the feed until it
+// is revoked or replaced. Only the token's hash is kept.
+type CalendarFeed struct {
+	ID         uint       `json:"-" gorm:"primaryKey"`
+	UserID     uint       `json:"-" gorm:"uniqueIndex;not null"`
+	TokenHash  string     `json:"-" gorm:"uniqueIndex;not null"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+}
+
+// calendarEvent is an all-day VEVENT lasting from start to end inclusive.
+type calendarEvent struct {
+	uid         string
+	start, end  Date
+	summary     string
+	description string
+	stamp       time.Time
+}
+
+// icsText escapes text for a property value. Invalid UTF-8, which imports
+// can let through, becomes U+FFFD since the feed must be UTF-8.
+func icsText(s string) string {
+	s = strings.ToValidUTF8(s, "\uFFFD")
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`, "\r", `\n`).Replace(s)
+}
+
+func icsDate(d Date) string {
+	return strings.ReplaceAll(d.String(), "-", "")
+}
+
+// icsWriter writes content lines with CRLF endings, folding them at 75
+// octets without splitting a character. Like archiveWriter it keeps the
+// first error.
+type icsWriter struct {
+	w   *bufio.Writer
+	err error
+}
+
+func (iw *icsWriter) line(s string) {
+	if iw.err != nil {
+		return
+	}
+	for limit := 75; len(s) > limit; limit = 74 {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+		if cut == 0 {
+			// no character starts nearby, so s is not UTF-8
+			cut = limit
+		}
+		iw.w.WriteString(s[:cut])
+		iw.w.WriteString("\r\n ")
+		s = s[cut:]
+	}
+	iw.w.WriteString(s)
+	_, iw.err = iw.w.WriteString("\r\n")
+}
+
+func (iw *icsWriter) event(e calendarEvent) {
+	iw.line("BEGIN:VEVENT")
+	iw.line("UID:" + e.uid)
+	iw.line("DTSTAMP:" + e.stamp.UTC().Format("20060102T150405Z"))
+	iw.line("DTSTART;VALUE=DATE:" + icsDate(e.start))
+	iw.line("DTEND;VALUE=DATE:" + icsDate(e.end.AddDays(1)))
+	iw.line("SUMMARY:" + icsText(e.summary))
+	if e.description != "" {
+		iw.line("DESCRIPTION:" + icsText(e.description))
+	}
+	iw.line("TRANSP:TRANSPARENT")
+	iw.line("END:VEVENT")
+}
+
+// calendarEvents returns the user's unpaid bills and expenses and their
+// budget periods from since on, each kind in date order.
+func calendarEvents(userID uint, since Date) ([]calendarEvent, error) {
+	var events []calendarEvent
+
+	var bills []Bill
+	if err := db.Preload("Payments").Where("user_id = ? AND paid_at IS NULL AND due_date >= ?", userID, since).
+		Order("due_date, id").Find(&bills).Error; err != nil {
+		return nil, err
+	}
+	for _, b := range bills {
+		owing := b.Amount - b.paid()
+		desc := fmt.Sprintf("Amount: %s %s", b.Amount.Format(b.Currency), b.Currency)
+		if owing != b.Amount {
+			desc += fmt.Sprintf("\nStill owing: %s %s", owing.Format(b.Currency), b.Currency)
+		}
+		events = append(events, calendarEvent{uid: fmt.Sprintf("bill-%d@fintrack", b.ID), start: b.DueDate, end: b.DueDate,
+			summary: fmt.Sprintf("Bill due: %s (%s %s)", b.Name, owing.Format(b.Currency), b.Currency), description: desc, stamp: b.UpdatedAt})
+	}
+
+	var expenses []Expense
+	if err := db.Where("user_id = ? AND paid = ? AND date >= ?", userID, false, since).
+		Order("date, id").Find(&expenses).Error; err != nil {
+		return nil, err
+	}
+	for _, e := range expenses {
+		name := e.Description
+		if name == "" {
+			name = e.Category
+		}
+		events = append(events, calendarEvent{uid: fmt.Sprintf("expense-%d@fintrack", e.ID), start: e.Date, end: e.Date,
+			summary: fmt.Sprintf("Unpaid: %s (%s %s)", name, e.Amount.Format(e.Currency), e.Currency), description: "Category: " + e.Category, stamp: e.UpdatedAt})
+	}
+
+	var budgets []Budget
+	if err := db.Where("user_id = ? AND start_date IS NOT NULL", userID).
+		Where("end_date >= ? OR (end_date IS NULL AND start_date >= ?)", since, since).
+		Order("start_date, id").Find(&budgets).Error; err != nil {
+		return nil, err
+	}
+	for _, b := range budgets {
+		end := b.EndDate
+		if end.IsZero() || end.Before(b.StartDate) {
+			end = b.StartDate
+		}
+		desc := b.Notes
+		if len(b.Categories) > 0 {
+			desc = strings.TrimSpace("Categories: " + strings.Join(b.Categories, ", ") + "\n" + desc)
+		}
+		events = append(events, calendarEvent{uid: fmt.Sprintf("budget-%d@fintrack", b.ID), start: b.StartDate, end: end,
+			summary: fmt.Sprintf("Budget: %s (%s %s)", b.BudgetName, b.BudgetAmount.Format(b.Currency), b.Currency), description: desc, stamp: b.UpdatedAt})
+	}
+	return events, nil
+}
+
+// writeCalendar writes events as an RFC 5545 calendar.
+func writeCalendar(w io.Writer, events []calendarEvent) error {
+	iw := &icsWriter{w: bufio.NewWriter(w)}
+	iw.line("BEGIN:VCALENDAR")
+	iw.line("VERSION:2.0")
+	iw.line("PRODID:-//FinTrack//Bills and budgets//EN")
+	iw.line("CALSCALE:GREGORIAN")
+	iw.line("METHOD:PUBLISH")
+	iw.line("X-WR-CALNAME:FinTrack")
+	for _, e := range events {
+		iw.event(e)
+	}
+	iw.line("END:VCALENDAR")
+	if iw.err != nil {
+		return iw.err
+	}
+	return iw.w.Flush()
+}
+
+// calendarFeedURL returns the feed URL for token on the host the request
+// was made to.
+func calendarFeedURL(c *gin.Context, token string) string {
+	scheme := "http"
+	if c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + c.Request.Host + "/ical/" + token + ".ics"
+}
+
+// GetCalendarFeed reports whether the user has a calendar feed and when it
+// was made and last read.
+func GetCalendarFeed(c *gin.Context) {
+	var feed CalendarFeed
+	if err := db.Where("user_id = ?", currentUserID(c)).First(&feed).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No calendar feed"})
+		return
+	}
+	c.JSON(http.StatusOK, feed)
+}
+
+// CreateCalendarFeed issues a new secret feed URL, replacing any earlier
+// one. The URL is only shown in this response.
+func CreateCalendarFeed(c *gin.Context) {
+	userID := currentUserID(c)
+	token := randomToken(32)
+	feed := CalendarFeed{UserID: userID, TokenHash: hashToken(token)}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&CalendarFeed{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&feed).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create calendar feed"})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"url": calendarFeedURL(c, token), "created_at": feed.CreatedAt})
+}
+
+// RevokeCalendarFeed turns the user's feed URL off.
+func RevokeCalendarFeed(c *gin.Context) {
+	res := db.Where("user_id = ?", currentUserID(c)).Delete(&CalendarFeed{})
+	if res.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke calendar feed"})
+		return
+	}
+	if res.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No calendar feed"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Calendar feed revoked"})
+}
+
+// ServeCalendarFeed serves GET /ical/<token>.ics, which calendar apps
+// subscribe to without logging in: the token in the URL is the only
+// credential.
+func ServeCalendarFeed(c *gin.Context) {
+	token, ok := strings.CutSuffix(c.Param("file"), ".ics")
+	var feed CalendarFeed
+	if !ok || token == "" || db.Where("token_hash = ?", hashToken(token)).First(&feed).Error != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Calendar feed not found"})
+		return
+	}
+	events, err := calendarEvents(feed.UserID, today(feed.UserID).AddDays(-calendarPastDays))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build calendar"})
+		return
+	}
+	db.Model(&feed).Update("last_used_at", time.Now())
+
+	c.Header("Content-Type", "text/calendar; charset=utf-8")
+	c.Header("Content-Disposition", `inline; filename="fintrack.ics"`)
+	c.Status(http.StatusOK)
+	if err := writeCalendar(c.Writer, events); err != nil {
+		log.Printf("calendar feed for user %d failed: %v", feed.UserID, err)
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestICSWriterFolds(t *testing.T) {
+	var b bytes.Buffer
+	iw := &icsWriter{w: bufio.NewWriter(&b)}
+	long := "SUMMARY:" + strings.Repeat("Überweisung ", 20)
+	iw.line(long)
+	iw.w.Flush()
+	lines := strings.Split(strings.TrimSuffix(b.String(), "\r\n"), "\r\n")
+	assert.Greater(t, len(lines), 1)
+	var joined string
+	for i, l := range lines {
+		assert.LessOrEqual(t, len(l), 75)
+		assert.True(t, utf8.ValidString(l), l)
+		if i > 0 {
+			assert.True(t, strings.HasPrefix(l, " "))
+			l = l[1:]
+		}
+		joined += l
+	}
+	assert.Equal(t, long, joined)
+
+	assert.Equal(t, `Rent\, flat 2\; March\nPaid by card \\ cash`, icsText("Rent, flat 2; March\nPaid by card \\ cash"))
+
+	// bytes that are not UTF-8 are replaced, and folded without hanging
+	assert.Equal(t, "Caf\uFFFD", icsText("Caf\xe9"))
+	b.Reset()
+	iw.line(strings.Repeat("\x80", 100))
+	iw.w.Flush()
+	assert.Equal(t, strings.Repeat("\x80", 75)+"\r\n "+strings.Repeat("\x80", 25)+"\r\n", b.String())
+}
+
+// feedPath returns the path of a feed URL returned by POST /calendar/feed.
+func feedPath(t *testing.T, w *httptest.ResponseRecorder) string {
+	var resp struct {
+		URL string `json:"url"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	u, err := url.Parse(resp.URL)
+	assert.NoError(t, err)
+	return u.Path
+}
+
+func getFeed(r http.Handler, path string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+	return w
+}
+
+func TestCalendarFeed(t *testing.T) {
+	setupTestDB()
+	r := setupRouter()
+	db.Create(&User{FullName: "A", Username: "a", Email: "a@x.com", Password: "p"})
+	day := today(1)
+	db.Create(&Bill{UserID: 1, Name: "Electricity", Amount: 4590, Currency: "EUR", DueDate: day.AddDays(5),
+		Payments: []BillPayment{{Amount: 1000, Date: day}}})
+	db.Create(&Bill{UserID: 1, Name: "Water", Amount: 2000, Currency: "EUR", DueDate: day.AddDays(3), PaidAt: day})
+	db.Create(&Expense{UserID: 1, Amount: 1200, Currency: "EUR", Category: "Fees", Description: "Bank fee", Date: day.AddDays(-2)})
+	db.Create(&Expense{UserID: 1, Amount: 999, Currency: "EUR", Category: "Food", Description: "Lunch", Date: day, Paid: true})
+	db.Create(&Expense{UserID: 1, Amount: 500, Currency: "EUR", Category: "Old", Date: day.AddDays(-calendarPastDays - 1)})
+	db.Create(&Budget{UserID: 1, BudgetName: "Holiday", BudgetAmount: 80000, Currency: "EUR", StartDate: day, EndDate: day.AddDays(13)})
+	db.Create(&Expense{UserID: 2, Amount: 100, Currency: "EUR", Category: "Other", Description: "Not mine", Date: day})
+
+	assert.Equal(t, http.StatusNotFound, sendJSON(r, "GET", "/calendar/feed", "", 1).Code)
+	w := sendJSON(r, "POST", "/calendar/feed", "", 1)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	path := feedPath(t, w)
+	assert.True(t, strings.HasPrefix(path, "/ical/") && strings.HasSuffix(path, ".ics"), path)
+
+	// the feed is served without a login
+	w = getFeed(r, path)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/calendar; charset=utf-8", w.Header().Get("Content-Type"))
+	body := w.Body.String()
+	assert.True(t, strings.HasPrefix(body, "BEGIN:VCALENDAR\r\nVERSION:2.0\r\n"), body)
+	assert.True(t, strings.HasSuffix(body, "END:VCALENDAR\r\n"))
+	assert.Equal(t, 3, strings.Count(body, "BEGIN:VEVENT"))
+	assert.Contains(t, body, "UID:bill-1@fintrack\r\n")
+	assert.Contains(t, body, "DTSTART;VALUE=DATE:"+icsDate(day.AddDays(5))+"\r\nDTEND;VALUE=DATE:"+icsDate(day.AddDays(6))+"\r\n")
+	assert.Contains(t, body, "SUMMARY:Bill due: Electricity (35.90 EUR)\r\n")
+	assert.Contains(t, body, "SUMMARY:Unpaid: Bank fee (12.00 EUR)\r\n")
+	assert.Contains(t, body, "DTSTART;VALUE=DATE:"+icsDate(day)+"\r\nDTEND;VALUE=DATE:"+icsDate(day.AddDays(14))+"\r\n")
+	assert.Contains(t, body, "SUMMARY:Budget: Holiday (800.00 EUR)\r\n")
+	for _, absent := range []string{"Water", "Lunch", "Old", "Not mine"} {
+		assert.NotContains(t, body, absent)
+	}
+
+	var feed CalendarFeed
+	assert.Equal(t, http.StatusOK, getJSON(r, "/calendar/feed", 1, &feed))
+	assert.NotNil(t, feed.LastUsedAt)
+
+	// a new URL replaces the old one, and a revoked one stops working
+	w = sendJSON(r, "POST", "/calendar/feed", "", 1)
+	newPath := feedPath(t, w)
+	assert.NotEqual(t, path, newPath)
+	assert.Equal(t, http.StatusNotFound, getFeed(r, path).Code)
+	assert.Equal(t, http.StatusOK, getFeed(r, newPath).Code)
+	assert.Equal(t, http.StatusOK, sendJSON(r, "DELETE", "/calendar/feed", "", 1).Code)
+	assert.Equal(t, http.StatusNotFound, getFeed(r, newPath).Code)
+	assert.Equal(t, http.StatusNotFound, sendJSON(r, "DELETE", "/calendar/feed", "", 1).Code)
+
+	assert.Equal(t, http.StatusNotFound, getFeed(r, "/ical/guess.ics").Code)
+	assert.Equal(t, http.StatusUnauthorized, getFeed(r, "/calendar/feed").Code)
+}
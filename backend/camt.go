@@ -0,0 +1,203 @@
+package main
+
+import (
+	"encoding/xml"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// camtDocument is the part of an ISO 20022 camt.053 bank-to-customer
+// statement that imports read. Element names are matched without their
+// namespace, so every version of the message is accepted.
+type camtDocument struct {
+	Statements []camtStatement `xml:"BkToCstmrStmt>Stmt"`
+}
+
+type camtStatement struct {
+	IBAN     string        `xml:"Acct>Id>IBAN"`
+	OtherID  string        `xml:"Acct>Id>Othr>Id"`
+	Currency string        `xml:"Acct>Ccy"`
+	Balances []camtBalance `xml:"Bal"`
+	Entries  []camtEntry   `xml:"Ntry"`
+}
+
+type camtAmount struct {
+	Value    string `xml:",chardata"`
+	Currency string `xml:"Ccy,attr"`
+}
+
+type camtDate struct {
+	Date     string `xml:"Dt"`
+	DateTime string `xml:"DtTm"`
+}
+
+// date reads whichever of the date and the date and time is given.
+func (d camtDate) date() (Date, error) {
+	s := d.Date
+	if s == "" && len(d.DateTime) >= 10 {
+		s = d.DateTime[:10]
+	}
+	return ParseDate(s)
+}
+
+type camtBalance struct {
+	Type      string     `xml:"Tp>CdOrPrtry>Cd"`
+	Amount    camtAmount `xml:"Amt"`
+	Indicator string     `xml:"CdtDbtInd"`
+	Date      camtDate   `xml:"Dt"`
+}
+
+// camtStatus is an entry's status, which versions before 9 give as text
+// and later ones as a code.
+type camtStatus struct {
+	Text string `xml:",chardata"`
+	Code string `xml:"Cd"`
+}
+
+type camtEntry struct {
+	Amount      camtAmount    `xml:"Amt"`
+	Indicator   string        `xml:"CdtDbtInd"`
+	Status      camtStatus    `xml:"Sts"`
+	BookingDate camtDate      `xml:"BookgDt"`
+	ValueDate   camtDate      `xml:"ValDt"`
+	ServicerRef string        `xml:"AcctSvcrRef"`
+	Details     []camtDetails `xml:"NtryDtls>TxDtls"`
+	Info        string        `xml:"AddtlNtryInf"`
+}
+
+type camtDetails struct {
+	ServicerRef   string   `xml:"Refs>AcctSvcrRef"`
+	EndToEndID    string   `xml:"Refs>EndToEndId"`
+	Creditor      string   `xml:"RltdPties>Cdtr>Nm"`
+	CreditorParty string   `xml:"RltdPties>Cdtr>Pty>Nm"`
+	Debtor        string   `xml:"RltdPties>Dbtr>Nm"`
+	DebtorParty   string   `xml:"RltdPties>Dbtr>Pty>Nm"`
+	Unstructured  []string `xml:"RmtInf>Ustrd"`
+}
+
+// signed returns amount, negated for a debit.
+func signed(amount Money, indicator string) Money {
+	if strings.TrimSpace(indicator) == "DBIT" {
+		return -amount
+	}
+	return amount
+}
+
+// transaction reads a booked entry. Its id is the account servicer's
+// reference, or the end-to-end id of its only payment.
+func (e camtEntry) transaction(currency string) statementTransaction {
+	var t statementTransaction
+	var err error
+	if t.Date, err = e.BookingDate.date(); err != nil {
+		if t.Date, err = e.ValueDate.date(); err != nil {
+			t.Errors = append(t.Errors, "booking date is missing or invalid")
+		}
+	}
+	amount, err := parseStatementAmount(e.Amount.Value, ".")
+	if err != nil {
+		t.Errors = append(t.Errors, "amount is not valid")
+	}
+	t.Amount = signed(amount, e.Indicator)
+	if c := strings.ToUpper(e.Amount.Currency); c != "" && c != currency {
+		t.Errors = append(t.Errors, "amount is in "+c+", not the statement's "+currency)
+	}
+
+	t.ID = strings.TrimSpace(e.ServicerRef)
+	if len(e.Details) == 1 {
+		d := e.Details[0]
+		if t.ID == "" {
+			t.ID = strings.TrimSpace(d.ServicerRef)
+		}
+		if id := strings.TrimSpace(d.EndToEndID); t.ID == "" && id != "NOTPROVIDED" {
+			t.ID = id
+		}
+	}
+	if len(e.Details) > 0 {
+		d := e.Details[0]
+		// The counterparty is the creditor of money paid out and the
+		// debtor of money received.
+		if t.Amount < 0 {
+			t.Name = d.Creditor + d.CreditorParty
+		} else {
+			t.Name = d.Debtor + d.DebtorParty
+		}
+		t.Memo = strings.Join(d.Unstructured, " ")
+	}
+	if t.Memo == "" {
+		t.Memo = e.Info
+	}
+	return t
+}
+
+// parseCAMT053 reads the statements in a camt.053 file. Only booked
+// entries are read; pending ones may still change.
+func parseCAMT053(data string) ([]bankStatement, error) {
+	var doc camtDocument
+	if err := xml.Unmarshal([]byte(data), &doc); err != nil || len(doc.Statements) == 0 {
+		return nil, errors.New("file is not a camt.053 statement")
+	}
+	statements := make([]bankStatement, 0, len(doc.Statements))
+	for _, s := range doc.Statements {
+		st := bankStatement{Account: s.IBAN, Currency: strings.ToUpper(s.Currency)}
+		if st.Account == "" {
+			st.Account = s.OtherID
+		}
+		for _, bal := range s.Balances {
+			if st.Currency == "" {
+				st.Currency = strings.ToUpper(bal.Amount.Currency)
+			}
+			if bal.Type != "CLBD" {
+				continue
+			}
+			amount, err := parseStatementAmount(bal.Amount.Value, ".")
+			if err != nil {
+				return nil, errors.New("closing balance is not valid")
+			}
+			date, err := bal.Date.date()
+			if err != nil {
+				return nil, errors.New("closing balance has no valid date")
+			}
+			amount = signed(amount, bal.Indicator)
+			st.LedgerBalance, st.BalanceDate = &amount, date
+		}
+		for _, e := range s.Entries {
+			if st.Currency == "" {
+				st.Currency = strings.ToUpper(e.Amount.Currency)
+			}
+			status := e.Status.Code
+			if status == "" {
+				status = strings.TrimSpace(e.Status.Text)
+			}
+			if status == "" || status == "BOOK" {
+				st.Transactions = append(st.Transactions, e.transaction(st.Currency))
+			}
+		}
+		statements = append(statements, st)
+	}
+	return statements, nil
+}
+
+// ImportCAMT053 reads an ISO 20022 camt.053 statement uploaded as the
+// multipart field file. The optional field settings holds account_id and
+// default_category as JSON; the currency is the statement's. Transactions
+// are recognised by the bank's reference, or by their date, amount and
+// text when there is none.
+func ImportCAMT053(c *gin.Context) {
+	var settings importSettings
+	if !bindImportSettings(c, &settings) {
+		return
+	}
+	data, ok := readImportFile(c, maxImportFileSize)
+	if !ok {
+		return
+	}
+	statements, err := parseCAMT053(data)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	importStatements(c, "camt053", settings, statements)
+}
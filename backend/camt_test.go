@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCAMT053(t *testing.T) {
+	data, err := os.ReadFile("testdata/camt053/statement.xml")
+	assert.NoError(t, err)
+	statements, err := parseCAMT053(string(data))
+	assert.NoError(t, err)
+	if !assert.Len(t, statements, 1) {
+		return
+	}
+	st := statements[0]
+	assert.Equal(t, "DE89370400440532013000", st.Account)
+	assert.Equal(t, "EUR", st.Currency)
+	assert.Equal(t, Money(225410), *st.LedgerBalance)
+	assert.Equal(t, mustDate("2025-04-30"), st.BalanceDate)
+	if assert.Len(t, st.Transactions, 3) { // the pending entry is left out
+		assert.Equal(t, statementTransaction{ID: "2025040100001", Date: mustDate("2025-04-01"), Amount: -4590,
+			Name: "Supermarkt GmbH", Memo: "Einkauf 0815"}, st.Transactions[0])
+		assert.Equal(t, "PAYROLL-2025-04", st.Transactions[1].ID)
+		assert.Equal(t, mustDate("2025-04-02"), st.Transactions[1].Date)
+		assert.Equal(t, "ACME GmbH", st.Transactions[1].Name)
+		assert.Empty(t, st.Transactions[2].ID)
+		assert.Equal(t, "Miete April", st.Transactions[2].Memo)
+	}
+
+	for _, s := range []string{"", "<Document></Document>", "date,amount\n"} {
+		_, err := parseCAMT053(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestImportCAMT053(t *testing.T) {
+	setupTestDB()
+	r := setupRouter()
+	db.Create(&User{FullName: "A", Username: "a", Email: "a@x.com", Password: "p", BaseCurrency: "USD"})
+	db.Create(&Account{UserID: 1, Name: "Girokonto", Type: accountChecking, Currency: "EUR", OpeningBalance: 100000})
+	data, _ := os.ReadFile("testdata/camt053/statement.xml")
+
+	fields := map[string]string{"settings": `{"account_id":1}`, "commit": "true"}
+	w := uploadFile(r, "/import/camt053", string(data), fields, 1)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var result importResult
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+	assert.True(t, result.BalanceCheck.Matches)
+	assert.Equal(t, 2, result.Expenses)
+	assert.Equal(t, 1, result.Incomes)
+	if assert.NotNil(t, result.Batch) {
+		assert.Equal(t, "camt053", result.Batch.Format)
+		assert.Equal(t, Money(124590), result.Batch.ExpenseTotal)
+		assert.Equal(t, Money(250000), result.Batch.IncomeTotal)
+	}
+	var income Income
+	db.First(&income)
+	assert.Equal(t, "EUR", income.Currency)
+	assert.Equal(t, "ACME GmbH", income.Description)
+
+	// the entry without a reference is recognised by its fingerprint
+	result = importResult{}
+	w = uploadFile(r, "/import/camt053", string(data), fields, 1)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+	assert.Equal(t, 3, result.Duplicates)
+	assert.Nil(t, result.Batch)
+}
@@ -0,0 +1,357 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Category kinds. Expenses can only be filed under expense categories and
+// incomes under income categories.
+const (
+	kindExpense = "expense"
+	kindIncome  = "income"
+)
+
+// Category is a user's own classification for transactions. Categories nest
+// under a parent of the same kind, and names are unique per user and kind,
+// ignoring case.
+type Category struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	UserID    uint      `json:"user_id" gorm:"not null;index"`
+	ParentID  *uint     `json:"parent_id" gorm:"index"`
+	Name      string    `json:"name" gorm:"not null"`
+	Kind      string    `json:"kind" gorm:"not null"`
+	Colour    string    `json:"colour"`
+	Icon      string    `json:"icon"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (cat Category) OwnerID() uint { return cat.UserID }
+
+// defaultCategories is the set every new user starts with. Children are
+// listed under their parent.
+var defaultCategories = []struct {
+	Category
+	Children []string
+}{
+	{Category{Name: "Food", Kind: kindExpense, Colour: "#E67E22", Icon: "restaurant"}, []string{"Groceries", "Dining Out"}},
+	{Category{Name: "Housing", Kind: kindExpense, Colour: "#8E44AD", Icon: "home"}, []string{"Rent", "Utilities"}},
+	{Category{Name: "Transport", Kind: kindExpense, Colour: "#2980B9", Icon: "directions_car"}, nil},
+	{Category{Name: "Health", Kind: kindExpense, Colour: "#C0392B", Icon: "local_hospital"}, nil},
+	{Category{Name: "Entertainment", Kind: kindExpense, Colour: "#F1C40F", Icon: "movie"}, nil},
+	{Category{Name: "Shopping", Kind: kindExpense, Colour: "#16A085", Icon: "shopping_bag"}, nil},
+	{Category{Name: "Other", Kind: kindExpense, Colour: "#7F8C8D", Icon: "category"}, nil},
+	{Category{Name: "Salary", Kind: kindIncome, Colour: "#27AE60", Icon: "work"}, nil},
+	{Category{Name: "Freelance", Kind: kindIncome, Colour: "#2ECC71", Icon: "laptop"}, nil},
+	{Category{Name: "Investments", Kind: kindIncome, Colour: "#1ABC9C", Icon: "trending_up"}, nil},
+	{Category{Name: "Other", Kind: kindIncome, Colour: "#95A5A6", Icon: "category"}, nil},
+}
+
+// seedCategories gives a new user the default categories.
+func seedCategories(tx *gorm.DB, userID uint) error {
+	for _, d := range defaultCategories {
+		parent := d.Category
+		parent.UserID = userID
+		if err := tx.Create(&parent).Error; err != nil {
+			return err
+		}
+		for _, name := range d.Children {
+			child := Category{UserID: userID, ParentID: &parent.ID, Name: name, Kind: parent.Kind, Colour: parent.Colour, Icon: parent.Icon}
+			if err := tx.Create(&child).Error; err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// createUser saves a new user together with their default categories.
+func createUser(user *User) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(user).Error; err != nil {
+			return err
+		}
+		return seedCategories(tx, user.ID)
+	})
+}
+
+var (
+	errUnknownCategory = errors.New("category_id does not name one of your categories")
+	errCategoryKind    = errors.New("category_id names a category of the wrong kind")
+)
+
+// findCategoryByName looks up a user's category of the given kind by name,
+// ignoring case and surrounding whitespace.
+func findCategoryByName(tx *gorm.DB, userID uint, kind, name string) (Category, error) {
+	var cat Category
+	err := tx.Where("user_id = ? AND kind = ? AND LOWER(name) = ?", userID, kind, strings.ToLower(strings.TrimSpace(name))).
+		Order("id").First(&cat).Error
+	return cat, err
+}
+
+// resolveCategory settles which category a transaction is filed under. An
+// id must name one of the user's categories of the right kind; otherwise
+// the category is looked up by name and created when new, so clients that
+// only send a name keep working. It returns the category's id and name.
+func resolveCategory(userID uint, kind string, id *uint, name string) (*uint, string, error) {
+	var cat Category
+	if id != nil {
+		if err := db.Where("id = ? AND user_id = ?", *id, userID).First(&cat).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, "", errUnknownCategory
+			}
+			return nil, "", err
+		}
+		if cat.Kind != kind {
+			return nil, "", errCategoryKind
+		}
+		return &cat.ID, cat.Name, nil
+	}
+
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, "", nil // left for validate to report
+	}
+	cat, err := findCategoryByName(db, userID, kind, name)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		cat = Category{UserID: userID, Name: name, Kind: kind}
+		err = db.Create(&cat).Error
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	return &cat.ID, cat.Name, nil
+}
+
+func (e *Expense) resolveCategory() error {
+	var err error
+	e.CategoryID, e.Category, err = resolveCategory(e.UserID, kindExpense, e.CategoryID, e.Category)
+	for i := range e.Splits {
+		if err != nil {
+			break
+		}
+		s := &e.Splits[i]
+		s.CategoryID, s.Category, err = resolveCategory(e.UserID, kindExpense, s.CategoryID, s.Category)
+	}
+	return err
+}
+
+func (i *Income) resolveCategory() error {
+	var err error
+	i.CategoryID, i.Category, err = resolveCategory(i.UserID, kindIncome, i.CategoryID, i.Category)
+	return err
+}
+
+// renamedOnly reports whether an update changed a transaction's category
+// name but kept its category_id, in which case the name should win.
+func renamedOnly(id, prevID *uint, name, prevName string) bool {
+	sameID := id == nil && prevID == nil || id != nil && prevID != nil && *id == *prevID
+	return sameID && name != prevName
+}
+
+// categoryError answers a failed category lookup.
+func categoryError(c *gin.Context, err error) {
+	if errors.Is(err, errUnknownCategory) || errors.Is(err, errCategoryKind) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to look up category"})
+}
+
+// categorySubtree returns id and the ids of every category below it.
+func categorySubtree(userID, id uint) ([]uint, error) {
+	var cats []Category
+	if err := db.Select("id", "parent_id").Where("user_id = ?", userID).Find(&cats).Error; err != nil {
+		return nil, err
+	}
+	children := map[uint][]uint{}
+	for _, cat := range cats {
+		if cat.ParentID != nil {
+			children[*cat.ParentID] = append(children[*cat.ParentID], cat.ID)
+		}
+	}
+	ids := []uint{id}
+	for i := 0; i < len(ids); i++ {
+		ids = append(ids, children[ids[i]]...)
+	}
+	return ids, nil
+}
+
+var colourPattern = regexp.MustCompile(`^#[0-9A-Fa-f]{6}$`)
+
+// validate checks cat against the user's other categories.
+func (cat Category) validate() error {
+	if strings.TrimSpace(cat.Name) == "" {
+		return errors.New("name is required")
+	}
+	if cat.Kind != kindExpense && cat.Kind != kindIncome {
+		return errors.New("kind must be expense or income")
+	}
+	if cat.Colour != "" && !colourPattern.MatchString(cat.Colour) {
+		return errors.New("colour must be formatted as #RRGGBB")
+	}
+
+	if existing, err := findCategoryByName(db, cat.UserID, cat.Kind, cat.Name); err == nil && existing.ID != cat.ID {
+		return errors.New("a category with this name already exists")
+	}
+
+	// Walk up from the parent; meeting cat itself would make a cycle.
+	for parentID := cat.ParentID; parentID != nil; {
+		if cat.ID != 0 && *parentID == cat.ID {
+			return errors.New("a category cannot be its own ancestor")
+		}
+		var parent Category
+		if err := db.Where("id = ? AND user_id = ?", *parentID, cat.UserID).First(&parent).Error; err != nil {
+			return errors.New("parent_id does not name one of your categories")
+		}
+		if parent.Kind != cat.Kind {
+			return errors.New("parent_id names a category of a different kind")
+		}
+		parentID = parent.ParentID
+	}
+	return nil
+}
+
+func GetCategories(c *gin.Context) {
+	query := db.Where("user_id = ?", currentUserID(c))
+	if kind := c.Query("kind"); kind != "" {
+		query = query.Where("kind = ?", kind)
+	}
+	categories := []Category{}
+	if err := query.Order("kind, name").Find(&categories).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve categories"})
+		return
+	}
+	c.JSON(http.StatusOK, categories)
+}
+
+func AddCategory(c *gin.Context) {
+	var cat Category
+	if err := c.ShouldBindJSON(&cat); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	cat.ID = 0
+	cat.UserID = currentUserID(c)
+	cat.Name = strings.TrimSpace(cat.Name)
+	if err := cat.validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := db.Create(&cat).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save category"})
+		return
+	}
+	c.JSON(http.StatusOK, cat)
+}
+
+// UpdateCategory replaces or patches a category. Its kind cannot change,
+// and a new name is carried over to the transactions and budgets using it.
+func UpdateCategory(c *gin.Context) {
+	var cat Category
+	if !findOwned(c, &cat, "Category not found") {
+		return
+	}
+
+	var updated Category
+	if err := bindUpdate(c, cat, &updated); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	updated.ID, updated.UserID, updated.CreatedAt = cat.ID, cat.UserID, cat.CreatedAt
+	updated.Name = strings.TrimSpace(updated.Name)
+	if updated.Kind != cat.Kind {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "kind cannot be changed"})
+		return
+	}
+	if err := updated.validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&updated).Error; err != nil {
+			return err
+		}
+		if updated.Name == cat.Name {
+			return nil
+		}
+		return renameCategory(tx, cat, updated.Name)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update category"})
+		return
+	}
+	c.JSON(http.StatusOK, updated)
+}
+
+// renameCategory carries a category's new name over to the transactions
+// filed under it and the budgets limited to it.
+func renameCategory(tx *gorm.DB, cat Category, name string) error {
+	model := interface{}(&Expense{})
+	if cat.Kind == kindIncome {
+		model = &Income{}
+	}
+	for _, m := range []interface{}{model, &ExpenseSplit{}, &RecurringRule{}, &Bill{}, &TransactionRule{}} {
+		if err := tx.Model(m).Where("category_id = ?", cat.ID).Update("category", name).Error; err != nil {
+			return err
+		}
+	}
+	if cat.Kind != kindExpense {
+		return nil
+	}
+
+	var budgets []Budget
+	if err := tx.Where("user_id = ?", cat.UserID).Find(&budgets).Error; err != nil {
+		return err
+	}
+	for _, b := range budgets {
+		changed := false
+		for i, n := range b.Categories {
+			if strings.EqualFold(strings.TrimSpace(n), cat.Name) {
+				b.Categories[i], changed = name, true
+			}
+		}
+		if changed {
+			if err := tx.Model(&b).Select("categories").Updates(&b).Error; err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// DeleteCategory removes a category that nothing is filed under and that
+// has no subcategories.
+func DeleteCategory(c *gin.Context) {
+	var cat Category
+	if !findOwned(c, &cat, "Category not found") {
+		return
+	}
+
+	var children, expenses, incomes, splits, rules, bills, transactionRules int64
+	db.Model(&Category{}).Where("parent_id = ?", cat.ID).Count(&children)
+	db.Model(&Expense{}).Where("category_id = ?", cat.ID).Count(&expenses)
+	db.Model(&Income{}).Where("category_id = ?", cat.ID).Count(&incomes)
+	db.Model(&ExpenseSplit{}).Where("category_id = ?", cat.ID).Count(&splits)
+	db.Model(&RecurringRule{}).Where("category_id = ?", cat.ID).Count(&rules)
+	db.Model(&Bill{}).Where("category_id = ?", cat.ID).Count(&bills)
+	db.Model(&TransactionRule{}).Where("category_id = ?", cat.ID).Count(&transactionRules)
+	if children+expenses+incomes+splits+rules+bills+transactionRules > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Category is still in use"})
+		return
+	}
+
+	if err := db.Delete(&cat).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete category"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Category deleted"})
+}
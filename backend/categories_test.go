@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func sendJSON(r http.Handler, method, path, body string, userID uint) *httptest.ResponseRecorder {
+	req := withAuth(httptest.NewRequest(method, path, bytes.NewBufferString(body)), userID)
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+// getJSON sends an authenticated GET and decodes a successful response.
+func getJSON(r http.Handler, path string, userID uint, dest interface{}) int {
+	w := sendJSON(r, "GET", path, "", userID)
+	if w.Code == http.StatusOK {
+		_ = json.Unmarshal(w.Body.Bytes(), dest)
+	}
+	return w.Code
+}
+
+func TestRegisterSeedsCategories(t *testing.T) {
+	setupTestDB()
+	r := setupRouter()
+
+	req := httptest.NewRequest("POST", "/register", bytes.NewBufferString(`{"fullName":"T","username":"u","email":"u@x.com","password":"p"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = sendJSON(r, "GET", "/categories?kind=expense", "", 1)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var cats []Category
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &cats))
+	byName := map[string]Category{}
+	for _, cat := range cats {
+		assert.Equal(t, kindExpense, cat.Kind)
+		byName[cat.Name] = cat
+	}
+	assert.Contains(t, byName, "Food")
+	assert.Equal(t, byName["Food"].ID, *byName["Groceries"].ParentID)
+	assert.Nil(t, byName["Food"].ParentID)
+}
+
+func TestCategoryEndpoints(t *testing.T) {
+	setupTestDB()
+	r := setupRouter()
+
+	w := sendJSON(r, "POST", "/categories", `{"name":" Food ","kind":"expense","colour":"#FF0000","icon":"restaurant"}`, 1)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var food Category
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &food))
+	assert.Equal(t, "Food", food.Name)
+	assert.EqualValues(t, 1, food.UserID)
+
+	w = sendJSON(r, "POST", "/categories", `{"name":"Groceries","kind":"expense","parent_id":1}`, 1)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	for _, body := range []string{
+		`{"name":"food","kind":"expense"}`,                  // duplicate, ignoring case
+		`{"name":"Pay","kind":"salary"}`,                    // unknown kind
+		`{"name":"Pay","kind":"income","parent_id":1}`,      // parent of another kind
+		`{"name":"Snacks","kind":"expense","parent_id":99}`, // missing parent
+		`{"name":"Snacks","kind":"expense","colour":"red"}`,
+		`{"name":"  ","kind":"expense"}`,
+	} {
+		assert.Equal(t, http.StatusBadRequest, sendJSON(r, "POST", "/categories", body, 1).Code, body)
+	}
+	// the same name is fine for another user
+	assert.Equal(t, http.StatusOK, sendJSON(r, "POST", "/categories", `{"name":"Food","kind":"expense"}`, 2).Code)
+
+	// no cycles, no kind changes, no editing others' categories
+	assert.Equal(t, http.StatusBadRequest, sendJSON(r, "PATCH", "/categories/1", `{"parent_id":2}`, 1).Code)
+	assert.Equal(t, http.StatusBadRequest, sendJSON(r, "PATCH", "/categories/1", `{"kind":"income"}`, 1).Code)
+	assert.Equal(t, http.StatusForbidden, sendJSON(r, "PATCH", "/categories/1", `{"name":"Mine"}`, 2).Code)
+
+	// transactions by name resolve to the category, ignoring case
+	w = sendJSON(r, "POST", "/expenses", `{"amount":5,"category":"  fOOD","date":"2025-04-20"}`, 1)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var e Expense
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &e))
+	assert.Equal(t, "Food", e.Category)
+	assert.EqualValues(t, 1, *e.CategoryID)
+
+	// or by id; the id wins over a stale name
+	w = sendJSON(r, "POST", "/expenses", `{"amount":7,"category_id":2,"category":"whatever","date":"2025-04-21"}`, 1)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &e))
+	assert.Equal(t, "Groceries", e.Category)
+
+	// a new name creates a category
+	w = sendJSON(r, "POST", "/expenses", `{"amount":9,"category":"Books","date":"2025-04-22"}`, 1)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &e))
+	var books Category
+	assert.NoError(t, db.First(&books, *e.CategoryID).Error)
+	assert.Equal(t, kindExpense, books.Kind)
+
+	// ids must be the user's own and of the right kind
+	assert.Equal(t, http.StatusBadRequest, sendJSON(r, "POST", "/expenses", `{"amount":5,"category_id":3,"date":"2025-04-20"}`, 1).Code)
+	assert.Equal(t, http.StatusBadRequest, sendJSON(r, "POST", "/incomes", `{"amount":5,"category_id":1,"date":"2025-04-20"}`, 1).Code)
+
+	// patching the name alone moves the expense to that category
+	w = sendJSON(r, "PATCH", "/expenses/1", `{"category":"groceries"}`, 1)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &e))
+	assert.EqualValues(t, 2, *e.CategoryID)
+	assert.Equal(t, "Groceries", e.Category)
+
+	// filtering on a parent includes its children
+	code, list := listExpenses(t, map[string][]string{"category_id": {"1"}})
+	assert.Equal(t, http.StatusOK, code)
+	assert.Len(t, list.Data, 2)
+
+	// renaming carries over to transactions and budgets
+	db.Create(&Budget{UserID: 1, BudgetName: "b", BudgetAmount: 100, StartDate: mustDate("2025-04-01"), EndDate: mustDate("2025-04-30"), Categories: []string{"groceries", "Books"}})
+	assert.Equal(t, http.StatusOK, sendJSON(r, "PATCH", "/categories/2", `{"name":"Supermarket"}`, 1).Code)
+	assert.NoError(t, db.First(&e, 1).Error)
+	assert.Equal(t, "Supermarket", e.Category)
+	var b Budget
+	assert.NoError(t, db.First(&b, 1).Error)
+	assert.Equal(t, []string{"Supermarket", "Books"}, b.Categories)
+
+	// categories in use or with children stay
+	assert.Equal(t, http.StatusConflict, sendJSON(r, "DELETE", "/categories/1", "", 1).Code)
+	assert.Equal(t, http.StatusConflict, sendJSON(r, "DELETE", "/categories/2", "", 1).Code)
+	assert.Equal(t, http.StatusOK, sendJSON(r, "DELETE", "/expenses/3", "", 1).Code)
+	assert.Equal(t, http.StatusOK, sendJSON(r, "DELETE", "/categories/"+fmt.Sprint(books.ID), "", 1).Code)
+}
+
+func TestMigrateCategoryNames(t *testing.T) {
+	setupTestDB()
+	db.Create(&Category{UserID: 1, Name: "Salary", Kind: kindIncome})
+	db.Create(&[]Expense{
+		{UserID: 1, Amount: 1, Category: "food", Date: mustDate("2025-04-01")},
+		{UserID: 1, Amount: 1, Category: "Food", Date: mustDate("2025-04-01")},
+		{UserID: 1, Amount: 1, Category: "Food ", Date: mustDate("2025-04-01")},
+		{UserID: 1, Amount: 1, Category: "Food", Date: mustDate("2025-04-01")},
+		{UserID: 1, Amount: 1, Category: "Rent", Date: mustDate("2025-04-01")},
+		{UserID: 2, Amount: 1, Category: "FOOD", Date: mustDate("2025-04-01")},
+		{UserID: 2, Amount: 1, Category: "", Date: mustDate("2025-04-01")},
+	})
+	db.Create(&Income{UserID: 1, Amount: 1, Category: " salary", Date: mustDate("2025-04-01")})
+
+	assert.NoError(t, migrateCategoryNames(db))
+	assert.NoError(t, migrateCategoryNames(db)) // and again, as on every start
+
+	var cats []Category
+	db.Order("user_id, kind, name").Find(&cats)
+	var names []string
+	for _, cat := range cats {
+		names = append(names, fmt.Sprint(cat.UserID)+":"+cat.Kind+":"+cat.Name)
+	}
+	assert.Equal(t, []string{"1:expense:Food", "1:expense:Rent", "1:income:Salary", "2:expense:FOOD"}, names)
+
+	var expenses []Expense
+	db.Where("user_id = 1 AND category_id = ?", cats[0].ID).Find(&expenses)
+	assert.Len(t, expenses, 4)
+	for _, e := range expenses {
+		assert.Equal(t, "Food", e.Category)
+	}
+	var inc Income
+	db.First(&inc)
+	assert.Equal(t, cats[2].ID, *inc.CategoryID)
+	assert.Equal(t, "Salary", inc.Category)
+
+	var empty Expense
+	db.Where("category = ''").First(&empty)
+	assert.Nil(t, empty.CategoryID)
+}
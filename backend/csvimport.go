@@ -0,0 +1,326 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxImportFileSize bounds the size of an uploaded statement.
+const maxImportFileSize = 10 << 20
+
+// Sign conventions for CSV amounts.
+const (
+	signNegativeExpense = "negative_expense" // money out is negative, as on bank statements
+	signPositiveExpense = "positive_expense" // money out is positive, as on card statements
+	signDebitCredit     = "debit_credit"     // separate debit and credit columns
+)
+
+// csvMapping says how to read a bank's CSV export. Columns are named by
+// their header, or by their 1-based position when the file has none.
+type csvMapping struct {
+	importSettings
+	Date        string `json:"date"`
+	Amount      string `json:"amount"`
+	Debit       string `json:"debit"`
+	Credit      string `json:"credit"`
+	Description string `json:"description"`
+	Category    string `json:"category"`
+	Sign        string `json:"sign"`
+	DateFormat  string `json:"date_format"` // such as DD/MM/YYYY; YYYY-MM-DD by default
+	Decimal     string `json:"decimal"`     // "." by default, or ","
+	Delimiter   string `json:"delimiter"`   // "," by default
+	Header      *bool  `json:"header"`      // true by default
+}
+
+// csvColumns holds the position of each mapped column, or -1.
+type csvColumns struct {
+	date, amount, debit, credit, description, category int
+}
+
+// dateLayout turns a format written with YYYY, YY, MM, M, DD and D into a
+// Go time layout. Go layouts are accepted as they are.
+func (m csvMapping) dateLayout() string {
+	if m.DateFormat == "" {
+		return "2006-01-02"
+	}
+	if strings.ContainsAny(m.DateFormat, "0123456789") {
+		return m.DateFormat
+	}
+	return strings.NewReplacer("YYYY", "2006", "YY", "06", "MM", "01", "M", "1", "DD", "02", "D", "2").
+		Replace(strings.ToUpper(m.DateFormat))
+}
+
+func (m *csvMapping) validate() error {
+	if m.Sign == "" {
+		m.Sign = signNegativeExpense
+	}
+	switch m.Sign {
+	case signNegativeExpense, signPositiveExpense:
+		if m.Amount == "" {
+			return errors.New("mapping needs an amount column")
+		}
+	case signDebitCredit:
+		if m.Debit == "" || m.Credit == "" {
+			return errors.New("mapping needs debit and credit columns")
+		}
+	default:
+		return errors.New("sign must be negative_expense, positive_expense or debit_credit")
+	}
+	if m.Date == "" {
+		return errors.New("mapping needs a date column")
+	}
+	if m.Decimal == "" {
+		m.Decimal = "."
+	}
+	if m.Decimal != "." && m.Decimal != "," {
+		return errors.New("decimal must be . or ,")
+	}
+	if m.Delimiter == "" {
+		m.Delimiter = ","
+	}
+	if utf8.RuneCountInString(m.Delimiter) != 1 {
+		return errors.New("delimiter must be a single character")
+	}
+	return nil
+}
+
+// columns finds the mapped columns in the header row, or checks the
+// positions given when there is none.
+func (m csvMapping) columns(header []string) (csvColumns, error) {
+	find := func(name string) (int, error) {
+		if name == "" {
+			return -1, nil
+		}
+		if m.Header != nil && !*m.Header {
+			n, err := strconv.Atoi(name)
+			if err != nil || n < 1 {
+				return -1, fmt.Errorf("column %q must be a position from 1 when the file has no header", name)
+			}
+			return n - 1, nil
+		}
+		for i, h := range header {
+			if strings.EqualFold(strings.TrimSpace(h), strings.TrimSpace(name)) {
+				return i, nil
+			}
+		}
+		return -1, fmt.Errorf("column %q is not in the header", name)
+	}
+	var cols csvColumns
+	var err error
+	for _, c := range []struct {
+		dest *int
+		name string
+	}{
+		{&cols.date, m.Date}, {&cols.amount, m.Amount}, {&cols.debit, m.Debit}, {&cols.credit, m.Credit},
+		{&cols.description, m.Description}, {&cols.category, m.Category},
+	} {
+		if *c.dest, err = find(c.name); err != nil {
+			return cols, err
+		}
+	}
+	return cols, nil
+}
+
+// parseStatementAmount reads an amount as banks print it: with thousands
+// separators, a currency symbol, or a sign in front, behind or as
+// parentheses.
+func parseStatementAmount(s, decimal string) (Money, error) {
+	s = strings.TrimSpace(s)
+	neg := false
+	if strings.HasPrefix(s, "(") && strings.HasSuffix(s, ")") {
+		neg, s = true, s[1:len(s)-1]
+	}
+	s = strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) || unicode.Is(unicode.Sc, r) || r == '\'' {
+			return -1
+		}
+		return r
+	}, s)
+	if strings.HasSuffix(s, "-") {
+		neg, s = !neg, strings.TrimSuffix(s, "-")
+	} else if strings.HasPrefix(s, "-") {
+		neg, s = !neg, strings.TrimPrefix(s, "-")
+	} else {
+		s = strings.TrimPrefix(s, "+")
+	}
+	thousands := ","
+	if decimal == "," {
+		thousands = "."
+	}
+	s = strings.ReplaceAll(s, thousands, "")
+	s = strings.Replace(s, decimal, ".", 1)
+	if strings.HasPrefix(s, "-") {
+		return 0, errInvalidMoney
+	}
+	m, err := ParseMoney(s)
+	if neg {
+		m = -m
+	}
+	return m, err
+}
+
+// readCSV turns a CSV statement into import rows. Line numbers count the
+// header.
+func (m csvMapping) readCSV(r io.Reader) ([]importRow, error) {
+	reader := csv.NewReader(r)
+	reader.Comma, _ = utf8.DecodeRuneInString(m.Delimiter)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	reader.TrimLeadingSpace = true
+
+	var header []string
+	line := 0
+	if m.Header == nil || *m.Header {
+		var err error
+		if header, err = reader.Read(); err != nil {
+			return nil, errors.New("file has no header row")
+		}
+		header[0] = strings.TrimPrefix(header[0], "\ufeff") // byte order mark
+		line++
+	}
+	cols, err := m.columns(header)
+	if err != nil {
+		return nil, err
+	}
+	layout := m.dateLayout()
+
+	rows := []importRow{}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		line++
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		if len(rows) == maxImportRows {
+			return nil, fmt.Errorf("file has more than %d rows", maxImportRows)
+		}
+		rows = append(rows, m.readRecord(line, record, cols, layout))
+	}
+	return rows, nil
+}
+
+func (m csvMapping) readRecord(line int, record []string, cols csvColumns, layout string) importRow {
+	row := importRow{Line: line, Kind: kindExpense}
+	field := func(i int) string {
+		if i < 0 || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	if s := field(cols.date); s == "" {
+		row.fail("date is missing")
+	} else if t, err := time.Parse(layout, s); err != nil {
+		row.fail(fmt.Sprintf("date %q does not match the date format", s))
+	} else {
+		row.Date = DateOf(t)
+	}
+
+	var amount Money
+	var err error
+	switch m.Sign {
+	case signDebitCredit:
+		debit, credit := field(cols.debit), field(cols.credit)
+		switch {
+		case debit != "" && credit != "":
+			row.fail("only one of debit and credit may be filled in")
+		case debit != "":
+			amount, err = parseStatementAmount(debit, m.Decimal)
+			if amount > 0 {
+				amount = -amount
+			}
+		case credit != "":
+			amount, err = parseStatementAmount(credit, m.Decimal)
+		default:
+			row.fail("debit and credit are both empty")
+		}
+	default:
+		if s := field(cols.amount); s == "" {
+			row.fail("amount is missing")
+		} else {
+			amount, err = parseStatementAmount(s, m.Decimal)
+		}
+		if m.Sign == signPositiveExpense {
+			amount = -amount
+		}
+	}
+	switch {
+	case err != nil:
+		row.fail("amount is not a number")
+	case amount > 0:
+		row.Kind, row.Amount = kindIncome, amount
+	case amount < 0:
+		row.Amount = -amount
+	case len(row.Errors) == 0:
+		row.fail("amount is zero")
+	}
+
+	row.Description = field(cols.description)
+	row.Category = field(cols.category)
+	if row.Category == "" {
+		row.Category = m.DefaultCategory
+	}
+	return row
+}
+
+// ImportCSV reads a bank statement uploaded as the multipart field file,
+// using the JSON column mapping in the field mapping. It previews the
+// transactions it found unless commit is true; see finishImport.
+func ImportCSV(c *gin.Context) {
+	userID := currentUserID(c)
+	header, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "file is required"})
+		return
+	}
+	if header.Size > maxImportFileSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "file is too large"})
+		return
+	}
+
+	var mapping csvMapping
+	if err := json.Unmarshal([]byte(c.PostForm("mapping")), &mapping); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "mapping must be a JSON object"})
+		return
+	}
+	if err := mapping.validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := mapping.prepare(userID); err != nil {
+		importSettingsError(c, err)
+		return
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "file cannot be read"})
+		return
+	}
+	defer file.Close()
+	rows, err := mapping.readCSV(file)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	result, err := newImportResult(userID, mapping.Currency, rows)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check for duplicates"})
+		return
+	}
+	finishImport(c, userID, "csv", mapping.importSettings, result)
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// uploadFile posts content as the multipart field file, along with fields.
+func uploadFile(r http.Handler, path, content string, fields map[string]string, userID uint) *httptest.ResponseRecorder {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for k, v := range fields {
+		mw.WriteField(k, v)
+	}
+	fw, _ := mw.CreateFormFile("file", "statement")
+	fw.Write([]byte(content))
+	mw.Close()
+
+	req := httptest.NewRequest("POST", path, &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, withAuth(req, userID))
+	return w
+}
+
+func TestParseStatementAmount(t *testing.T) {
+	for s, want := range map[string]Money{
+		"12.50":      1250,
+		"-1,234.56":  -123456,
+		"(45.00)":    -4500,
+		"$ 3.10":     310,
+		"7.5-":       -750,
+		"+0.99":      99,
+		"1'000.00":   100000,
+		" -€ 20.00 ": -2000,
+	} {
+		got, err := parseStatementAmount(s, ".")
+		assert.NoError(t, err, s)
+		assert.Equal(t, want, got, s)
+	}
+	got, err := parseStatementAmount("-1.234,56", ",")
+	assert.NoError(t, err)
+	assert.Equal(t, Money(-123456), got)
+
+	for _, s := range []string{"abc", "1.2.3", "--5", "12.345"} {
+		_, err := parseStatementAmount(s, ".")
+		assert.Error(t, err, s)
+	}
+}
+
+func TestImportCSV(t *testing.T) {
+	setupTestDB()
+	r := setupRouter()
+	db.Create(&User{FullName: "A", Username: "a", Email: "a@x.com", Password: "p", BaseCurrency: "EUR"})
+	db.Create(&Category{UserID: 1, Name: "Groceries", Kind: kindExpense})
+
+	statement := "\ufeffBuchungstag;Betrag;Verwendungszweck;Kategorie\n" +
+		"01.04.2025;-45,90;Supermarkt;groceries\n" +
+		"02.04.2025;2.500,00;Gehalt;Salary\n" +
+		"03.04.2025;-1.200,00;Miete;\n" +
+		"31.02.2025;-5,00;Kiosk;\n" +
+		"04.04.2025;zwanzig;Bäcker;\n"
+	mapping := `{"date":"Buchungstag","amount":"Betrag","description":"Verwendungszweck","category":"Kategorie",
+		"date_format":"DD.MM.YYYY","decimal":",","delimiter":";","default_category":"Sonstiges"}`
+
+	// preview
+	w := uploadFile(r, "/import/csv", statement, map[string]string{"mapping": mapping}, 1)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var result importResult
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+	assert.False(t, result.Committed)
+	assert.Equal(t, 3, result.Valid)
+	assert.Equal(t, 2, result.Invalid)
+	if assert.Len(t, result.Rows, 5) {
+		assert.Equal(t, importRow{Line: 2, Kind: kindExpense, Date: mustDate("2025-04-01"), Amount: 4590, Description: "Supermarkt", Category: "groceries"}, result.Rows[0])
+		assert.Equal(t, kindIncome, result.Rows[1].Kind)
+		assert.Equal(t, Money(250000), result.Rows[1].Amount)
+		assert.Equal(t, "Sonstiges", result.Rows[2].Category)
+		assert.Equal(t, []string{`date "31.02.2025" does not match the date format`}, result.Rows[3].Errors)
+		assert.Equal(t, []string{"amount is not a number"}, result.Rows[4].Errors)
+	}
+	var count int64
+	db.Model(&Expense{}).Count(&count)
+	assert.Zero(t, count)
+
+	// invalid rows block a commit unless they are skipped
+	w = uploadFile(r, "/import/csv", statement, map[string]string{"mapping": mapping, "commit": "true"}, 1)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	w = uploadFile(r, "/import/csv", statement, map[string]string{"mapping": mapping, "commit": "true", "skip_invalid": "true"}, 1)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+	assert.True(t, result.Committed)
+	assert.Equal(t, 2, result.Expenses)
+	assert.Equal(t, 1, result.Incomes)
+
+	var expenses []Expense
+	db.Order("date").Find(&expenses)
+	if assert.Len(t, expenses, 2) {
+		assert.Equal(t, "EUR", expenses[0].Currency)
+		assert.Equal(t, "Groceries", expenses[0].Category) // the existing category
+		assert.True(t, expenses[0].Paid)
+	}
+	db.Model(&Category{}).Where("name IN ?", []string{"Salary", "Sonstiges"}).Count(&count)
+	assert.EqualValues(t, 2, count)
+
+	// debit and credit columns, no header
+	w = uploadFile(r, "/import/csv", "2025-04-05,Coffee,3.20,\n2025-04-06,Refund,,10.00\n",
+		map[string]string{"mapping": `{"header":false,"date":"1","description":"2","debit":"3","credit":"4","sign":"debit_credit"}`}, 1)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+	if assert.Len(t, result.Rows, 2) {
+		assert.Equal(t, kindExpense, result.Rows[0].Kind)
+		assert.Equal(t, Money(320), result.Rows[0].Amount)
+		assert.Equal(t, kindIncome, result.Rows[1].Kind)
+	}
+
+	// yen have no fractions
+	w = uploadFile(r, "/import/csv", "2025-04-05,Ramen,980\n2025-04-06,Tea,120.50\n",
+		map[string]string{"mapping": `{"header":false,"date":"1","description":"2","amount":"3","currency":"JPY"}`}, 1)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+	assert.Equal(t, 1, result.Valid)
+	if assert.Len(t, result.Rows, 2) {
+		assert.Equal(t, []string{"amount must be a whole number of JPY"}, result.Rows[1].Errors)
+	}
+
+	for _, m := range []string{
+		`not json`,
+		`{"amount":"Betrag"}`,
+		`{"date":"Buchungstag","amount":"Betrag","sign":"both"}`,
+		`{"date":"Datum","amount":"Betrag","delimiter":";"}`,
+		`{"date":"Buchungstag","amount":"Betrag","delimiter":";","currency":"EURO"}`,
+		`{"date":"Buchungstag","amount":"Betrag","delimiter":";","account_id":9}`,
+	} {
+		assert.Equal(t, http.StatusBadRequest, uploadFile(r, "/import/csv", statement, map[string]string{"mapping": m}, 1).Code, m)
+	}
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ExchangeRate says how many units of Currency one unit of Base bought on
+// Date. Rates are only ever loaded from files on disk.
+type ExchangeRate struct {
+	ID       uint    `json:"id" gorm:"primaryKey"`
+	Base     string  `json:"base" gorm:"size:3;not null;uniqueIndex:idx_rate"`
+	Currency string  `json:"currency" gorm:"size:3;not null;uniqueIndex:idx_rate"`
+	Date     Date    `json:"date" gorm:"not null;uniqueIndex:idx_rate"`
+	Rate     float64 `json:"rate" gorm:"not null"`
+}
+
+// loadExchangeRates upserts the rates in a CSV or ECB-style XML file and
+// returns how many were read. The format is picked by file extension.
+func loadExchangeRates(db *gorm.DB, path string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	var rates []ExchangeRate
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".xml":
+		rates, err = parseECBRates(f)
+	case ".csv":
+		rates, err = parseCSVRates(f)
+	default:
+		return 0, fmt.Errorf("unsupported exchange rate file %q", path)
+	}
+	if err != nil {
+		return 0, err
+	}
+	if len(rates) == 0 {
+		return 0, nil
+	}
+
+	err = db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "base"}, {Name: "currency"}, {Name: "date"}},
+		DoUpdates: clause.AssignmentColumns([]string{"rate"}),
+	}).CreateInBatches(rates, 500).Error
+	return len(rates), err
+}
+
+// parseECBRates reads the European Central Bank's eurofxref XML, in which
+// every rate is quoted against the euro.
+func parseECBRates(r io.Reader) ([]ExchangeRate, error) {
+	var doc struct {
+		Days []struct {
+			Time  string `xml:"time,attr"`
+			Rates []struct {
+				Currency string `xml:"currency,attr"`
+				Rate     string `xml:"rate,attr"`
+			} `xml:"Cube"`
+		} `xml:"Cube>Cube"`
+	}
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, err
+	}
+
+	var rates []ExchangeRate
+	for _, day := range doc.Days {
+		date, err := ParseDate(day.Time)
+		if err != nil {
+			return nil, fmt.Errorf("invalid date %q", day.Time)
+		}
+		for _, cube := range day.Rates {
+			rate, err := parseRate(cube.Rate)
+			if err != nil {
+				return nil, err
+			}
+			rates = append(rates, ExchangeRate{Base: "EUR", Currency: cube.Currency, Date: date, Rate: rate})
+		}
+	}
+	return rates, nil
+}
+
+// parseCSVRates reads rows of date,currency,rate with an optional fourth
+// base column (EUR when absent). A header row is skipped.
+func parseCSVRates(r io.Reader) ([]ExchangeRate, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	var rates []ExchangeRate
+	for line := 1; ; line++ {
+		rec, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if line == 1 && strings.EqualFold(rec[0], "date") {
+			continue
+		}
+		if len(rec) < 3 {
+			return nil, fmt.Errorf("line %d: expected date,currency,rate[,base]", line)
+		}
+
+		rate := ExchangeRate{Base: "EUR", Currency: strings.ToUpper(rec[1])}
+		if len(rec) > 3 && rec[3] != "" {
+			rate.Base = strings.ToUpper(rec[3])
+		}
+		rate.Date, err = ParseDate(rec[0])
+		if err != nil || !isCurrencyCode(rate.Currency) || !isCurrencyCode(rate.Base) {
+			return nil, fmt.Errorf("line %d: invalid date or currency", line)
+		}
+		if rate.Rate, err = parseRate(rec[2]); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		rates = append(rates, rate)
+	}
+	return rates, nil
+}
+
+func parseRate(s string) (float64, error) {
+	rate, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil || rate <= 0 || math.IsInf(rate, 0) {
+		return 0, fmt.Errorf("invalid rate %q", s)
+	}
+	return rate, nil
+}
+
+var errNoRate = errors.New("no exchange rate")
+
+// converter turns amounts into one target currency using the rate in
+// effect on each transaction's date, i.e. the latest one on or before it.
+// It caches lookups, so use one per request.
+type converter struct {
+	db     *gorm.DB
+	target string
+	bases  []string
+	cache  map[rateKey]float64
+}
+
+type rateKey struct {
+	currency string
+	date     Date
+}
+
+func newConverter(db *gorm.DB, target string) *converter {
+	return &converter{db: db, target: target, cache: map[rateKey]float64{}}
+}
+
+// Convert returns amount, held in currency from, in the target currency.
+func (cv *converter) Convert(amount Money, from string, date Date) (Money, error) {
+	if from == cv.target || amount == 0 {
+		return amount, nil
+	}
+	key := rateKey{from, date}
+	rate, ok := cv.cache[key]
+	if !ok {
+		var err error
+		if rate, err = cv.rate(from, date); err != nil {
+			return 0, err
+		}
+		cv.cache[key] = rate
+	}
+	return Money(math.Round(float64(amount) * rate)), nil
+}
+
+// rate finds how many target units one unit of from bought on date,
+// directly or through any base currency quoting both.
+func (cv *converter) rate(from string, date Date) (float64, error) {
+	if cv.bases == nil {
+		if err := cv.db.Model(&ExchangeRate{}).Distinct().Pluck("base", &cv.bases).Error; err != nil {
+			return 0, err
+		}
+	}
+	for _, base := range cv.bases {
+		fromRate, err := cv.quote(base, from, date)
+		if err != nil {
+			return 0, err
+		}
+		toRate, err := cv.quote(base, cv.target, date)
+		if err != nil {
+			return 0, err
+		}
+		if fromRate > 0 && toRate > 0 {
+			return toRate / fromRate, nil
+		}
+	}
+	return 0, fmt.Errorf("%w from %s to %s on %s", errNoRate, from, cv.target, date)
+}
+
+// quote returns base's price in currency on date, or 0 when unknown.
+func (cv *converter) quote(base, currency string, date Date) (float64, error) {
+	if base == currency {
+		return 1, nil
+	}
+	var rates []float64
+	err := cv.db.Model(&ExchangeRate{}).
+		Where("base = ? AND currency = ? AND date <= ?", base, currency, date).
+		Order("date DESC").Limit(1).
+		Pluck("rate", &rates).Error
+	if err != nil || len(rates) == 0 {
+		return 0, err
+	}
+	return rates[0], nil
+}
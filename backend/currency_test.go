@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadExchangeRates(t *testing.T) {
+	setupTestDB()
+
+	n, err := loadExchangeRates(db, "testdata/eurofxref.xml")
+	assert.NoError(t, err)
+	assert.Equal(t, 6, n)
+	n, err = loadExchangeRates(db, "testdata/rates.csv")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	// reloading updates in place
+	_, err = loadExchangeRates(db, "testdata/eurofxref.xml")
+	assert.NoError(t, err)
+	var count int64
+	db.Model(&ExchangeRate{}).Count(&count)
+	assert.EqualValues(t, 8, count)
+
+	var r ExchangeRate
+	db.Where("base = ? AND currency = ? AND date = ?", "EUR", "USD", "2025-04-17").First(&r)
+	assert.Equal(t, 1.137, r.Rate)
+
+	_, err = loadExchangeRates(db, "testdata/missing.csv")
+	assert.Error(t, err)
+	_, err = parseCSVRates(strings.NewReader("2025-04-17,usd,abc\n"))
+	assert.Error(t, err)
+	_, err = parseCSVRates(strings.NewReader("17/04/2025,USD,1.1\n"))
+	assert.Error(t, err)
+}
+
+func TestConverter(t *testing.T) {
+	setupTestDB()
+	_, err := loadExchangeRates(db, "testdata/eurofxref.xml")
+	assert.NoError(t, err)
+	_, err = loadExchangeRates(db, "testdata/rates.csv")
+	assert.NoError(t, err)
+
+	cv := newConverter(db, "USD")
+
+	// same currency is untouched
+	m, err := cv.Convert(1234, "USD", mustDate("2025-04-17"))
+	assert.NoError(t, err)
+	assert.Equal(t, Money(1234), m)
+
+	// directly against the base
+	m, err = cv.Convert(10000, "EUR", mustDate("2025-04-17"))
+	assert.NoError(t, err)
+	assert.Equal(t, Money(11370), m)
+
+	// across two quotes: 85.80 GBP = 100 EUR = 113.70 USD
+	m, err = cv.Convert(8580, "GBP", mustDate("2025-04-17"))
+	assert.NoError(t, err)
+	assert.Equal(t, Money(11370), m)
+
+	// a weekend uses the last published rate
+	m, err = cv.Convert(10000, "EUR", mustDate("2025-04-19"))
+	assert.NoError(t, err)
+	assert.Equal(t, Money(11370), m)
+
+	// quoted against USD in the CSV
+	m, err = cv.Convert(855000, "INR", mustDate("2025-04-16"))
+	assert.NoError(t, err)
+	assert.Equal(t, Money(10000), m)
+
+	// before any rate was published
+	_, err = cv.Convert(100, "EUR", mustDate("2024-01-01"))
+	assert.ErrorIs(t, err, errNoRate)
+	_, err = cv.Convert(100, "CHF", mustDate("2025-04-17"))
+	assert.ErrorIs(t, err, errNoRate)
+}
+
+func TestTotalsConvertToBaseCurrency(t *testing.T) {
+	setupTestDB()
+	r := setupRouter()
+	_, err := loadExchangeRates(db, "testdata/eurofxref.xml")
+	assert.NoError(t, err)
+	db.Create(&User{FullName: "A", Username: "a", Email: "a@x.com", Password: "p", BaseCurrency: "USD"})
+
+	// an expense in euros picks up the user's currency only when none is given
+	req := withAuth(httptest.NewRequest("POST", "/expenses", bytes.NewBufferString(
+		`{"amount":"100","currency":"eur","category":"Travel","date":"2025-04-16"}`,
+	)), 1)
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	req = withAuth(httptest.NewRequest("POST", "/incomes", bytes.NewBufferString(
+		`{"amount":"500","category":"Salary","date":"2025-04-17"}`,
+	)), 1)
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var inc Income
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &inc))
+	assert.Equal(t, "USD", inc.Currency)
+
+	totals := func() map[string]interface{} {
+		req := withAuth(httptest.NewRequest("GET", "/reports/totals", nil), 1)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		var resp map[string]interface{}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		return resp
+	}
+
+	resp := totals()
+	assert.Equal(t, "USD", resp["currency"])
+	assert.Equal(t, 500.0, resp["income"])
+	assert.Equal(t, 112.5, resp["expenses"])
+	assert.Equal(t, 387.5, resp["net"])
+
+	// switching the base currency converts the other way
+	req = withAuth(httptest.NewRequest("PUT", "/users/1/base-currency", bytes.NewBufferString(`{"base_currency":"eur"}`)), 1)
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	resp = totals()
+	assert.Equal(t, "EUR", resp["currency"])
+	assert.Equal(t, 100.0, resp["expenses"])
+	assert.Equal(t, 439.75, resp["income"])
+
+	// the stored amounts never change
+	var e Expense
+	db.First(&e, 1)
+	assert.Equal(t, Money(10000), e.Amount)
+	assert.Equal(t, "EUR", e.Currency)
+
+	// missing rates are reported, not guessed
+	db.Create(&Expense{UserID: 1, Amount: 100, Currency: "CHF", Category: "c", Date: mustDate("2025-04-17")})
+	req = withAuth(httptest.NewRequest("GET", "/reports/totals", nil), 1)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+
+	// bad input
+	req = withAuth(httptest.NewRequest("PUT", "/users/1/base-currency", bytes.NewBufferString(`{"base_currency":"euro"}`)), 1)
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	req = withAuth(httptest.NewRequest("GET", "/reports/totals?from=yesterday", nil), 1)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestCurrencyMinorUnits(t *testing.T) {
+	setupTestDB()
+	r := setupRouter()
+	db.Create(&User{FullName: "A", Username: "a", Email: "a@x.com", Password: "p", BaseCurrency: "USD"})
+
+	w := sendJSON(r, "POST", "/expenses", `{"amount":"1500.50","currency":"JPY","category":"Food","date":"2025-04-16"}`, 1)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "whole number of JPY")
+	assert.Equal(t, http.StatusOK, sendJSON(r, "POST", "/expenses", `{"amount":"1500","currency":"JPY","category":"Food","date":"2025-04-16"}`, 1).Code)
+	assert.Equal(t, http.StatusBadRequest, sendJSON(r, "POST", "/incomes", `{"amount":"0.5","currency":"KRW","category":"Gift","date":"2025-04-16"}`, 1).Code)
+	// three-decimal currencies cannot be held in hundredths
+	w = sendJSON(r, "POST", "/incomes", `{"amount":"0.5","currency":"KWD","category":"Gift","date":"2025-04-16"}`, 1)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "at most two decimals")
+
+	// so do account balances and bill payments
+	assert.Equal(t, http.StatusBadRequest, sendJSON(r, "POST", "/accounts", `{"name":"Yen","type":"cash","currency":"JPY","opening_balance":"100.50"}`, 1).Code)
+	assert.Equal(t, http.StatusOK, sendJSON(r, "POST", "/accounts", `{"name":"Yen","type":"cash","currency":"JPY","opening_balance":"100"}`, 1).Code)
+	assert.Equal(t, http.StatusOK, sendJSON(r, "POST", "/bills", `{"name":"Rent","amount":"80000","currency":"JPY","category":"Home","due_date":"2025-04-30"}`, 1).Code)
+	w = sendJSON(r, "POST", "/bills/1/payments", `{"amount":"0.50"}`, 1)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "whole number of JPY")
+	assert.Equal(t, http.StatusOK, sendJSON(r, "POST", "/bills/1/payments", `{"amount":"500"}`, 1).Code)
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	_ "time/tzdata" // user timezones must resolve on hosts without zoneinfo
+)
+
+// dateLayout is the wire and storage format of a Date.
+const dateLayout = "2006-01-02"
+
+// Date is a calendar day with no time of day or zone, such as the day a
+// transaction happened. It is stored in a DATE column and travels over JSON
+// as "YYYY-MM-DD". The zero Date means "not set".
+type Date struct {
+	t time.Time // midnight UTC
+}
+
+func NewDate(year int, month time.Month, day int) Date {
+	return Date{time.Date(year, month, day, 0, 0, 0, 0, time.UTC)}
+}
+
+// DateOf returns the calendar day t falls on in t's own location.
+func DateOf(t time.Time) Date {
+	return NewDate(t.Date())
+}
+
+func ParseDate(s string) (Date, error) {
+	t, err := time.Parse(dateLayout, s)
+	if err != nil {
+		return Date{}, fmt.Errorf("date must be formatted as YYYY-MM-DD")
+	}
+	return Date{t}, nil
+}
+
+func (d Date) IsZero() bool          { return d.t.IsZero() }
+func (d Date) Before(o Date) bool    { return d.t.Before(o.t) }
+func (d Date) After(o Date) bool     { return d.t.After(o.t) }
+func (d Date) AddDays(n int) Date    { return Date{d.t.AddDate(0, 0, n)} }
+func (d Date) AddMonths(n int) Date  { return Date{d.t.AddDate(0, n, 0)} }
+func (d Date) Year() int             { return d.t.Year() }
+func (d Date) Month() time.Month     { return d.t.Month() }
+func (d Date) Day() int              { return d.t.Day() }
+func (d Date) Weekday() time.Weekday { return d.t.Weekday() }
+func (d Date) Time() time.Time       { return d.t }
+func (d Date) DaysUntil(o Date) int  { return int(o.t.Sub(d.t).Hours() / 24) }
+func (d Date) In(loc *time.Location) time.Time {
+	return time.Date(d.t.Year(), d.t.Month(), d.t.Day(), 0, 0, 0, 0, loc)
+}
+
+// String formats d as YYYY-MM-DD, or "" for the zero Date.
+func (d Date) String() string {
+	if d.IsZero() {
+		return ""
+	}
+	return d.t.Format(dateLayout)
+}
+
+func (d Date) MarshalJSON() ([]byte, error) {
+	if d.IsZero() {
+		return []byte("null"), nil
+	}
+	return []byte(strconv.Quote(d.String())), nil
+}
+
+func (d *Date) UnmarshalJSON(data []byte) error {
+	s := string(data)
+	if s == "null" || s == `""` {
+		*d = Date{}
+		return nil
+	}
+	s, err := strconv.Unquote(s)
+	if err != nil {
+		return fmt.Errorf("date must be a string")
+	}
+	parsed, err := ParseDate(s)
+	if err != nil {
+		return err
+	}
+	*d = parsed
+	return nil
+}
+
+func (Date) GormDataType() string {
+	return "date"
+}
+
+// Value stores d as text so that it compares correctly on every driver.
+func (d Date) Value() (driver.Value, error) {
+	if d.IsZero() {
+		return nil, nil
+	}
+	return d.String(), nil
+}
+
+func (d *Date) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*d = Date{}
+		return nil
+	case time.Time:
+		*d = NewDate(v.UTC().Date())
+		return nil
+	case []byte:
+		value = string(v)
+	}
+	s, ok := value.(string)
+	if !ok {
+		return fmt.Errorf("cannot scan %T into Date", value)
+	}
+	if len(s) > len(dateLayout) {
+		s = s[:len(dateLayout)]
+	}
+	parsed, err := ParseDate(strings.TrimSpace(s))
+	if err != nil {
+		return err
+	}
+	*d = parsed
+	return nil
+}
+
+// userLocation returns the time zone the user has chosen, or UTC.
+func userLocation(userID uint) *time.Location {
+	var user User
+	if err := db.Select("timezone").First(&user, userID).Error; err != nil {
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(user.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// today returns the current calendar day in the user's time zone.
+func today(userID uint) Date {
+	return DateOf(time.Now().In(userLocation(userID)))
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestDateJSONAndScan(t *testing.T) {
+	var v struct {
+		D Date `json:"d"`
+	}
+	assert.NoError(t, json.Unmarshal([]byte(`{"d":"2025-02-28"}`), &v))
+	assert.Equal(t, NewDate(2025, time.February, 28), v.D)
+	assert.Equal(t, NewDate(2025, time.March, 1), v.D.AddDays(1))
+	assert.Equal(t, 1, v.D.DaysUntil(v.D.AddDays(1)))
+
+	out, _ := json.Marshal(v)
+	assert.JSONEq(t, `{"d":"2025-02-28"}`, string(out))
+
+	assert.NoError(t, json.Unmarshal([]byte(`{"d":null}`), &v))
+	assert.True(t, v.D.IsZero())
+	out, _ = json.Marshal(v)
+	assert.JSONEq(t, `{"d":null}`, string(out))
+
+	assert.Error(t, json.Unmarshal([]byte(`{"d":"2025-02-30"}`), &v))
+	assert.Error(t, json.Unmarshal([]byte(`{"d":"28/02/2025"}`), &v))
+	assert.Error(t, json.Unmarshal([]byte(`{"d":20250228}`), &v))
+
+	var d Date
+	assert.NoError(t, d.Scan(time.Date(2025, 4, 20, 0, 0, 0, 0, time.UTC)))
+	assert.Equal(t, "2025-04-20", d.String())
+	assert.NoError(t, d.Scan([]byte("2025-04-21")))
+	assert.Equal(t, "2025-04-21", d.String())
+	assert.NoError(t, d.Scan("2025-04-22 00:00:00+00:00"))
+	assert.Equal(t, "2025-04-22", d.String())
+	assert.Error(t, d.Scan(42))
+
+	// the calendar day depends on the zone
+	tokyo, _ := time.LoadLocation("Asia/Tokyo")
+	instant := time.Date(2025, 4, 20, 20, 0, 0, 0, time.UTC)
+	assert.Equal(t, "2025-04-20", DateOf(instant).String())
+	assert.Equal(t, "2025-04-21", DateOf(instant.In(tokyo)).String())
+}
+
+func TestMigrateDateColumns(t *testing.T) {
+	var err error
+	db, err = gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	assert.NoError(t, err)
+
+	// the schema as it was with free-form strings
+	db.Exec(`CREATE TABLE expenses (id integer PRIMARY KEY, user_id integer, amount bigint, category text, description text, date text, created_at text, paid numeric)`)
+	db.Exec(`CREATE TABLE budgets (id integer PRIMARY KEY, user_id integer, budget_name text, budget_amount bigint, start_date text, end_date text, notes text, created_at text)`)
+	db.Exec(`INSERT INTO expenses (id, user_id, amount, category, date, created_at) VALUES
+		(1, 1, 100, 'c', '2025-04-20', '2025-04-20T09:15:00.123Z'),
+		(2, 1, 100, 'c', '04/21/2025', ''),
+		(3, 1, 100, 'c', 'last tuesday', 'soon')`)
+	db.Exec(`INSERT INTO budgets (id, user_id, budget_name, budget_amount, start_date, end_date) VALUES (1, 1, 'b', 100, '2025-04-01', '2025-04-30')`)
+
+	unparsed, err := migrateDateColumns(db)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []unparsedValue{
+		{"expenses", "date", 3, "last tuesday"},
+		{"expenses", "created_at", 3, "soon"},
+	}, unparsed)
+
+	// running it again is a no-op
+	unparsed, err = migrateDateColumns(db)
+	assert.NoError(t, err)
+	assert.Empty(t, unparsed)
+	assert.NoError(t, db.AutoMigrate(&Expense{}, &Budget{}))
+
+	var expenses []Expense
+	assert.NoError(t, db.Order("id").Find(&expenses).Error)
+	assert.Len(t, expenses, 3)
+	assert.Equal(t, "2025-04-20", expenses[0].Date.String())
+	assert.True(t, time.Date(2025, 4, 20, 9, 15, 0, 123e6, time.UTC).Equal(expenses[0].CreatedAt))
+	assert.Equal(t, "2025-04-21", expenses[1].Date.String())
+	assert.True(t, expenses[2].Date.IsZero())
+
+	// the converted column supports range queries
+	var count int64
+	db.Model(&Expense{}).Where("date BETWEEN ? AND ?", mustDate("2025-04-21"), mustDate("2025-04-30")).Count(&count)
+	assert.EqualValues(t, 1, count)
+
+	var b Budget
+	db.First(&b, 1)
+	assert.Equal(t, "2025-04-30", b.EndDate.String())
+}
+
+func TestTimezoneAndServerTimestamps(t *testing.T) {
+	setupTestDB()
+	r := setupRouter()
+	db.Create(&User{FullName: "A", Username: "a", Email: "a@x.com", Password: "p", Timezone: "UTC"})
+
+	req := withAuth(httptest.NewRequest("PUT", "/users/1/timezone", bytes.NewBufferString(`{"timezone":"Pacific/Kiritimati"}`)), 1)
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	req = withAuth(httptest.NewRequest("PUT", "/users/1/timezone", bytes.NewBufferString(`{"timezone":"Mars/Olympus"}`)), 1)
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// no date means today in the user's zone; created_at is the server's
+	before := time.Now()
+	req = withAuth(httptest.NewRequest("POST", "/expenses", bytes.NewBufferString(
+		`{"amount":5,"category":"c","created_at":"1999-01-01T00:00:00Z"}`,
+	)), 1)
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var e Expense
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &e))
+	kiritimati, _ := time.LoadLocation("Pacific/Kiritimati")
+	assert.Equal(t, DateOf(time.Now().In(kiritimati)), e.Date)
+	assert.False(t, e.CreatedAt.Before(before.Add(-time.Second)))
+}
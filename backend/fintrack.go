@@ -11,7 +11,6 @@ import (
 	"os"
 	"strings"
 	"time"
-	"strconv"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
@@ -34,39 +33,77 @@ type User struct {
 	Username string `json:"username" gorm:"unique;not null"`
 	Email    string `json:"email" gorm:"unique;not null"`
 	Password string `json:"password" gorm:"not null"`
+	// BaseCurrency is the currency reports and totals are converted to
+	BaseCurrency string `json:"base_currency" gorm:"size:3;not null;default:USD"`
+	// Timezone is an IANA zone name deciding which calendar day "today" is
+	Timezone string `json:"timezone" gorm:"not null;default:UTC"`
 }
 
 // Expense struct
 type Expense struct {
-	ID          uint    `json:"id" gorm:"primaryKey"`
-	UserID      uint    `json:"user_id"`
-	Amount      float64 `json:"amount"`
-	Category    string  `json:"category"`
-	Description string  `json:"description"`
-	Date        string  `json:"date"`
-	CreatedAt   string  `json:"created_at"`
-	Paid        bool    `json: "Paid"`
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	UserID      uint      `json:"user_id"`
+	Amount      Money     `json:"amount"`
+	Currency    string    `json:"currency" gorm:"size:3;not null;default:USD"`
+	CategoryID  *uint     `json:"category_id" gorm:"index"`
+	Category    string    `json:"category"` // name of CategoryID
+	Description string    `json:"description"`
+	AccountID   *uint     `json:"account_id" gorm:"index"`
+	Date        Date      `json:"date" gorm:"index"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	Paid        bool      `json:"Paid"`
+	Tags        []Tag     `json:"tags" gorm:"many2many:expense_tags"`
+	// Splits, when present, spread the amount over several categories.
+	Splits []ExpenseSplit `json:"splits"`
+	// RecurringRuleID and Occurrence link an expense to the rule that
+	// generated it; the pair is unique so that each occurrence is booked once.
+	RecurringRuleID *uint `json:"recurring_rule_id" gorm:"uniqueIndex:idx_expense_occurrence"`
+	Occurrence      Date  `json:"occurrence" gorm:"uniqueIndex:idx_expense_occurrence"`
+	// ExternalID identifies an imported transaction at its source, such as
+	// a bank's FITID, so that importing it again is recognised.
+	ExternalID *string `json:"external_id,omitempty" gorm:"index"`
+	// ImportBatchID is the import that saved the expense; undoing the
+	// import deletes it.
+	ImportBatchID *uint `json:"import_batch_id,omitempty" gorm:"index"`
 }
 
 type Budget struct {
-	ID           uint    `json:"id" gorm:"primaryKey"`
-	UserID       uint    `json:"user_id"`
-	BudgetName   string  `json:"budget_name"`
-	BudgetAmount float64 `json:"budget_amount"`
-	StartDate    string  `json:"start_date"`
-	EndDate      string  `json:"end_date"`
-	Notes        string  `json:"notes"`
-	CreatedAt    string  `json:"created_at"`
+	ID           uint      `json:"id" gorm:"primaryKey"`
+	UserID       uint      `json:"user_id"`
+	BudgetName   string    `json:"budget_name"`
+	BudgetAmount Money     `json:"budget_amount"`
+	Currency     string    `json:"currency" gorm:"size:3;not null;default:USD"`
+	StartDate    Date      `json:"start_date"`
+	EndDate      Date      `json:"end_date"`
+	Notes        string    `json:"notes"`
+	// Categories limits the expenses counted against the budget; empty
+	// counts them all.
+	Categories []string        `json:"categories" gorm:"type:text;serializer:json"`
+	CreatedAt  time.Time       `json:"created_at"`
+	UpdatedAt  time.Time       `json:"updated_at"`
+	Progress   *BudgetProgress `json:"progress,omitempty" gorm:"-"`
 }
 
 type Income struct {
-	ID          uint    `json:"id" gorm:"primaryKey"`
-	UserID      uint    `json:"user_id"`
-	Amount      float64 `json:"amount"`
-	Category    string  `json:"category"`
-	Description string  `json:"description"`
-	Date        string  `json:"date"`
-	CreatedAt   string  `json:"created_at"`
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	UserID      uint      `json:"user_id"`
+	Amount      Money     `json:"amount"`
+	Currency    string    `json:"currency" gorm:"size:3;not null;default:USD"`
+	CategoryID  *uint     `json:"category_id" gorm:"index"`
+	Category    string    `json:"category"` // name of CategoryID
+	Description string    `json:"description"`
+	AccountID   *uint     `json:"account_id" gorm:"index"`
+	Date        Date      `json:"date" gorm:"index"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	Tags        []Tag     `json:"tags" gorm:"many2many:income_tags"`
+	// RecurringRuleID and Occurrence work as they do on Expense.
+	RecurringRuleID *uint `json:"recurring_rule_id" gorm:"uniqueIndex:idx_income_occurrence"`
+	Occurrence      Date  `json:"occurrence" gorm:"uniqueIndex:idx_income_occurrence"`
+	// ExternalID and ImportBatchID work as they do on Expense.
+	ExternalID    *string `json:"external_id,omitempty" gorm:"index"`
+	ImportBatchID *uint   `json:"import_batch_id,omitempty" gorm:"index"`
 }
 
 func initEnv() {
@@ -87,6 +124,9 @@ func initEnv() {
 	}
 
 	jwtKey = []byte(os.Getenv("JWT_SECRET"))
+	if len(jwtKey) == 0 {
+		log.Fatal("JWT_SECRET must be set")
+	}
 }
 
 func initDB() {
@@ -96,19 +136,41 @@ func initDB() {
 	if err != nil {
 		log.Fatalf("Failed to connect to database: %v", err)
 	}
-	db.AutoMigrate(&User{}, &Expense{}, &Budget{}, &Income{})
+	if err := migrateMoneyColumns(db); err != nil {
+		log.Fatalf("Failed to migrate amounts: %v", err)
+	}
+	unparsed, err := migrateDateColumns(db)
+	if err != nil {
+		log.Fatalf("Failed to migrate dates: %v", err)
+	}
+	for _, u := range unparsed {
+		log.Printf("migrate %s.%s: row %d has unparseable value %q, left empty", u.Table, u.Column, u.ID, u.Value)
+	}
+	db.AutoMigrate(&User{}, &Expense{}, &Budget{}, &Income{}, &Session{}, &LoginCode{}, &ExchangeRate{}, &Category{}, &Tag{}, &ExpenseSplit{}, &RecurringRule{}, &RecurringOverride{}, &Bill{}, &BillPayment{}, &Account{}, &Transfer{}, &ImportBatch{}, &CalendarFeed{}, &TransactionRule{})
+	if err := migrateCategoryNames(db); err != nil {
+		log.Fatalf("Failed to migrate categories: %v", err)
+	}
+
+	if path := os.Getenv("EXCHANGE_RATES_FILE"); path != "" {
+		n, err := loadExchangeRates(db, path)
+		if err != nil {
+			log.Fatalf("Failed to load exchange rates: %v", err)
+		}
+		log.Printf("Loaded %d exchange rates from %s", n, path)
+	}
 }
 
 func main() {
 	initEnv()
 	initDB()
+	go runScheduler(context.Background(), time.Hour)
 	router := gin.Default()
 
 	// Enable CORS for all routes
 	router.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"*"},
-		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Content-Type"},
+		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowHeaders:     []string{"Content-Type", "Authorization"},
 		AllowCredentials: true,
 		MaxAge:           12 * time.Hour,
 	}))
@@ -116,20 +178,102 @@ func main() {
 	router.GET("/oauth2/callback", HandleGoogleCallback)
 	router.POST("/register", RegisterUser)
 	router.POST("/login", LoginUser)
-	router.POST("/expenses", AddExpense)
-	router.GET("/expenses", GetExpenses)
-	router.POST("/budget", SetBudget)
-	router.GET("/budget", GetBudgetDetails)
-	router.DELETE("/budget/:id", DeleteBudget)
-	router.DELETE("/expenses/:id", DeleteExpense)
-	router.POST("/incomes", AddIncome)
-	router.GET("/incomes", GetIncomes)
-	router.DELETE("/incomes/:id", DeleteIncome)
-	router.PUT("/expenses/:id/paid", UpdateExpenseStatus)
-	router.GET("/users/:id", GetUser)
-	router.PUT("/users/:id/username", UpdateUsername)
-	router.PUT("/users/:id/password", UpdatePassword)
-	router.PUT("/users/:id/email", UpdateEmail)
+	router.POST("/login/google/exchange", ExchangeLoginCode)
+	router.POST("/auth/refresh", RefreshSession)
+	router.POST("/auth/logout", Logout)
+	router.GET("/ical/:file", ServeCalendarFeed)
+
+	// Everything below requires a valid JWT and is scoped to its user
+	auth := router.Group("/", AuthMiddleware())
+	auth.POST("/expenses", AddExpense)
+	auth.GET("/expenses", GetExpenses)
+	auth.POST("/budget", SetBudget)
+	auth.GET("/budget", GetBudgetDetails)
+	auth.PUT("/budget/:id", UpdateBudget)
+	auth.PATCH("/budget/:id", UpdateBudget)
+	auth.DELETE("/budget/:id", DeleteBudget)
+	auth.GET("/budget/:id/progress", GetBudgetProgress)
+	auth.PUT("/expenses/:id", UpdateExpense)
+	auth.PATCH("/expenses/:id", UpdateExpense)
+	auth.DELETE("/expenses/:id", DeleteExpense)
+	auth.POST("/incomes", AddIncome)
+	auth.GET("/incomes", GetIncomes)
+	auth.PUT("/incomes/:id", UpdateIncome)
+	auth.PATCH("/incomes/:id", UpdateIncome)
+	auth.DELETE("/incomes/:id", DeleteIncome)
+	auth.PUT("/expenses/:id/paid", UpdateExpenseStatus)
+	auth.GET("/users/:id", GetUser)
+	auth.PUT("/users/:id/username", UpdateUsername)
+	auth.PUT("/users/:id/password", UpdatePassword)
+	auth.PUT("/users/:id/email", UpdateEmail)
+	auth.PUT("/users/:id/base-currency", UpdateBaseCurrency)
+	auth.PUT("/users/:id/timezone", UpdateTimezone)
+	auth.GET("/categories", GetCategories)
+	auth.POST("/categories", AddCategory)
+	auth.PUT("/categories/:id", UpdateCategory)
+	auth.PATCH("/categories/:id", UpdateCategory)
+	auth.DELETE("/categories/:id", DeleteCategory)
+	auth.GET("/tags", GetTags)
+	auth.POST("/tags", AddTag)
+	auth.PUT("/tags/:id", RenameTag)
+	auth.PATCH("/tags/:id", RenameTag)
+	auth.POST("/tags/:id/merge", MergeTag)
+	auth.DELETE("/tags/:id", DeleteTag)
+	auth.GET("/recurring", GetRecurringRules)
+	auth.POST("/recurring", AddRecurringRule)
+	auth.PUT("/recurring/:id", UpdateRecurringRule)
+	auth.PATCH("/recurring/:id", UpdateRecurringRule)
+	auth.DELETE("/recurring/:id", DeleteRecurringRule)
+	auth.GET("/recurring/:id/preview", PreviewRecurringRule)
+	auth.PUT("/recurring/:id/occurrences/:date", SetRecurringOverride)
+	auth.DELETE("/recurring/:id/occurrences/:date", DeleteRecurringOverride)
+	auth.GET("/rules", GetTransactionRules)
+	auth.POST("/rules", AddTransactionRule)
+	auth.PUT("/rules/:id", UpdateTransactionRule)
+	auth.PATCH("/rules/:id", UpdateTransactionRule)
+	auth.DELETE("/rules/:id", DeleteTransactionRule)
+	auth.POST("/rules/apply", ApplyTransactionRules)
+	auth.GET("/bills", GetBills)
+	auth.GET("/bills/upcoming", GetUpcomingBills)
+	auth.POST("/bills", AddBill)
+	auth.PUT("/bills/:id", UpdateBill)
+	auth.PATCH("/bills/:id", UpdateBill)
+	auth.DELETE("/bills/:id", DeleteBill)
+	auth.POST("/bills/:id/payments", AddBillPayment)
+	auth.DELETE("/bills/:id/payments/:paymentId", DeleteBillPayment)
+	auth.GET("/accounts", GetAccounts)
+	auth.POST("/accounts", AddAccount)
+	auth.PUT("/accounts/:id", UpdateAccount)
+	auth.PATCH("/accounts/:id", UpdateAccount)
+	auth.DELETE("/accounts/:id", DeleteAccount)
+	auth.GET("/accounts/:id/balance", GetAccountBalance)
+	auth.GET("/accounts/:id/ledger", GetAccountLedger)
+	auth.GET("/transfers", GetTransfers)
+	auth.POST("/transfers", AddTransfer)
+	auth.PUT("/transfers/:id", UpdateTransfer)
+	auth.PATCH("/transfers/:id", UpdateTransfer)
+	auth.DELETE("/transfers/:id", DeleteTransfer)
+	auth.POST("/import/csv", ImportCSV)
+	auth.POST("/import/ofx", ImportOFX)
+	auth.POST("/import/qif", ImportQIF)
+	auth.POST("/import/camt053", ImportCAMT053)
+	auth.POST("/import/mt940", ImportMT940)
+	auth.GET("/imports", GetImportBatches)
+	auth.GET("/imports/:id", GetImportBatch)
+	auth.DELETE("/imports/:id", DeleteImportBatch)
+	auth.POST("/import/archive", RestoreArchive)
+	auth.GET("/export", ExportArchive)
+	auth.GET("/export/ledger", ExportLedger)
+	auth.GET("/export/transactions", ExportTransactions)
+	auth.GET("/calendar/feed", GetCalendarFeed)
+	auth.POST("/calendar/feed", CreateCalendarFeed)
+	auth.DELETE("/calendar/feed", RevokeCalendarFeed)
+	auth.GET("/reports/totals", GetTotals)
+	auth.GET("/reports/cashflow", GetCashflow)
+	auth.GET("/reports/categories", GetCategoryReport)
+	auth.GET("/reports/merchants", GetMerchantReport)
+	auth.GET("/auth/sessions", GetSessions)
+	auth.DELETE("/auth/sessions/:id", RevokeSession)
 
 	router.Run(":8080")
 }
@@ -175,23 +319,36 @@ func HandleGoogleCallback(c *gin.Context) {
 	var user User
 	if err := db.Where("email = ?", email).First(&user).Error; err != nil {
 		user = User{
-			FullName: fullName,
-			Username: strings.Split(email, "@")[0],
-			Email:    email,
-			Password: "google-oauth",
+			FullName:     fullName,
+			Username:     strings.Split(email, "@")[0],
+			Email:        email,
+			Password:     "google-oauth",
+			BaseCurrency: defaultCurrency,
+			Timezone:     "UTC",
+		}
+		if err := createUser(&user); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
+			return
 		}
-		db.Create(&user)
 	}
 
-	tokenStr := generateJWT(email, user.ID)
-	c.Redirect(http.StatusSeeOther, "http://localhost:4200/dashboard?token="+tokenStr)
+	// Tokens in a URL end up in history, logs and Referer headers, so the
+	// SPA gets a one-time code to exchange for them instead
+	code, err := issueLoginCode(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start session"})
+		return
+	}
+	c.Redirect(http.StatusSeeOther, "http://localhost:4200/dashboard?code="+code)
 }
 
-func generateJWT(email string, userID uint) string {
+// generateJWT issues a short-lived access token for the given session family.
+func generateJWT(email string, userID uint, sessionID string) string {
 	claims := jwt.MapClaims{
 		"email":  email,
 		"userId": userID,
-		"exp":    time.Now().Add(24 * time.Hour).Unix(),
+		"sid":    sessionID,
+		"exp":    time.Now().Add(accessTokenTTL).Unix(),
 	}
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	signed, _ := token.SignedString(jwtKey)
@@ -211,6 +368,22 @@ func RegisterUser(c *gin.Context) {
 		return
 	}
 
+	user.BaseCurrency = strings.ToUpper(user.BaseCurrency)
+	if user.BaseCurrency == "" {
+		user.BaseCurrency = defaultCurrency
+	}
+	if !validCurrency(user.BaseCurrency) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errInvalidCurrency.Error()})
+		return
+	}
+	if user.Timezone == "" {
+		user.Timezone = "UTC"
+	}
+	if _, err := time.LoadLocation(user.Timezone); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown timezone"})
+		return
+	}
+
 	var existingUser User
 	// Check if the username already exists
 	if err := db.Where("username = ?", user.Username).First(&existingUser).Error; err == nil {
@@ -233,7 +406,7 @@ func RegisterUser(c *gin.Context) {
 	user.Password = string(hashedPassword)
 
 	// Save user to DB
-	if err := db.Create(&user).Error; err != nil {
+	if err := createUser(&user); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
 		return
 	}
@@ -263,19 +436,24 @@ func LoginUser(c *gin.Context) {
 		return
 	}
 
-	// Login successful, return user ID along with success message
+	token, refresh, err := startSession(c, user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start session"})
+		return
+	}
+
+	// Login successful, return the session tokens along with the user ID
 	c.JSON(http.StatusOK, gin.H{
-		"message": "Login successful",
-		"userId":  user.ID, // Assuming user.ID is the user ID from the database
+		"message":       "Login successful",
+		"userId":        user.ID,
+		"token":         token,
+		"refresh_token": refresh,
 	})
 }
 
 func GetUser(c *gin.Context) {
-	// parse URL param
-	idParam := c.Param("id")
-	id, err := strconv.ParseUint(idParam, 10, 32)
-	if err != nil {
-	  c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+	id, ok := authorizeUserParam(c)
+	if !ok {
 	  return
 	}
   
@@ -290,10 +468,8 @@ func GetUser(c *gin.Context) {
   }
   
   func UpdateUsername(c *gin.Context) {
-	idParam := c.Param("id")
-	id, err := strconv.ParseUint(idParam, 10, 32)
-	if err != nil {
-	  c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+	id, ok := authorizeUserParam(c)
+	if !ok {
 	  return
 	}
   
@@ -329,10 +505,8 @@ func GetUser(c *gin.Context) {
   }
   
   func UpdatePassword(c *gin.Context) {
-	idParam := c.Param("id")
-	id, err := strconv.ParseUint(idParam, 10, 32)
-	if err != nil {
-	  c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+	id, ok := authorizeUserParam(c)
+	if !ok {
 	  return
 	}
   
@@ -367,15 +541,19 @@ func GetUser(c *gin.Context) {
 	  c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update password"})
 	  return
 	}
+
+	// sign out every other device
+	if err := revokeSessions(db, user.ID, "family_id <> ?", currentSessionID(c)); err != nil {
+	  c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to end other sessions"})
+	  return
+	}
   
 	c.JSON(http.StatusOK, gin.H{"message": "Password updated successfully"})
   }
   
   func UpdateEmail(c *gin.Context) {
-	idParam := c.Param("id")
-	id, err := strconv.ParseUint(idParam, 10, 32)
-	if err != nil {
-	  c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+	id, ok := authorizeUserParam(c)
+	if !ok {
 	  return
 	}
   
@@ -409,19 +587,195 @@ func GetUser(c *gin.Context) {
   }
   
 
+func UpdateBaseCurrency(c *gin.Context) {
+	id, ok := authorizeUserParam(c)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		BaseCurrency string `json:"base_currency"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	input.BaseCurrency = strings.ToUpper(input.BaseCurrency)
+	if !validCurrency(input.BaseCurrency) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errInvalidCurrency.Error()})
+		return
+	}
+
+	var user User
+	if err := db.First(&user, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	// Only the reporting currency changes; stored amounts keep their own
+	user.BaseCurrency = input.BaseCurrency
+	if err := db.Save(&user).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update base currency"})
+		return
+	}
+
+	user.Password = ""
+	c.JSON(http.StatusOK, gin.H{"message": "Base currency updated successfully", "user": user})
+}
+
+func UpdateTimezone(c *gin.Context) {
+	id, ok := authorizeUserParam(c)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Timezone string `json:"timezone"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	if _, err := time.LoadLocation(input.Timezone); err != nil || input.Timezone == "" || input.Timezone == "Local" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown timezone"})
+		return
+	}
+
+	var user User
+	if err := db.First(&user, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	user.Timezone = input.Timezone
+	if err := db.Save(&user).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update timezone"})
+		return
+	}
+
+	user.Password = ""
+	c.JSON(http.StatusOK, gin.H{"message": "Timezone updated successfully", "user": user})
+}
+
 func AddExpense(c *gin.Context) {
 	var expense Expense
 	if err := c.ShouldBindJSON(&expense); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
 		return
 	}
-	db.Create(&expense)
+	expense.ID = 0
+	expense.UserID = currentUserID(c)
+	expense.CreatedAt = time.Time{}
+	expense.RecurringRuleID, expense.Occurrence, expense.ExternalID, expense.ImportBatchID = nil, Date{}, nil, nil
+	for i := range expense.Splits {
+		expense.Splits[i].ID, expense.Splits[i].ExpenseID = 0, 0
+	}
+	if expense.Date.IsZero() {
+		expense.Date = today(expense.UserID)
+	}
+	expense.Currency = currencyFor(expense.UserID, expense.Currency)
+	rules, err := loadRules(expense.UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load rules"})
+		return
+	}
+	// Rules fill in the category only when the request gave none
+	rules.expense(&expense)
+	if err := expense.validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := checkAccount(expense.UserID, expense.AccountID, expense.Currency); err != nil {
+		accountError(c, err)
+		return
+	}
+	if err := expense.resolveCategory(); err != nil {
+		categoryError(c, err)
+		return
+	}
+	tags, err := resolveTags(expense.UserID, expense.Tags)
+	if err != nil {
+		tagError(c, err)
+		return
+	}
+	expense.Tags = tags
+	if err := db.Create(&expense).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save expense"})
+		return
+	}
 	c.JSON(http.StatusOK, expense)
 }
 
+func UpdateExpense(c *gin.Context) {
+	var expense Expense
+	if !findOwned(c, &expense, "Expense not found") {
+		return
+	}
+	if err := db.Preload("Tags").Preload("Splits").First(&expense, expense.ID).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load expense"})
+		return
+	}
+
+	var updated Expense
+	if err := bindUpdate(c, expense, &updated); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	updated.ID, updated.UserID, updated.CreatedAt = expense.ID, expense.UserID, expense.CreatedAt
+	updated.RecurringRuleID, updated.Occurrence, updated.ExternalID = expense.RecurringRuleID, expense.Occurrence, expense.ExternalID
+	updated.ImportBatchID = expense.ImportBatchID
+	updated.Currency = currencyFor(updated.UserID, updated.Currency)
+	if renamedOnly(updated.CategoryID, expense.CategoryID, updated.Category, expense.Category) {
+		updated.CategoryID = nil
+	}
+	if err := updated.validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := checkAccount(updated.UserID, updated.AccountID, updated.Currency); err != nil {
+		accountError(c, err)
+		return
+	}
+	if err := updated.resolveCategory(); err != nil {
+		categoryError(c, err)
+		return
+	}
+	tags, err := resolveTags(updated.UserID, updated.Tags)
+	if err != nil {
+		tagError(c, err)
+		return
+	}
+	updated.Tags = tags
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Tags", "Splits").Save(&updated).Error; err != nil {
+			return err
+		}
+		if err := replaceSplits(tx, &updated); err != nil {
+			return err
+		}
+		return tx.Model(&updated).Association("Tags").Replace(updated.Tags)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update expense"})
+		return
+	}
+	c.JSON(http.StatusOK, updated)
+}
+
 func DeleteExpense(c *gin.Context) {
-	expenseID := c.Param("id")
-	if err := db.Delete(&Expense{}, expenseID).Error; err != nil {
+	var expense Expense
+	if !findOwned(c, &expense, "Expense not found") {
+		return
+	}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// A bill payment booked as this expense stays on the bill.
+		if err := tx.Model(&BillPayment{}).Where("expense_id = ?", expense.ID).Update("expense_id", nil).Error; err != nil {
+			return err
+		}
+		return tx.Select("Tags", "Splits").Delete(&expense).Error
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete expense"})
 		return
 	}
@@ -429,26 +783,37 @@ func DeleteExpense(c *gin.Context) {
 }
 
 func GetExpenses(c *gin.Context) {
-	userID := c.Query("user_id") // Get user ID from query parameter
-	if userID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "User ID is required"})
+	userID := currentUserID(c)
+
+	format, ok := listFormat(c)
+	if !ok {
 		return
 	}
-
-	var expenses []Expense
-	result := db.Where("user_id = ?", userID).Find(&expenses)
-
-	if result.Error != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve expenses"})
+	query, ok := filterExpenses(c, db.Where("user_id = ?", userID))
+	if !ok {
+		return
+	}
+	p, ok := parsePage(c)
+	if !ok {
+		return
+	}
+	if format != "" {
+		exportList[Expense](c, format, kindExpense, query.Preload("Tags").Preload("Splits"), p)
+		return
+	}
+	query, err := p.apply(query)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cursor"})
 		return
 	}
 
-	if len(expenses) == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"message": "No expenses found"})
+	var expenses []Expense
+	if err := query.Preload("Tags").Preload("Splits").Find(&expenses).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve expenses"})
 		return
 	}
 
-	c.JSON(http.StatusOK, expenses)
+	c.JSON(http.StatusOK, newListResponse(expenses, p))
 }
 
 func SetBudget(c *gin.Context) {
@@ -457,6 +822,14 @@ func SetBudget(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
 		return
 	}
+	budget.ID = 0
+	budget.UserID = currentUserID(c)
+	budget.CreatedAt = time.Time{}
+	budget.Currency = currencyFor(budget.UserID, budget.Currency)
+	if err := budget.validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
 	if err := db.Create(&budget).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save budget"})
@@ -467,11 +840,7 @@ func SetBudget(c *gin.Context) {
 }
 
 func GetBudgetDetails(c *gin.Context) {
-	userID := c.Query("user_id") // Get user ID from query parameter
-	if userID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "User ID is required"})
-		return
-	}
+	userID := currentUserID(c)
 
 	var budgets []Budget
 	result := db.Where("user_id = ?", userID).Find(&budgets)
@@ -486,6 +855,16 @@ func GetBudgetDetails(c *gin.Context) {
 		return
 	}
 
+	day := today(userID)
+	for i := range budgets {
+		progress, err := budgets[i].progress(day)
+		if err != nil {
+			reportError(c, err)
+			return
+		}
+		budgets[i].Progress = &progress
+	}
+
 	c.JSON(http.StatusOK, budgets)
 }
 
@@ -495,6 +874,39 @@ func AddIncome(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
 		return
 	}
+	income.ID = 0
+	income.UserID = currentUserID(c)
+	income.CreatedAt = time.Time{}
+	income.RecurringRuleID, income.Occurrence, income.ExternalID, income.ImportBatchID = nil, Date{}, nil, nil
+	if income.Date.IsZero() {
+		income.Date = today(income.UserID)
+	}
+	income.Currency = currencyFor(income.UserID, income.Currency)
+	rules, err := loadRules(income.UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load rules"})
+		return
+	}
+	// Rules fill in the category only when the request gave none
+	rules.income(&income)
+	if err := income.validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := checkAccount(income.UserID, income.AccountID, income.Currency); err != nil {
+		accountError(c, err)
+		return
+	}
+	if err := income.resolveCategory(); err != nil {
+		categoryError(c, err)
+		return
+	}
+	tags, err := resolveTags(income.UserID, income.Tags)
+	if err != nil {
+		tagError(c, err)
+		return
+	}
+	income.Tags = tags
 	if err := db.Create(&income).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save income"})
 		return
@@ -503,40 +915,136 @@ func AddIncome(c *gin.Context) {
 }
 
 func GetIncomes(c *gin.Context) {
-	userID := c.Query("user_id") // Get user ID from query parameter
-	if userID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "User ID is required"})
+	userID := currentUserID(c)
+
+	format, ok := listFormat(c)
+	if !ok {
+		return
+	}
+	query, ok := filterTransactions(c, db.Where("user_id = ?", userID), kindIncome)
+	if !ok {
+		return
+	}
+	p, ok := parsePage(c)
+	if !ok {
+		return
+	}
+	if format != "" {
+		exportList[Income](c, format, kindIncome, query.Preload("Tags"), p)
+		return
+	}
+	query, err := p.apply(query)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cursor"})
 		return
 	}
 
 	var incomes []Income
-	result := db.Where("user_id = ?", userID).Find(&incomes)
-
-	if result.Error != nil {
+	if err := query.Preload("Tags").Find(&incomes).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve incomes"})
 		return
 	}
 
-	if len(incomes) == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"message": "No incomes found"})
+	c.JSON(http.StatusOK, newListResponse(incomes, p))
+}
+
+func UpdateIncome(c *gin.Context) {
+	var income Income
+	if !findOwned(c, &income, "Income not found") {
+		return
+	}
+	if err := db.Model(&income).Association("Tags").Find(&income.Tags); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load tags"})
 		return
 	}
 
-	c.JSON(http.StatusOK, incomes)
+	var updated Income
+	if err := bindUpdate(c, income, &updated); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	updated.ID, updated.UserID, updated.CreatedAt = income.ID, income.UserID, income.CreatedAt
+	updated.RecurringRuleID, updated.Occurrence, updated.ExternalID = income.RecurringRuleID, income.Occurrence, income.ExternalID
+	updated.ImportBatchID = income.ImportBatchID
+	updated.Currency = currencyFor(updated.UserID, updated.Currency)
+	if renamedOnly(updated.CategoryID, income.CategoryID, updated.Category, income.Category) {
+		updated.CategoryID = nil
+	}
+	if err := updated.validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := checkAccount(updated.UserID, updated.AccountID, updated.Currency); err != nil {
+		accountError(c, err)
+		return
+	}
+	if err := updated.resolveCategory(); err != nil {
+		categoryError(c, err)
+		return
+	}
+	tags, err := resolveTags(updated.UserID, updated.Tags)
+	if err != nil {
+		tagError(c, err)
+		return
+	}
+	updated.Tags = tags
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Tags").Save(&updated).Error; err != nil {
+			return err
+		}
+		return tx.Model(&updated).Association("Tags").Replace(updated.Tags)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update income"})
+		return
+	}
+	c.JSON(http.StatusOK, updated)
 }
 
 func DeleteIncome(c *gin.Context) {
-	incomeID := c.Param("id")
-	if err := db.Delete(&Income{}, incomeID).Error; err != nil {
+	var income Income
+	if !findOwned(c, &income, "Income not found") {
+		return
+	}
+	if err := db.Select("Tags").Delete(&income).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete income"})
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"message": "Income deleted"})
 }
 
+func UpdateBudget(c *gin.Context) {
+	var budget Budget
+	if !findOwned(c, &budget, "Budget not found") {
+		return
+	}
+
+	var updated Budget
+	if err := bindUpdate(c, budget, &updated); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	updated.ID, updated.UserID, updated.CreatedAt = budget.ID, budget.UserID, budget.CreatedAt
+	updated.Currency = currencyFor(updated.UserID, updated.Currency)
+	if err := updated.validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := db.Save(&updated).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update budget"})
+		return
+	}
+	c.JSON(http.StatusOK, updated)
+}
+
 func DeleteBudget(c *gin.Context) {
-	budgetID := c.Param("id")
-	if err := db.Delete(&Budget{}, budgetID).Error; err != nil {
+	var budget Budget
+	if !findOwned(c, &budget, "Budget not found") {
+		return
+	}
+	if err := db.Delete(&budget).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete budget"})
 		return
 	}
@@ -544,11 +1052,8 @@ func DeleteBudget(c *gin.Context) {
 }
 
 func UpdateExpenseStatus(c *gin.Context) {
-	expenseID := c.Param("id")
-
 	var expense Expense
-	if err := db.First(&expense, expenseID).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Expense not found"})
+	if !findOwned(c, &expense, "Expense not found") {
 		return
 	}
 
@@ -0,0 +1,545 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// maxImportRows bounds the number of transactions one import may hold.
+const maxImportRows = 10000
+
+// importRow is one transaction read from an imported file, with whatever
+// was wrong with it. Rows with errors are never saved.
+type importRow struct {
+	Line        int      `json:"line"`
+	Kind        string   `json:"kind"`
+	Date        Date     `json:"date"`
+	Amount      Money    `json:"amount"`
+	Description string   `json:"description"`
+	Category    string   `json:"category"`
+	ExternalID  string   `json:"external_id,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+	Rules       []uint   `json:"rules,omitempty"`     // ids of the rules that matched
+	Duplicate   bool     `json:"duplicate,omitempty"` // imported before; skipped
+	Errors      []string `json:"errors,omitempty"`
+}
+
+func (r *importRow) fail(msg string) {
+	r.Errors = append(r.Errors, msg)
+}
+
+// importSettings are the choices shared by every import format.
+type importSettings struct {
+	Currency        string `json:"currency"`
+	AccountID       *uint  `json:"account_id"`
+	DefaultCategory string `json:"default_category"`
+}
+
+// importResult is the answer to an import, previewed or committed.
+type importResult struct {
+	Rows         []importRow   `json:"rows"`
+	Valid        int           `json:"valid"`
+	Invalid      int           `json:"invalid"`
+	Duplicates   int           `json:"duplicates"`
+	Committed    bool          `json:"committed"`
+	Expenses     int           `json:"expenses"`
+	Incomes      int           `json:"incomes"`
+	BalanceCheck *balanceCheck `json:"balance_check,omitempty"`
+	Batch        *ImportBatch  `json:"batch,omitempty"` // set once committed
+}
+
+// ImportBatch records a committed import, so that it can be listed and
+// undone. Imports that save nothing leave no batch.
+type ImportBatch struct {
+	ID           uint      `json:"id" gorm:"primaryKey"`
+	UserID       uint      `json:"user_id" gorm:"not null;index"`
+	Format       string    `json:"format"`
+	Filename     string    `json:"filename"`
+	Currency     string    `json:"currency"`
+	AccountID    *uint     `json:"account_id"`
+	Expenses     int       `json:"expenses"`
+	Incomes      int       `json:"incomes"`
+	ExpenseTotal Money     `json:"expense_total"`
+	IncomeTotal  Money     `json:"income_total"`
+	Duplicates   int       `json:"duplicates"`
+	Skipped      int       `json:"skipped"` // invalid rows left out
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+func (b ImportBatch) OwnerID() uint { return b.UserID }
+
+// balanceCheck compares the balance a statement reports with the balance
+// the account will have once the import is saved.
+type balanceCheck struct {
+	Date             Date  `json:"date"`
+	StatementBalance Money `json:"statement_balance"`
+	AccountBalance   Money `json:"account_balance"`
+	Matches          bool  `json:"matches"`
+}
+
+// newImportResult sums up rows, first marking those already imported, by
+// their external ids, or repeated within the file, and those whose amount
+// cannot be held in currency.
+func newImportResult(userID uint, currency string, rows []importRow) (importResult, error) {
+	var ids []string
+	for _, row := range rows {
+		if row.ExternalID != "" {
+			ids = append(ids, row.ExternalID)
+		}
+	}
+	seen := map[string]bool{}
+	for _, model := range []interface{}{&Expense{}, &Income{}} {
+		var existing []string
+		for start := 0; start < len(ids); start += 500 {
+			end := min(start+500, len(ids))
+			var batch []string
+			if err := db.Model(model).Where("user_id = ? AND external_id IN ?", userID, ids[start:end]).
+				Pluck("external_id", &batch).Error; err != nil {
+				return importResult{}, err
+			}
+			existing = append(existing, batch...)
+		}
+		for _, id := range existing {
+			seen[id] = true
+		}
+	}
+
+	result := importResult{Rows: rows}
+	for i := range rows {
+		row := &rows[i]
+		if len(row.Errors) == 0 && !row.Amount.fits(currency) {
+			row.fail(fractionError("amount", currency).Error())
+		}
+		switch {
+		case len(row.Errors) > 0:
+			result.Invalid++
+		case row.ExternalID != "" && seen[row.ExternalID]:
+			row.Duplicate = true
+			result.Duplicates++
+		default:
+			result.Valid++
+			if row.ExternalID != "" {
+				seen[row.ExternalID] = true
+			}
+		}
+	}
+	return result, nil
+}
+
+// pending reports whether row will be saved by a commit.
+func (r importRow) pending() bool {
+	return len(r.Errors) == 0 && !r.Duplicate
+}
+
+// statementTransaction is a transaction read from a bank statement file,
+// before it becomes an import row. ID is the bank's identifier for it, if
+// the format has one.
+type statementTransaction struct {
+	ID     string
+	Type   string
+	Date   Date
+	Amount Money // negative for money out
+	Name   string
+	Memo   string
+	// Category is the file's own category, for formats that have one.
+	Category string
+	Errors   []string
+}
+
+// bankStatement is an account statement read from an OFX, QIF, CAMT.053 or
+// MT940 file. Currency is empty when the format does not say.
+type bankStatement struct {
+	Currency      string
+	Account       string
+	Transactions  []statementTransaction
+	LedgerBalance *Money
+	BalanceDate   Date
+}
+
+// rows turns the statement's transactions into import rows. Their external
+// ids combine the format, the account and the bank's transaction id. A
+// transaction without an id is known by a fingerprint of its date, amount
+// and text, numbered to tell identical transactions apart, so the same file
+// is still recognised when it is imported again.
+func (st bankStatement) rows(format, defaultCategory string) []importRow {
+	rows := make([]importRow, 0, len(st.Transactions))
+	seen := map[string]int{}
+	for _, t := range st.Transactions {
+		row := importRow{Kind: kindExpense, Date: t.Date, Category: strings.TrimSpace(t.Category), Errors: t.Errors}
+		if row.Category == "" {
+			row.Category = defaultCategory
+		}
+		row.Description = strings.TrimSpace(t.Name)
+		if row.Description == "" {
+			row.Description = strings.TrimSpace(t.Memo)
+		}
+		id := t.ID
+		if id == "" {
+			sum := sha256.Sum256([]byte(fmt.Sprintf("%s|%d|%s|%s", t.Date, t.Amount, t.Name, t.Memo)))
+			fp := hex.EncodeToString(sum[:8])
+			seen[fp]++
+			id = fmt.Sprintf("%s:%d", fp, seen[fp])
+		}
+		row.ExternalID = format + ":" + st.Account + ":" + id
+		if t.Date.IsZero() && len(t.Errors) == 0 {
+			row.fail("date is missing")
+		}
+		switch {
+		case t.Amount > 0:
+			row.Kind, row.Amount = kindIncome, t.Amount
+		case t.Amount < 0:
+			row.Amount = -t.Amount
+		case len(t.Errors) == 0:
+			row.fail("amount is missing or zero")
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// parseBankAmount reads an amount from a statement format that does not
+// fix the decimal separator: a comma is taken as one when there is no dot.
+func parseBankAmount(s string) (Money, error) {
+	decimal := "."
+	if strings.Contains(s, ",") && !strings.Contains(s, ".") {
+		decimal = ","
+	}
+	return parseStatementAmount(s, decimal)
+}
+
+// checkBalance compares a statement's balance on day with the account's
+// balance on that day once the pending rows are added.
+func (result *importResult) checkBalance(accountID uint, day Date, statement Money) error {
+	var account Account
+	if err := db.First(&account, accountID).Error; err != nil {
+		return err
+	}
+	balance, err := account.balance(day)
+	if err != nil {
+		return err
+	}
+	for _, row := range result.Rows {
+		if !row.pending() || row.Date.After(day) {
+			continue
+		}
+		if row.Kind == kindIncome {
+			balance += row.Amount
+		} else {
+			balance -= row.Amount
+		}
+	}
+	result.BalanceCheck = &balanceCheck{Date: day, StatementBalance: statement, AccountBalance: balance, Matches: balance == statement}
+	return nil
+}
+
+// prepare fills in the settings' defaults and checks the account.
+func (s *importSettings) prepare(userID uint) error {
+	s.Currency = currencyFor(userID, s.Currency)
+	if !validCurrency(s.Currency) {
+		return errInvalidCurrency
+	}
+	s.DefaultCategory = strings.TrimSpace(s.DefaultCategory)
+	if s.DefaultCategory == "" {
+		s.DefaultCategory = "Uncategorized"
+	}
+	return checkAccount(userID, s.AccountID, s.Currency)
+}
+
+// importSettingsError answers settings that prepare rejected.
+func importSettingsError(c *gin.Context, err error) {
+	if errors.Is(err, errInvalidCurrency) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	accountError(c, err)
+}
+
+// commitImport saves the valid rows as expenses and incomes in a single
+// database transaction, filing each under its category and tags by name and
+// creating those that do not exist yet. The rows are linked to a new
+// import batch, which describes what was saved.
+func commitImport(userID uint, batch ImportBatch, settings importSettings, result *importResult) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		tags := map[string]Tag{}
+		tagsNamed := func(names []string) ([]Tag, error) {
+			var found []Tag
+			for _, name := range names {
+				key := strings.ToLower(name)
+				tag, ok := tags[key]
+				if !ok {
+					var err error
+					tag, err = findTagByName(tx, userID, name)
+					if errors.Is(err, gorm.ErrRecordNotFound) {
+						tag = Tag{UserID: userID, Name: name}
+						err = tx.Create(&tag).Error
+					}
+					if err != nil {
+						return nil, err
+					}
+					tags[key] = tag
+				}
+				found = append(found, tag)
+			}
+			return found, nil
+		}
+		categories := map[string]Category{}
+		category := func(kind, name string) (Category, error) {
+			key := kind + "\x00" + strings.ToLower(name)
+			if cat, ok := categories[key]; ok {
+				return cat, nil
+			}
+			cat, err := findCategoryByName(tx, userID, kind, name)
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				cat = Category{UserID: userID, Name: name, Kind: kind}
+				err = tx.Create(&cat).Error
+			}
+			if err != nil {
+				return cat, err
+			}
+			categories[key] = cat
+			return cat, nil
+		}
+
+		batch.UserID, batch.Currency, batch.AccountID = userID, settings.Currency, settings.AccountID
+		batch.Duplicates, batch.Skipped = result.Duplicates, result.Invalid
+		if result.Valid > 0 {
+			if err := tx.Create(&batch).Error; err != nil {
+				return err
+			}
+		}
+
+		var expenses []Expense
+		var incomes []Income
+		for i := range result.Rows {
+			row := &result.Rows[i]
+			if !row.pending() {
+				continue
+			}
+			cat, err := category(row.Kind, row.Category)
+			if err != nil {
+				return err
+			}
+			row.Category = cat.Name
+			rowTags, err := tagsNamed(row.Tags)
+			if err != nil {
+				return err
+			}
+			var externalID *string
+			if row.ExternalID != "" {
+				externalID = &row.ExternalID
+			}
+			if row.Kind == kindIncome {
+				incomes = append(incomes, Income{UserID: userID, Amount: row.Amount, Currency: settings.Currency, AccountID: settings.AccountID,
+					CategoryID: &cat.ID, Category: cat.Name, Description: row.Description, Date: row.Date, ExternalID: externalID, ImportBatchID: &batch.ID, Tags: rowTags})
+				batch.IncomeTotal += row.Amount
+			} else {
+				expenses = append(expenses, Expense{UserID: userID, Amount: row.Amount, Currency: settings.Currency, AccountID: settings.AccountID,
+					CategoryID: &cat.ID, Category: cat.Name, Description: row.Description, Date: row.Date, Paid: true, ExternalID: externalID, ImportBatchID: &batch.ID, Tags: rowTags})
+				batch.ExpenseTotal += row.Amount
+			}
+		}
+		if len(expenses) > 0 {
+			if err := tx.Omit("Tags.*").CreateInBatches(&expenses, 500).Error; err != nil {
+				return err
+			}
+		}
+		if len(incomes) > 0 {
+			if err := tx.Omit("Tags.*").CreateInBatches(&incomes, 500).Error; err != nil {
+				return err
+			}
+		}
+		result.Expenses, result.Incomes, result.Committed = len(expenses), len(incomes), true
+		if batch.ID == 0 {
+			return nil
+		}
+		batch.Expenses, batch.Incomes = len(expenses), len(incomes)
+		result.Batch = &batch
+		return tx.Model(&batch).Select("Expenses", "Incomes", "ExpenseTotal", "IncomeTotal").Updates(&batch).Error
+	})
+}
+
+// finishImport answers an import request: a preview unless commit=true,
+// and a refusal to commit while any row is invalid unless skip_invalid=true.
+// Rows imported before are skipped either way. The user's rules run on the
+// rows first, so the preview shows what will be saved. format names the
+// importer in the import batch.
+func finishImport(c *gin.Context, userID uint, format string, settings importSettings, result importResult) {
+	rules, err := loadRules(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load rules"})
+		return
+	}
+	rules.importRows(result.Rows, settings.AccountID)
+	if c.PostForm("commit") != "true" {
+		c.JSON(http.StatusOK, result)
+		return
+	}
+	if result.Invalid > 0 && c.PostForm("skip_invalid") != "true" {
+		c.JSON(http.StatusUnprocessableEntity, result)
+		return
+	}
+	batch := ImportBatch{Format: format}
+	if header, err := c.FormFile("file"); err == nil {
+		batch.Filename = header.Filename
+	}
+	if err := commitImport(userID, batch, settings, &result); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save imported transactions"})
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// readImportFile returns the contents of the multipart field file, of at
+// most maxSize bytes, or answers the request itself and returns false.
+func readImportFile(c *gin.Context, maxSize int64) (string, bool) {
+	header, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "file is required"})
+		return "", false
+	}
+	if header.Size > maxSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "file is too large"})
+		return "", false
+	}
+	file, err := header.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "file cannot be read"})
+		return "", false
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "file cannot be read"})
+		return "", false
+	}
+	return string(data), true
+}
+
+// bindImportSettings reads the optional JSON field settings into dest.
+func bindImportSettings(c *gin.Context, dest interface{}) bool {
+	s := c.PostForm("settings")
+	if s == "" {
+		return true
+	}
+	if err := json.Unmarshal([]byte(s), dest); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "settings must be a JSON object"})
+		return false
+	}
+	return true
+}
+
+// importStatements answers an import of the statements read from a file.
+// The statements' currency, when the format gives one, overrides the
+// settings'. The balance is checked against the account when there is a
+// single statement with a ledger balance.
+func importStatements(c *gin.Context, format string, settings importSettings, statements []bankStatement) {
+	userID := currentUserID(c)
+	if len(statements) > 1 && settings.AccountID != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "file holds several statements; import them without account_id"})
+		return
+	}
+	if currency := statements[0].Currency; currency != "" {
+		settings.Currency = currency
+	}
+	for _, st := range statements[1:] {
+		if st.Currency != statements[0].Currency {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "statements in one file must share a currency"})
+			return
+		}
+	}
+	if err := settings.prepare(userID); err != nil {
+		importSettingsError(c, err)
+		return
+	}
+
+	var rows []importRow
+	for _, st := range statements {
+		rows = append(rows, st.rows(format, settings.DefaultCategory)...)
+	}
+	if len(rows) > maxImportRows {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("file has more than %d transactions", maxImportRows)})
+		return
+	}
+	for i := range rows {
+		rows[i].Line = i + 1
+	}
+	result, err := newImportResult(userID, settings.Currency, rows)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check for duplicates"})
+		return
+	}
+	if st := statements[0]; settings.AccountID != nil && st.LedgerBalance != nil {
+		if err := result.checkBalance(*settings.AccountID, st.BalanceDate, *st.LedgerBalance); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute balance"})
+			return
+		}
+	}
+	finishImport(c, userID, format, settings, result)
+}
+
+// GetImportBatches lists the user's committed imports, newest first.
+func GetImportBatches(c *gin.Context) {
+	var batches []ImportBatch
+	if err := db.Where("user_id = ?", currentUserID(c)).Order("created_at DESC, id DESC").Find(&batches).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve imports"})
+		return
+	}
+	c.JSON(http.StatusOK, batches)
+}
+
+func GetImportBatch(c *gin.Context) {
+	var batch ImportBatch
+	if !findOwned(c, &batch, "Import not found") {
+		return
+	}
+	c.JSON(http.StatusOK, batch)
+}
+
+// DeleteImportBatch undoes an import: it deletes the expenses and incomes
+// the import saved, including any edited since, and then the batch.
+// Categories the import created are kept.
+func DeleteImportBatch(c *gin.Context) {
+	var batch ImportBatch
+	if !findOwned(c, &batch, "Import not found") {
+		return
+	}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		expenses := tx.Model(&Expense{}).Select("id").Where("import_batch_id = ?", batch.ID)
+		incomes := tx.Model(&Income{}).Select("id").Where("import_batch_id = ?", batch.ID)
+		// As with DeleteExpense, bill payments booked as these expenses stay on their bills.
+		if err := tx.Model(&BillPayment{}).Where("expense_id IN (?)", expenses).Update("expense_id", nil).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("expense_id IN (?)", expenses).Delete(&ExpenseSplit{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Exec("DELETE FROM expense_tags WHERE expense_id IN (?)", expenses).Error; err != nil {
+			return err
+		}
+		if err := tx.Exec("DELETE FROM income_tags WHERE income_id IN (?)", incomes).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("import_batch_id = ?", batch.ID).Delete(&Expense{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("import_batch_id = ?", batch.ID).Delete(&Income{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&batch).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to undo import"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Import undone"})
+}
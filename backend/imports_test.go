@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestImportBatches(t *testing.T) {
+	setupTestDB()
+	r := setupRouter()
+	db.Create(&User{FullName: "A", Username: "a", Email: "a@x.com", Password: "p", BaseCurrency: "USD"})
+	db.Create(&User{FullName: "B", Username: "b", Email: "b@x.com", Password: "p", BaseCurrency: "USD"})
+	data, _ := os.ReadFile("testdata/qif/checking.qif")
+	qif := string(data)
+	fields := map[string]string{"commit": "true", "skip_invalid": "true"}
+
+	w := uploadFile(r, "/import/qif", qif, fields, 1)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var result importResult
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+	assert.Equal(t, 5, result.Expenses)
+	assert.Equal(t, 1, result.Incomes)
+	if !assert.NotNil(t, result.Batch) {
+		return
+	}
+	assert.Equal(t, ImportBatch{ID: 1, UserID: 1, Format: "qif", Filename: "statement", Currency: "USD", Expenses: 5, Incomes: 1,
+		ExpenseTotal: 4590 + 120000 + 350 + 350 + 20000, IncomeTotal: 250000, Skipped: 1, CreatedAt: result.Batch.CreatedAt}, *result.Batch)
+
+	var expense Expense
+	db.Where("description = ?", "Landlord").First(&expense)
+	assert.Equal(t, "Housing", expense.Category)
+	if assert.NotNil(t, expense.ImportBatchID) {
+		assert.EqualValues(t, 1, *expense.ImportBatchID)
+	}
+
+	// the same file again saves nothing and leaves no batch
+	result = importResult{}
+	w = uploadFile(r, "/import/qif", qif, fields, 1)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+	assert.Equal(t, 6, result.Duplicates)
+	assert.Nil(t, result.Batch)
+
+	var batches []ImportBatch
+	assert.Equal(t, http.StatusOK, getJSON(r, "/imports", 1, &batches))
+	assert.Len(t, batches, 1)
+	assert.Equal(t, http.StatusOK, getJSON(r, "/imports", 2, &batches))
+	assert.Empty(t, batches)
+	assert.Equal(t, http.StatusForbidden, sendJSON(r, "DELETE", "/imports/1", "", 2).Code)
+
+	// an expense edited since the import is undone with it; bill payments
+	// booked as imported expenses stay on their bills
+	assert.Equal(t, http.StatusOK, sendJSON(r, "PATCH", fmt.Sprintf("/expenses/%d", expense.ID), `{"description":"Rent"}`, 1).Code)
+	db.Create(&Bill{UserID: 1, Name: "Rent", Amount: 120000, Currency: "USD", DueDate: mustDate("2025-04-03")})
+	db.Create(&BillPayment{BillID: 1, Amount: 120000, Date: mustDate("2025-04-03"), ExpenseID: &expense.ID})
+
+	assert.Equal(t, http.StatusOK, sendJSON(r, "DELETE", "/imports/1", "", 1).Code)
+	var count int64
+	db.Model(&Expense{}).Count(&count)
+	assert.Zero(t, count)
+	db.Model(&Income{}).Count(&count)
+	assert.Zero(t, count)
+	var payment BillPayment
+	db.First(&payment)
+	assert.Nil(t, payment.ExpenseID)
+	assert.Equal(t, http.StatusNotFound, getJSON(r, "/imports/1", 1, &batches))
+
+	// once undone, the file can be imported again
+	w = uploadFile(r, "/import/qif", qif, fields, 1)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+	assert.Equal(t, 6, result.Expenses+result.Incomes)
+}
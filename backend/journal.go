@@ -0,0 +1,432 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Root accounts of the plain-text accounting journal.
+const (
+	journalAssets      = "Assets"
+	journalLiabilities = "Liabilities"
+	journalExpenses    = "Expenses"
+	journalIncome      = "Income"
+	journalOpening     = "Equity:Opening-Balances"
+	journalUnassigned  = "Assets:Unassigned" // transactions booked to no account
+)
+
+// Ranks order the entries of one day in a journal.
+const (
+	rankOpening = iota
+	rankIncome
+	rankExpense
+	rankTransfer
+)
+
+// journalPosting is one leg of a journal entry. A posting in another
+// currency than the rest of its entry carries the total it is worth in
+// theirs, so that the entry balances.
+type journalPosting struct {
+	account       string
+	amount        Money
+	currency      string
+	priceAmount   Money
+	priceCurrency string
+}
+
+// journalEntry is a balanced double-entry transaction.
+type journalEntry struct {
+	date     Date
+	rank     int
+	id       uint
+	key      string // identifies the record, such as expense-12
+	pending  bool
+	text     string
+	tags     []string
+	postings []journalPosting
+}
+
+// journalName turns a name into an account name component: words are
+// capitalised and joined by hyphens, and anything but letters, digits and
+// hyphens is dropped, as both Ledger and Beancount accept that.
+func journalName(name string) string {
+	var words []string
+	for _, w := range strings.FieldsFunc(name, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '-'
+	}) {
+		w = strings.Trim(w, "-")
+		if w == "" {
+			continue
+		}
+		r := []rune(w)
+		r[0] = unicode.ToUpper(r[0])
+		words = append(words, string(r))
+	}
+	if len(words) == 0 {
+		return "Unnamed"
+	}
+	return strings.Join(words, "-")
+}
+
+// journalTag turns a tag name into one both formats accept: Beancount
+// allows only ASCII letters, digits and -_/. in tags.
+func journalTag(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r <= unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) || strings.ContainsRune("-_/.", r) {
+			return r
+		}
+		return '-'
+	}, strings.TrimSpace(name))
+}
+
+// journal builds the entries of a user's journal.
+type journal struct {
+	categories map[uint]Category
+	accounts   map[uint]Account
+	names      map[uint]string // journal account of each account
+	entries    []journalEntry
+}
+
+// categoryAccount names the account of a category, below Expenses or
+// Income and following the category's parents.
+func (j *journal) categoryAccount(kind string, id *uint, name string) string {
+	root := journalExpenses
+	if kind == kindIncome {
+		root = journalIncome
+	}
+	var path []string
+	// The depth bound guards against a cycle in the stored parents.
+	for depth := 0; id != nil && depth < 32; depth++ {
+		cat, ok := j.categories[*id]
+		if !ok {
+			break
+		}
+		path = append([]string{journalName(cat.Name)}, path...)
+		id = cat.ParentID
+	}
+	if len(path) == 0 {
+		path = []string{journalName(name)}
+	}
+	return root + ":" + strings.Join(path, ":")
+}
+
+// assetAccount names the account money moved in or out of.
+func (j *journal) assetAccount(id *uint) string {
+	if id == nil {
+		return journalUnassigned
+	}
+	if name, ok := j.names[*id]; ok {
+		return name
+	}
+	return journalUnassigned
+}
+
+// nameAccounts gives each account its journal account: credit cards are
+// liabilities and the other accounts assets. Names that would collide with
+// each other or with journalUnassigned, such as two accounts called
+// Checking in different currencies, get the currency appended, and the id
+// as well if that is not enough.
+func (j *journal) nameAccounts(accounts []Account) {
+	base := func(a Account) string {
+		if a.Type == accountCreditCard {
+			return journalLiabilities + ":" + journalName(a.Name)
+		}
+		return journalAssets + ":" + journalName(a.Name)
+	}
+	counts := map[string]int{journalUnassigned: 1}
+	for _, a := range accounts {
+		counts[base(a)]++
+	}
+	withCurrency := map[string]int{}
+	for name := range counts {
+		withCurrency[name] = 1
+	}
+	for _, a := range accounts {
+		if name := base(a); counts[name] > 1 {
+			withCurrency[name+"-"+a.Currency]++
+		}
+	}
+	for _, a := range accounts {
+		name := base(a)
+		if counts[name] > 1 {
+			name += "-" + a.Currency
+			if withCurrency[name] > 1 {
+				name += fmt.Sprintf("-%d", a.ID)
+			}
+		}
+		j.names[a.ID] = name
+	}
+}
+
+func journalTags(tags []Tag) []string {
+	names := make([]string, 0, len(tags))
+	for _, t := range tags {
+		names = append(names, journalTag(t.Name))
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (j *journal) addExpense(e Expense) {
+	entry := journalEntry{date: e.Date, rank: rankExpense, id: e.ID, key: fmt.Sprintf("expense-%d", e.ID),
+		pending: !e.Paid, text: e.Description, tags: journalTags(e.Tags)}
+	if len(e.Splits) == 0 {
+		entry.postings = append(entry.postings, journalPosting{account: j.categoryAccount(kindExpense, e.CategoryID, e.Category), amount: e.Amount, currency: e.Currency})
+	}
+	for _, s := range e.Splits {
+		entry.postings = append(entry.postings, journalPosting{account: j.categoryAccount(kindExpense, s.CategoryID, s.Category), amount: s.Amount, currency: e.Currency})
+	}
+	entry.postings = append(entry.postings, journalPosting{account: j.assetAccount(e.AccountID), amount: -e.Amount, currency: e.Currency})
+	if entry.text == "" {
+		entry.text = e.Category
+	}
+	j.entries = append(j.entries, entry)
+}
+
+func (j *journal) addIncome(i Income) {
+	entry := journalEntry{date: i.Date, rank: rankIncome, id: i.ID, key: fmt.Sprintf("income-%d", i.ID),
+		text: i.Description, tags: journalTags(i.Tags)}
+	entry.postings = []journalPosting{
+		{account: j.assetAccount(i.AccountID), amount: i.Amount, currency: i.Currency},
+		{account: j.categoryAccount(kindIncome, i.CategoryID, i.Category), amount: -i.Amount, currency: i.Currency},
+	}
+	if entry.text == "" {
+		entry.text = i.Category
+	}
+	j.entries = append(j.entries, entry)
+}
+
+func (j *journal) addTransfer(t Transfer) {
+	from, to := j.accounts[t.FromAccountID], j.accounts[t.ToAccountID]
+	in := journalPosting{account: j.assetAccount(&t.ToAccountID), amount: t.ToAmount, currency: to.Currency}
+	if to.Currency != from.Currency {
+		in.priceAmount, in.priceCurrency = t.Amount, from.Currency
+	}
+	text := t.Description
+	if text == "" {
+		text = "Transfer"
+	}
+	j.entries = append(j.entries, journalEntry{date: t.Date, rank: rankTransfer, id: t.ID, key: fmt.Sprintf("transfer-%d", t.ID),
+		text: text, postings: []journalPosting{in, {account: j.assetAccount(&t.FromAccountID), amount: -t.Amount, currency: from.Currency}}})
+}
+
+// addOpenings books each account's balance on day against the opening
+// balances equity account.
+func (j *journal) addOpening(a Account, day Date, balance Money) {
+	if balance == 0 {
+		return
+	}
+	j.entries = append(j.entries, journalEntry{date: day, rank: rankOpening, id: a.ID, key: fmt.Sprintf("account-%d", a.ID),
+		text: "Opening balance", postings: []journalPosting{
+			{account: j.assetAccount(&a.ID), amount: balance, currency: a.Currency},
+			{account: journalOpening, amount: -balance, currency: a.Currency},
+		}})
+}
+
+// buildJournal collects the user's transactions dated within [from, to].
+// Account balances open the journal: the opening balance on the day of its
+// first entry, or with from the balance on the day before it.
+func buildJournal(userID uint, from, to Date) (*journal, error) {
+	j := &journal{categories: map[uint]Category{}, accounts: map[uint]Account{}, names: map[uint]string{}}
+	var categories []Category
+	if err := db.Where("user_id = ?", userID).Find(&categories).Error; err != nil {
+		return nil, err
+	}
+	for _, cat := range categories {
+		j.categories[cat.ID] = cat
+	}
+	var accounts []Account
+	if err := db.Where("user_id = ?", userID).Order("id").Find(&accounts).Error; err != nil {
+		return nil, err
+	}
+	for _, a := range accounts {
+		j.accounts[a.ID] = a
+	}
+	j.nameAccounts(accounts)
+
+	var expenses []Expense
+	if err := inDateRange(db.Where("user_id = ?", userID), from, to).Preload("Tags").Preload("Splits").Find(&expenses).Error; err != nil {
+		return nil, err
+	}
+	for _, e := range expenses {
+		j.addExpense(e)
+	}
+	var incomes []Income
+	if err := inDateRange(db.Where("user_id = ?", userID), from, to).Preload("Tags").Find(&incomes).Error; err != nil {
+		return nil, err
+	}
+	for _, i := range incomes {
+		j.addIncome(i)
+	}
+	var transfers []Transfer
+	if err := inDateRange(db.Where("user_id = ?", userID), from, to).Find(&transfers).Error; err != nil {
+		return nil, err
+	}
+	for _, t := range transfers {
+		j.addTransfer(t)
+	}
+
+	opening := from.AddDays(-1)
+	if from.IsZero() {
+		opening = Date{}
+		for _, e := range j.entries {
+			if opening.IsZero() || e.date.Before(opening) {
+				opening = e.date
+			}
+		}
+	}
+	for _, a := range accounts {
+		switch {
+		case !from.IsZero():
+			balance, err := a.balance(opening)
+			if err != nil {
+				return nil, err
+			}
+			j.addOpening(a, opening, balance)
+		case opening.IsZero():
+			j.addOpening(a, DateOf(a.CreatedAt), a.OpeningBalance)
+		default:
+			j.addOpening(a, opening, a.OpeningBalance)
+		}
+	}
+
+	sort.SliceStable(j.entries, func(a, b int) bool {
+		x, y := j.entries[a], j.entries[b]
+		if x.date.Before(y.date) || x.date.After(y.date) {
+			return x.date.Before(y.date)
+		}
+		if x.rank != y.rank {
+			return x.rank < y.rank
+		}
+		return x.id < y.id
+	})
+	return j, nil
+}
+
+// oneLine keeps text on a single line.
+func oneLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// writeLedger writes the journal in Ledger's format, which hledger reads
+// too.
+func (j *journal) writeLedger(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "; FinTrack journal")
+	for _, e := range j.entries {
+		flag := "*"
+		if e.pending {
+			flag = "!"
+		}
+		fmt.Fprintf(bw, "\n%s %s %s\n", e.date, flag, oneLine(e.text))
+		fmt.Fprintf(bw, "    ; fintrack-id: %s\n", e.key)
+		if len(e.tags) > 0 {
+			fmt.Fprintf(bw, "    ; :%s:\n", strings.Join(e.tags, ":"))
+		}
+		j.writePostings(bw, e, "    ")
+	}
+	return bw.Flush()
+}
+
+// writeBeancount writes the journal in Beancount's format, opening each
+// account on the day of its first entry.
+func (j *journal) writeBeancount(w io.Writer, baseCurrency string) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "option \"operating_currency\" \"%s\"\n\n", baseCurrency)
+
+	opened := map[string]Date{}
+	for _, e := range j.entries {
+		for _, p := range e.postings {
+			if d, ok := opened[p.account]; !ok || e.date.Before(d) {
+				opened[p.account] = e.date
+			}
+		}
+	}
+	names := make([]string, 0, len(opened))
+	for name := range opened {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(a, b int) bool {
+		x, y := opened[names[a]], opened[names[b]]
+		if x.Before(y) || x.After(y) {
+			return x.Before(y)
+		}
+		return names[a] < names[b]
+	})
+	for _, name := range names {
+		fmt.Fprintf(bw, "%s open %s\n", opened[name], name)
+	}
+
+	quote := strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+	for _, e := range j.entries {
+		flag := "*"
+		if e.pending {
+			flag = "!"
+		}
+		fmt.Fprintf(bw, "\n%s %s \"%s\"", e.date, flag, quote.Replace(oneLine(e.text)))
+		for _, tag := range e.tags {
+			fmt.Fprintf(bw, " #%s", tag)
+		}
+		fmt.Fprintf(bw, "\n  fintrack-id: \"%s\"\n", e.key)
+		j.writePostings(bw, e, "  ")
+	}
+	return bw.Flush()
+}
+
+// writePostings writes e's postings with their amounts lined up.
+func (j *journal) writePostings(w io.Writer, e journalEntry, indent string) {
+	width, amountWidth := 0, 0
+	for _, p := range e.postings {
+		width = max(width, len([]rune(p.account)))
+		amountWidth = max(amountWidth, len(p.amount.Format(p.currency)))
+	}
+	for _, p := range e.postings {
+		fmt.Fprintf(w, "%s%-*s  %*s %s", indent, width, p.account, amountWidth, p.amount.Format(p.currency), p.currency)
+		if p.priceCurrency != "" {
+			fmt.Fprintf(w, " @@ %s %s", p.priceAmount.Format(p.priceCurrency), p.priceCurrency)
+		}
+		fmt.Fprintln(w)
+	}
+}
+
+// ExportLedger renders the user's expenses, incomes and transfers as a
+// double-entry journal for Ledger and hledger (format=ledger, the default)
+// or Beancount (format=beancount), optionally limited to from and to. The
+// output depends only on the data, so successive exports diff cleanly.
+func ExportLedger(c *gin.Context) {
+	userID := currentUserID(c)
+	format := c.DefaultQuery("format", "ledger")
+	if format != "ledger" && format != "beancount" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be ledger or beancount"})
+		return
+	}
+	from, to, ok := dateRange(c)
+	if !ok {
+		return
+	}
+	j, err := buildJournal(userID, from, to)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build journal"})
+		return
+	}
+
+	c.Header("Content-Type", "text/plain; charset=utf-8")
+	c.Header("Content-Disposition", `attachment; filename="fintrack.`+format+`"`)
+	c.Status(http.StatusOK)
+	if format == "beancount" {
+		err = j.writeBeancount(c.Writer, baseCurrencyOf(userID))
+	} else {
+		err = j.writeLedger(c.Writer)
+	}
+	if err != nil {
+		log.Printf("journal export for user %d failed: %v", userID, err)
+	}
+}
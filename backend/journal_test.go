@@ -0,0 +1,135 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJournalName(t *testing.T) {
+	for name, want := range map[string]string{
+		"Groceries":        "Groceries",
+		"eating out":       "Eating-Out",
+		"Kids: school/fee": "Kids-School-Fee",
+		"Café & Bar":       "Café-Bar",
+		"--":               "Unnamed",
+		"":                 "Unnamed",
+	} {
+		assert.Equal(t, want, journalName(name), name)
+	}
+}
+
+func TestJournalTag(t *testing.T) {
+	for name, want := range map[string]string{
+		"Trip":         "Trip",
+		" trip 2025 ":  "trip-2025",
+		"work/q1.v2_a": "work/q1.v2_a",
+		"Café":         "Caf-",
+		"家族":           "--",
+	} {
+		assert.Equal(t, want, journalTag(name), name)
+	}
+}
+
+func TestJournalAccountNames(t *testing.T) {
+	j := &journal{names: map[uint]string{}}
+	j.nameAccounts([]Account{
+		{ID: 1, Name: "Checking", Currency: "USD"},
+		{ID: 2, Name: "checking", Currency: "EUR"},
+		{ID: 3, Name: "Checking", Currency: "EUR"},
+		{ID: 4, Name: "Unassigned", Currency: "USD"},
+		{ID: 5, Name: "Savings", Currency: "USD"},
+		{ID: 6, Name: "Savings", Type: accountCreditCard, Currency: "USD"},
+	})
+	assert.Equal(t, map[uint]string{
+		1: "Assets:Checking-USD",
+		2: "Assets:Checking-EUR-2",
+		3: "Assets:Checking-EUR-3",
+		4: "Assets:Unassigned-USD",
+		5: "Assets:Savings",
+		6: "Liabilities:Savings",
+	}, j.names)
+	assert.Equal(t, journalUnassigned, j.assetAccount(nil))
+	id := uint(1)
+	assert.Equal(t, "Assets:Checking-USD", j.assetAccount(&id))
+}
+
+func TestExportLedger(t *testing.T) {
+	setupTestDB()
+	r := setupRouter()
+	seedArchiveData()
+
+	w := sendJSON(r, "GET", "/export/ledger", "", 1)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `; FinTrack journal
+
+2025-04-01 * Opening balance
+    ; fintrack-id: account-1
+    Assets:Checking           1000.00 EUR
+    Equity:Opening-Balances  -1000.00 EUR
+
+2025-04-01 * Salary
+    ; fintrack-id: income-1
+    ; :Trip:
+    Assets:Checking   3000.00 EUR
+    Income:Salary    -3000.00 EUR
+
+2025-04-03 ! Groceries
+    ; fintrack-id: expense-1
+    ; :Trip:
+    Expenses:Food:Groceries   30.00 EUR
+    Expenses:Food             20.00 EUR
+    Assets:Checking          -50.00 EUR
+
+2025-04-05 * Transfer
+    ; fintrack-id: transfer-1
+    Assets:Savings    100.00 EUR
+    Assets:Checking  -100.00 EUR
+`, w.Body.String())
+
+	// the same data always renders the same journal
+	assert.Equal(t, w.Body.String(), sendJSON(r, "GET", "/export/ledger", "", 1).Body.String())
+	assert.Equal(t, "; FinTrack journal\n", sendJSON(r, "GET", "/export/ledger", "", 2).Body.String())
+
+	// from opens the accounts with their balance the day before
+	w = sendJSON(r, "GET", "/export/ledger?format=beancount&from=2025-04-02", "", 1)
+	assert.Equal(t, http.StatusOK, w.Code)
+	body := w.Body.String()
+	assert.True(t, strings.HasPrefix(body, `option "operating_currency" "EUR"
+
+2025-04-01 open Assets:Checking
+2025-04-01 open Equity:Opening-Balances
+2025-04-03 open Expenses:Food
+2025-04-03 open Expenses:Food:Groceries
+2025-04-05 open Assets:Savings
+`), body)
+	assert.Contains(t, body, `2025-04-01 * "Opening balance"
+  fintrack-id: "account-1"
+  Assets:Checking           4000.00 EUR
+  Equity:Opening-Balances  -4000.00 EUR
+`)
+	assert.Contains(t, body, `2025-04-03 ! "Groceries" #Trip`)
+	assert.NotContains(t, body, "Income:Salary")
+
+	assert.Equal(t, http.StatusBadRequest, sendJSON(r, "GET", "/export/ledger?format=qif", "", 1).Code)
+	assert.Equal(t, http.StatusBadRequest, sendJSON(r, "GET", "/export/ledger?from=April", "", 1).Code)
+}
+
+func TestExportLedgerTransferBetweenCurrencies(t *testing.T) {
+	setupTestDB()
+	r := setupRouter()
+	db.Create(&User{FullName: "A", Username: "a", Email: "a@x.com", Password: "p", BaseCurrency: "EUR"})
+	db.Create(&Account{UserID: 1, Name: "Checking", Type: accountChecking, Currency: "EUR"})
+	db.Create(&Account{UserID: 1, Name: "Travel card", Type: accountCreditCard, Currency: "USD"})
+	db.Create(&Transfer{UserID: 1, FromAccountID: 1, ToAccountID: 2, Amount: 9000, ToAmount: 10000, Rate: 1.1111, Date: mustDate("2025-04-05"),
+		Description: `Pay "card"`})
+
+	w := sendJSON(r, "GET", "/export/ledger?format=beancount", "", 1)
+	assert.Contains(t, w.Body.String(), `2025-04-05 * "Pay \"card\""
+  fintrack-id: "transfer-1"
+  Liabilities:Travel-Card  100.00 USD @@ 90.00 EUR
+  Assets:Checking          -90.00 EUR
+`)
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 200
+)
+
+// listable is implemented by the models the list endpoints page through.
+type listable interface {
+	// cursorValue returns the value of a sort column in its cursor form.
+	cursorValue(column string) string
+	primaryKey() uint
+}
+
+func (e Expense) primaryKey() uint { return e.ID }
+func (i Income) primaryKey() uint  { return i.ID }
+
+func (e Expense) cursorValue(column string) string {
+	return transactionCursorValue(column, e.Date, e.Amount, e.CreatedAt)
+}
+
+func (i Income) cursorValue(column string) string {
+	return transactionCursorValue(column, i.Date, i.Amount, i.CreatedAt)
+}
+
+func transactionCursorValue(column string, date Date, amount Money, createdAt time.Time) string {
+	switch column {
+	case "amount":
+		return strconv.FormatInt(int64(amount), 10)
+	case "created_at":
+		return createdAt.UTC().Format(time.RFC3339Nano)
+	default:
+		return date.String()
+	}
+}
+
+// page is the requested slice of a sorted list.
+type page struct {
+	sort  string // column to order by, with id as the tie-breaker
+	desc  bool
+	limit int
+	after *listCursor
+}
+
+// listCursor marks the last row of a page. It is handed to clients as an
+// opaque string and only valid for the sort order it was issued for.
+type listCursor struct {
+	Sort  string `json:"s"`
+	Desc  bool   `json:"d"`
+	Value string `json:"v"`
+	ID    uint   `json:"id"`
+}
+
+func (lc listCursor) encode() string {
+	b, _ := json.Marshal(lc)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeCursor(s string) (*listCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	var lc listCursor
+	if err := json.Unmarshal(b, &lc); err != nil {
+		return nil, err
+	}
+	return &lc, nil
+}
+
+// parsePage reads sort, limit and cursor. sort is a column name, prefixed
+// with "-" for descending order; the default is newest date first. It
+// writes the error response itself and reports whether to continue.
+func parsePage(c *gin.Context) (page, bool) {
+	p := page{sort: "date", desc: true, limit: defaultPageSize}
+
+	if s := c.Query("sort"); s != "" {
+		p.desc = strings.HasPrefix(s, "-")
+		p.sort = strings.TrimPrefix(s, "-")
+		if p.sort != "date" && p.sort != "amount" && p.sort != "created_at" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "sort must be one of date, amount or created_at, optionally prefixed with -"})
+			return page{}, false
+		}
+	}
+
+	if s := c.Query("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > maxPageSize {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("limit must be between 1 and %d", maxPageSize)})
+			return page{}, false
+		}
+		p.limit = n
+	}
+
+	if s := c.Query("cursor"); s != "" {
+		lc, err := decodeCursor(s)
+		if err != nil || lc.Sort != p.sort || lc.Desc != p.desc {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cursor"})
+			return page{}, false
+		}
+		p.after = lc
+	}
+	return p, true
+}
+
+// apply orders query and limits it to the rows after the cursor. One extra
+// row is fetched to tell whether another page follows.
+func (p page) apply(query *gorm.DB) (*gorm.DB, error) {
+	if p.after != nil {
+		value, err := p.cursorArg(p.after.Value)
+		if err != nil {
+			return nil, err
+		}
+		op := ">"
+		if p.desc {
+			op = "<"
+		}
+		col := clause.Column{Name: p.sort}
+		query = query.Where(fmt.Sprintf("(? %s ?) OR (? = ? AND id %s ?)", op, op), col, value, col, value, p.after.ID)
+	}
+	return query.
+		Order(clause.OrderByColumn{Column: clause.Column{Name: p.sort}, Desc: p.desc}).
+		Order(clause.OrderByColumn{Column: clause.Column{Name: "id"}, Desc: p.desc}).
+		Limit(p.limit + 1), nil
+}
+
+// cursorArg turns a cursor value back into a typed query argument.
+func (p page) cursorArg(value string) (interface{}, error) {
+	switch p.sort {
+	case "amount":
+		n, err := strconv.ParseInt(value, 10, 64)
+		return Money(n), err
+	case "created_at":
+		return time.Parse(time.RFC3339Nano, value)
+	default:
+		return ParseDate(value)
+	}
+}
+
+// trimPage drops the look-ahead row fetched by apply and returns the
+// cursor for the next page, or "" when this is the last one.
+func trimPage[T listable](rows []T, p page) ([]T, string) {
+	if len(rows) <= p.limit {
+		return rows, ""
+	}
+	rows = rows[:p.limit]
+	last := rows[len(rows)-1]
+	next := listCursor{Sort: p.sort, Desc: p.desc, Value: last.cursorValue(p.sort), ID: last.primaryKey()}
+	return rows, next.encode()
+}
+
+// filterTransactions applies the filters shared by the expense and income
+// lists: from/to dates, category (repeatable), category_id (including its
+// subcategories), min_amount/max_amount, tag with tag_mode, and a
+// case-insensitive q searched for in the description. It writes the error
+// response itself and reports whether to continue.
+func filterTransactions(c *gin.Context, query *gorm.DB, kind string) (*gorm.DB, bool) {
+	from, to, ok := dateRange(c)
+	if !ok {
+		return nil, false
+	}
+	query = inDateRange(query, from, to)
+
+	if categories := c.QueryArray("category"); len(categories) > 0 {
+		query = query.Where("category IN ?", categories)
+	}
+	if s := c.Query("category_id"); s != "" {
+		id, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "category_id must be a number"})
+			return nil, false
+		}
+		ids, err := categorySubtree(currentUserID(c), uint(id))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to look up category"})
+			return nil, false
+		}
+		query = query.Where("category_id IN ?", ids)
+	}
+
+	for _, param := range []string{"account_id", "import_batch_id"} {
+		s := c.Query(param)
+		if s == "" {
+			continue
+		}
+		id, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": param + " must be a number"})
+			return nil, false
+		}
+		query = query.Where(param+" = ?", id)
+	}
+
+	for param, op := range map[string]string{"min_amount": ">=", "max_amount": "<="} {
+		s := c.Query(param)
+		if s == "" {
+			continue
+		}
+		amount, err := ParseMoney(s)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": param + " must be a decimal amount"})
+			return nil, false
+		}
+		query = query.Where("amount "+op+" ?", amount)
+	}
+
+	tags, ok := parseTagFilter(c)
+	if !ok {
+		return nil, false
+	}
+	query = tags.apply(query, kind)
+
+	if q := strings.TrimSpace(c.Query("q")); q != "" {
+		query = query.Where(`LOWER(description) LIKE ? ESCAPE '\'`, "%"+escapeLike(strings.ToLower(q))+"%")
+	}
+	return query, true
+}
+
+// filterExpenses applies filterTransactions and paid, which only expenses
+// have. It writes the error response itself and reports whether to
+// continue.
+func filterExpenses(c *gin.Context, query *gorm.DB) (*gorm.DB, bool) {
+	query, ok := filterTransactions(c, query, kindExpense)
+	if !ok {
+		return nil, false
+	}
+	if s := c.Query("paid"); s != "" {
+		paid, err := strconv.ParseBool(s)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "paid must be true or false"})
+			return nil, false
+		}
+		query = query.Where("paid = ?", paid)
+	}
+	return query, true
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// listResponse is the body of a paginated list endpoint. NextCursor is
+// null on the last page.
+type listResponse[T any] struct {
+	Data       []T     `json:"data"`
+	NextCursor *string `json:"next_cursor"`
+}
+
+func newListResponse[T listable](rows []T, p page) listResponse[T] {
+	rows, next := trimPage(rows, p)
+	if rows == nil {
+		rows = []T{}
+	}
+	resp := listResponse[T]{Data: rows}
+	if next != "" {
+		resp.NextCursor = &next
+	}
+	return resp
+}
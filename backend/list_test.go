@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func listExpenses(t *testing.T, query url.Values) (int, listResponse[Expense]) {
+	r := setupRouter()
+	req := withAuth(httptest.NewRequest("GET", "/expenses?"+query.Encode(), nil), 1)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	var resp listResponse[Expense]
+	if w.Code == http.StatusOK {
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	}
+	return w.Code, resp
+}
+
+func descriptions(expenses []Expense) []string {
+	var out []string
+	for _, e := range expenses {
+		out = append(out, e.Description)
+	}
+	return out
+}
+
+func TestListExpensesFilters(t *testing.T) {
+	setupTestDB()
+	db.Create(&[]Expense{
+		{UserID: 1, Amount: 1250, Category: "Food", Description: "Lunch at Cafe", Date: mustDate("2025-04-01")},
+		{UserID: 1, Amount: 4000, Category: "Food", Description: "Groceries", Date: mustDate("2025-04-10"), Paid: true},
+		{UserID: 1, Amount: 90000, Category: "Rent", Description: "April rent", Date: mustDate("2025-04-15"), Paid: true},
+		{UserID: 1, Amount: 300, Category: "Fees", Description: "100% fee_charge", Date: mustDate("2025-05-02")},
+		{UserID: 2, Amount: 1000, Category: "Food", Description: "not mine", Date: mustDate("2025-04-10")},
+	})
+
+	cases := []struct {
+		query url.Values
+		want  []string
+	}{
+		{url.Values{}, []string{"100% fee_charge", "April rent", "Groceries", "Lunch at Cafe"}},
+		{url.Values{"from": {"2025-04-05"}, "to": {"2025-04-30"}}, []string{"April rent", "Groceries"}},
+		{url.Values{"category": {"Food", "Fees"}}, []string{"100% fee_charge", "Groceries", "Lunch at Cafe"}},
+		{url.Values{"min_amount": {"12.50"}, "max_amount": {"40"}}, []string{"Groceries", "Lunch at Cafe"}},
+		{url.Values{"paid": {"false"}}, []string{"100% fee_charge", "Lunch at Cafe"}},
+		{url.Values{"q": {"CAFE"}}, []string{"Lunch at Cafe"}},
+		{url.Values{"q": {"0%"}}, []string{"100% fee_charge"}},
+		{url.Values{"q": {"e_c"}}, []string{"100% fee_charge"}},
+		{url.Values{"sort": {"amount"}}, []string{"100% fee_charge", "Lunch at Cafe", "Groceries", "April rent"}},
+		{url.Values{"sort": {"-amount"}, "paid": {"true"}}, []string{"April rent", "Groceries"}},
+		{url.Values{"q": {"nothing like this"}}, nil},
+	}
+	for _, tc := range cases {
+		code, resp := listExpenses(t, tc.query)
+		assert.Equal(t, http.StatusOK, code, tc.query.Encode())
+		assert.Equal(t, tc.want, descriptions(resp.Data), tc.query.Encode())
+		assert.Nil(t, resp.NextCursor, tc.query.Encode())
+	}
+
+	for _, query := range []url.Values{
+		{"from": {"April"}},
+		{"from": {"2025-05-01"}, "to": {"2025-04-01"}},
+		{"min_amount": {"ten"}},
+		{"paid": {"maybe"}},
+		{"sort": {"category"}},
+		{"limit": {"0"}},
+		{"limit": {"1000"}},
+		{"cursor": {"not a cursor"}},
+	} {
+		code, _ := listExpenses(t, query)
+		assert.Equal(t, http.StatusBadRequest, code, query.Encode())
+	}
+}
+
+func TestListExpensesCursorPagination(t *testing.T) {
+	setupTestDB()
+	// equal dates and amounts, so paging has to break ties on id
+	for i := 0; i < 7; i++ {
+		db.Create(&Expense{UserID: 1, Amount: Money(100 * (i % 3)), Category: "c", Description: string(rune('a' + i)), Date: mustDate("2025-04-0" + string(rune('1'+i%2)))})
+	}
+
+	for _, sort := range []string{"date", "-date", "amount", "-amount", "created_at", "-created_at"} {
+		var seen []string
+		query := url.Values{"sort": {sort}, "limit": {"3"}}
+		for pages := 0; ; pages++ {
+			code, resp := listExpenses(t, query)
+			if !assert.Equal(t, http.StatusOK, code, sort) || pages > 3 {
+				break
+			}
+			assert.LessOrEqual(t, len(resp.Data), 3)
+			seen = append(seen, descriptions(resp.Data)...)
+			if resp.NextCursor == nil {
+				break
+			}
+			query.Set("cursor", *resp.NextCursor)
+		}
+		assert.ElementsMatch(t, []string{"a", "b", "c", "d", "e", "f", "g"}, seen, sort)
+	}
+
+	// a cursor only continues the sort order it came from
+	_, first := listExpenses(t, url.Values{"sort": {"amount"}, "limit": {"3"}})
+	code, _ := listExpenses(t, url.Values{"sort": {"-amount"}, "cursor": {*first.NextCursor}})
+	assert.Equal(t, http.StatusBadRequest, code)
+}
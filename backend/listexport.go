@@ -0,0 +1,323 @@
+package main
+
+import (
+	"encoding/csv"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// exportBatchSize is how many rows a list export reads at a time.
+const exportBatchSize = 500
+
+// exportColumns are the columns of an exported list of each kind, in the
+// order of the values exportRow returns.
+var exportColumns = map[string][]string{
+	kindExpense: {"ID", "Date", "Description", "Category", "Amount", "Currency", "Account", "Tags", "Paid", "Splits"},
+	kindIncome:  {"ID", "Date", "Description", "Category", "Amount", "Currency", "Account", "Tags"},
+}
+
+// exportable is implemented by the models whose lists can be exported.
+type exportable interface {
+	listable
+	// exportRow returns the row's values: strings, Money, Date or ints.
+	exportRow(accounts map[uint]string) []any
+	addTotals(totals exportTotals)
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
+
+func exportTags(tags []Tag) string {
+	names := make([]string, 0, len(tags))
+	for _, t := range tags {
+		names = append(names, t.Name)
+	}
+	return strings.Join(names, "; ")
+}
+
+func exportAccount(accounts map[uint]string, id *uint) string {
+	if id == nil {
+		return ""
+	}
+	return accounts[*id]
+}
+
+func (e Expense) exportRow(accounts map[uint]string) []any {
+	splits := make([]string, 0, len(e.Splits))
+	for _, s := range e.Splits {
+		splits = append(splits, s.Category+" "+s.Amount.String())
+	}
+	return []any{e.ID, e.Date, e.Description, e.Category, e.Amount, e.Currency, exportAccount(accounts, e.AccountID),
+		exportTags(e.Tags), yesNo(e.Paid), strings.Join(splits, "; ")}
+}
+
+func (i Income) exportRow(accounts map[uint]string) []any {
+	return []any{i.ID, i.Date, i.Description, i.Category, i.Amount, i.Currency, exportAccount(accounts, i.AccountID),
+		exportTags(i.Tags)}
+}
+
+// addTotals counts e once, under its own category, and adds each line of a
+// split expense to the total of the line's category.
+func (e Expense) addTotals(totals exportTotals) {
+	if len(e.Splits) == 0 {
+		totals.add(kindExpense, e.Category, e.Currency, 1, e.Amount)
+		return
+	}
+	totals.add(kindExpense, e.Category, e.Currency, 1, 0)
+	for _, s := range e.Splits {
+		totals.add(kindExpense, s.Category, e.Currency, 0, s.Amount)
+	}
+}
+
+func (i Income) addTotals(totals exportTotals) {
+	totals.add(kindIncome, i.Category, i.Currency, 1, i.Amount)
+}
+
+type exportTotalKey struct{ kind, category, currency string }
+
+type exportTotal struct {
+	count int
+	total Money
+}
+
+// exportTotals sums exported rows per kind, category and currency.
+type exportTotals map[exportTotalKey]*exportTotal
+
+func (t exportTotals) add(kind, category, currency string, entries int, amount Money) {
+	key := exportTotalKey{kind, category, currency}
+	if t[key] == nil {
+		t[key] = &exportTotal{}
+	}
+	t[key].count += entries
+	t[key].total += amount
+}
+
+// sheet writes the totals as the Summary sheet, ordered by kind, category
+// and currency.
+func (t exportTotals) sheet(x *xlsxWriter) {
+	keys := make([]exportTotalKey, 0, len(t))
+	for key := range t {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(a, b int) bool {
+		k, l := keys[a], keys[b]
+		if k.kind != l.kind {
+			return k.kind < l.kind
+		}
+		if k.category != l.category {
+			return k.category < l.category
+		}
+		return k.currency < l.currency
+	})
+	x.sheet("Summary", "Type", "Category", "Currency", "Entries", "Total")
+	for _, key := range keys {
+		x.row(key.kind, key.category, key.currency, t[key].count, t[key].total)
+	}
+}
+
+// listFormat reads the format a list is wanted in, from format (json, csv
+// or xlsx) or without it from the Accept header: "" for JSON. It writes the
+// error response itself and reports whether to continue.
+func listFormat(c *gin.Context) (string, bool) {
+	switch format := c.Query("format"); format {
+	case "csv", "xlsx":
+		return format, true
+	case "json":
+		return "", true
+	case "":
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be json, csv or xlsx"})
+		return "", false
+	}
+	accept := c.GetHeader("Accept")
+	switch {
+	case strings.Contains(accept, "text/csv"):
+		return "csv", true
+	case strings.Contains(accept, xlsxContentType):
+		return "xlsx", true
+	}
+	return "", true
+}
+
+// eachBatch calls fn with the rows of query in p's order, a batch at a
+// time, so that an export holds one batch in memory however long it is.
+// p's limit and cursor are ignored.
+func eachBatch[T listable](query *gorm.DB, p page, fn func([]T) error) error {
+	p.limit, p.after = exportBatchSize, nil
+	query = query.Session(&gorm.Session{})
+	for {
+		q, err := p.apply(query)
+		if err != nil {
+			return err
+		}
+		var rows []T
+		if err := q.Find(&rows).Error; err != nil {
+			return err
+		}
+		more := len(rows) > p.limit
+		if more {
+			rows = rows[:p.limit]
+		}
+		if err := fn(rows); err != nil {
+			return err
+		}
+		if !more {
+			return nil
+		}
+		last := rows[len(rows)-1]
+		p.after = &listCursor{Sort: p.sort, Desc: p.desc, Value: last.cursorValue(p.sort), ID: last.primaryKey()}
+	}
+}
+
+func accountNames(userID uint) (map[uint]string, error) {
+	var accounts []Account
+	if err := db.Where("user_id = ?", userID).Find(&accounts).Error; err != nil {
+		return nil, err
+	}
+	names := make(map[uint]string, len(accounts))
+	for _, a := range accounts {
+		names[a.ID] = a.Name
+	}
+	return names, nil
+}
+
+// csvText keeps a spreadsheet from reading text as a formula.
+func csvText(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+func csvRecord(values []any) []string {
+	record := make([]string, len(values))
+	for i, v := range values {
+		switch v := v.(type) {
+		case Money:
+			record[i] = v.String()
+		case Date:
+			record[i] = v.String()
+		case int:
+			record[i] = strconv.Itoa(v)
+		case uint:
+			record[i] = strconv.FormatUint(uint64(v), 10)
+		case string:
+			record[i] = csvText(v)
+		}
+	}
+	return record
+}
+
+// listSheet writes the rows of query as a sheet called name and adds them
+// to totals.
+func listSheet[T exportable](x *xlsxWriter, name, kind string, query *gorm.DB, p page, accounts map[uint]string, totals exportTotals) error {
+	x.sheet(name, exportColumns[kind]...)
+	return eachBatch(query, p, func(rows []T) error {
+		for _, row := range rows {
+			x.row(row.exportRow(accounts)...)
+			row.addTotals(totals)
+		}
+		return x.err
+	})
+}
+
+// exportList streams the rows of query, a list of kind, as a CSV file or as
+// a workbook holding them and their totals per category. The response has
+// begun before the first row is read, so a failure after that is only
+// logged and leaves the file cut short.
+func exportList[T exportable](c *gin.Context, format, kind string, query *gorm.DB, p page) {
+	userID := currentUserID(c)
+	accounts, err := accountNames(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export " + kind + "s"})
+		return
+	}
+
+	name := kind + "s-" + today(userID).String() + "." + format
+	c.Header("Content-Disposition", `attachment; filename="`+name+`"`)
+	if format == "csv" {
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+		c.Status(http.StatusOK)
+		// The byte order mark tells spreadsheets the file is UTF-8.
+		c.Writer.WriteString("\ufeff")
+		w := csv.NewWriter(c.Writer)
+		w.Write(exportColumns[kind])
+		err = eachBatch(query, p, func(rows []T) error {
+			for _, row := range rows {
+				w.Write(csvRecord(row.exportRow(accounts)))
+			}
+			w.Flush()
+			return w.Error()
+		})
+	} else {
+		c.Header("Content-Type", xlsxContentType)
+		c.Status(http.StatusOK)
+		x := newXLSXWriter(c.Writer)
+		totals := exportTotals{}
+		err = listSheet[T](x, strings.ToUpper(kind[:1])+kind[1:]+"s", kind, query, p, accounts, totals)
+		if err == nil {
+			totals.sheet(x)
+			err = x.close()
+		}
+	}
+	if err != nil {
+		log.Printf("%s export for user %d failed: %v", kind, userID, err)
+	}
+}
+
+// ExportTransactions returns the expenses and incomes matching the list
+// filters as a workbook with a sheet for each and a summary of their
+// totals per category. paid only filters the expenses.
+func ExportTransactions(c *gin.Context) {
+	userID := currentUserID(c)
+	if format := c.DefaultQuery("format", "xlsx"); format != "xlsx" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be xlsx"})
+		return
+	}
+	expenses, ok := filterExpenses(c, db.Where("user_id = ?", userID))
+	if !ok {
+		return
+	}
+	incomes, ok := filterTransactions(c, db.Where("user_id = ?", userID), kindIncome)
+	if !ok {
+		return
+	}
+	p, ok := parsePage(c)
+	if !ok {
+		return
+	}
+	accounts, err := accountNames(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export transactions"})
+		return
+	}
+
+	c.Header("Content-Disposition", `attachment; filename="transactions-`+today(userID).String()+`.xlsx"`)
+	c.Header("Content-Type", xlsxContentType)
+	c.Status(http.StatusOK)
+	x := newXLSXWriter(c.Writer)
+	totals := exportTotals{}
+	err = listSheet[Expense](x, "Expenses", kindExpense, expenses.Preload("Tags").Preload("Splits"), p, accounts, totals)
+	if err == nil {
+		err = listSheet[Income](x, "Incomes", kindIncome, incomes.Preload("Tags"), p, accounts, totals)
+	}
+	if err == nil {
+		totals.sheet(x)
+		err = x.close()
+	}
+	// Without its central directory the file is unreadable rather than
+	// silently incomplete.
+	if err != nil {
+		log.Printf("transaction export for user %d failed: %v", userID, err)
+	}
+}
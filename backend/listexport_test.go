@@ -0,0 +1,187 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// readXLSX returns the cells of each sheet of a workbook by sheet name.
+func readXLSX(t *testing.T, data []byte) map[string][][]string {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if !assert.NoError(t, err) {
+		return nil
+	}
+	parts := map[string][]byte{}
+	for _, f := range zr.File {
+		rc, _ := f.Open()
+		parts[f.Name], _ = io.ReadAll(rc)
+		rc.Close()
+	}
+	for _, name := range []string{"[Content_Types].xml", "_rels/.rels", "xl/_rels/workbook.xml.rels", "xl/styles.xml"} {
+		assert.Contains(t, parts, name)
+	}
+	var workbook struct {
+		Sheets []struct {
+			Name string `xml:"name,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	assert.NoError(t, xml.Unmarshal(parts["xl/workbook.xml"], &workbook))
+
+	sheets := map[string][][]string{}
+	for i, s := range workbook.Sheets {
+		var sheet struct {
+			Rows []struct {
+				Cells []struct {
+					Value  string `xml:"v"`
+					Inline string `xml:"is>t"`
+				} `xml:"c"`
+			} `xml:"sheetData>row"`
+		}
+		assert.NoError(t, xml.Unmarshal(parts[fmt.Sprintf("xl/worksheets/sheet%d.xml", i+1)], &sheet))
+		var rows [][]string
+		for _, row := range sheet.Rows {
+			var cells []string
+			for _, c := range row.Cells {
+				cells = append(cells, c.Value+c.Inline)
+			}
+			rows = append(rows, cells)
+		}
+		sheets[s.Name] = rows
+	}
+	return sheets
+}
+
+// readCSV reads an exported CSV file, without its byte order mark.
+func readCSV(body string) ([][]string, error) {
+	return csv.NewReader(strings.NewReader(strings.TrimPrefix(body, "\ufeff"))).ReadAll()
+}
+
+func seedExportData() {
+	seedArchiveData()
+	db.Create(&Expense{UserID: 1, Amount: 1250, Currency: "EUR", Category: "Fees", Description: "=HYPERLINK(\"x\")",
+		Date: mustDate("2025-04-10"), Paid: true})
+}
+
+func TestExportListCSV(t *testing.T) {
+	setupTestDB()
+	r := setupRouter()
+	seedExportData()
+
+	w := sendJSON(r, "GET", "/expenses?format=csv&sort=date", "", 1)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/csv; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Header().Get("Content-Disposition"), "expenses-")
+	records, err := readCSV(w.Body.String())
+	assert.NoError(t, err)
+	assert.Equal(t, [][]string{
+		exportColumns[kindExpense],
+		{"1", "2025-04-03", "", "Groceries", "50.00", "EUR", "Checking", "Trip", "no", "Groceries 30.00; Food 20.00"},
+		{"2", "2025-04-10", `'=HYPERLINK("x")`, "Fees", "12.50", "EUR", "", "", "yes", ""},
+	}, records)
+
+	// the list filters apply, and an Accept header asks for CSV too
+	req := withAuth(httptest.NewRequest("GET", "/expenses?paid=true", nil), 1)
+	req.Header.Set("Accept", "text/csv")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	records, _ = readCSV(w.Body.String())
+	if assert.Len(t, records, 2) {
+		assert.Equal(t, "Fees", records[1][3])
+	}
+
+	records, _ = readCSV(sendJSON(r, "GET", "/incomes?format=csv", "", 1).Body.String())
+	assert.Equal(t, [][]string{
+		exportColumns[kindIncome],
+		{"1", "2025-04-01", "", "Salary", "3000.00", "EUR", "Checking", "Trip"},
+	}, records)
+
+	assert.Equal(t, http.StatusBadRequest, sendJSON(r, "GET", "/expenses?format=pdf", "", 1).Code)
+	assert.Equal(t, http.StatusBadRequest, sendJSON(r, "GET", "/expenses?format=csv&paid=maybe", "", 1).Code)
+}
+
+func TestExportListBatches(t *testing.T) {
+	setupTestDB()
+	r := setupRouter()
+	db.Create(&User{FullName: "A", Username: "a", Email: "a@x.com", Password: "p"})
+	expenses := make([]Expense, exportBatchSize+20)
+	for i := range expenses {
+		expenses[i] = Expense{UserID: 1, Amount: Money(100 + i), Currency: "USD", Category: "Food", Date: mustDate("2025-04-01").AddDays(i % 30)}
+	}
+	db.CreateInBatches(expenses, 100)
+
+	records, err := readCSV(sendJSON(r, "GET", "/expenses?format=csv&sort=-amount&limit=5", "", 1).Body.String())
+	assert.NoError(t, err)
+	// every row once, in order, whatever the page limit
+	if assert.Len(t, records, len(expenses)+1) {
+		seen := map[string]bool{}
+		for i, rec := range records[1:] {
+			assert.Equal(t, Money(100+len(expenses)-1-i).String(), rec[4])
+			seen[rec[0]] = true
+		}
+		assert.Len(t, seen, len(expenses))
+	}
+}
+
+func TestExportListXLSX(t *testing.T) {
+	setupTestDB()
+	r := setupRouter()
+	seedExportData()
+
+	w := sendJSON(r, "GET", "/expenses?format=xlsx&sort=date", "", 1)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, xlsxContentType, w.Header().Get("Content-Type"))
+	sheets := readXLSX(t, w.Body.Bytes())
+	assert.Len(t, sheets, 2)
+	if assert.Len(t, sheets["Expenses"], 3) {
+		assert.Equal(t, exportColumns[kindExpense], sheets["Expenses"][0])
+		// dates are stored as spreadsheet day numbers, amounts as numbers
+		assert.Equal(t, []string{"1", "45750", "", "Groceries", "50.00", "EUR", "Checking", "Trip", "no", "Groceries 30.00; Food 20.00"}, sheets["Expenses"][1])
+		assert.Equal(t, `=HYPERLINK("x")`, sheets["Expenses"][2][2])
+	}
+	assert.Equal(t, [][]string{
+		{"Type", "Category", "Currency", "Entries", "Total"},
+		{"expense", "Fees", "EUR", "1", "12.50"},
+		{"expense", "Food", "EUR", "0", "20.00"},
+		{"expense", "Groceries", "EUR", "1", "30.00"},
+	}, sheets["Summary"])
+
+	// both lists at once, with the same filters
+	w = sendJSON(r, "GET", "/export/transactions?from=2025-04-01&to=2025-04-05", "", 1)
+	assert.Equal(t, http.StatusOK, w.Code)
+	sheets = readXLSX(t, w.Body.Bytes())
+	assert.Len(t, sheets["Expenses"], 2)
+	assert.Len(t, sheets["Incomes"], 2)
+	assert.Equal(t, [][]string{
+		{"Type", "Category", "Currency", "Entries", "Total"},
+		{"expense", "Food", "EUR", "0", "20.00"},
+		{"expense", "Groceries", "EUR", "1", "30.00"},
+		{"income", "Salary", "EUR", "1", "3000.00"},
+	}, sheets["Summary"])
+
+	sheets = readXLSX(t, sendJSON(r, "GET", "/export/transactions", "", 2).Body.Bytes())
+	assert.Equal(t, [][]string{exportColumns[kindExpense]}, sheets["Expenses"])
+
+	assert.Equal(t, http.StatusBadRequest, sendJSON(r, "GET", "/export/transactions?format=csv", "", 1).Code)
+	assert.Equal(t, http.StatusBadRequest, sendJSON(r, "GET", "/export/transactions?from=x", "", 1).Code)
+}
+
+func TestExportTotalsCountSplitExpenseOnce(t *testing.T) {
+	totals := exportTotals{}
+	Expense{Category: "Groceries", Currency: "EUR", Amount: 5000, Splits: []ExpenseSplit{
+		{Category: "Groceries", Amount: 2000}, {Category: "Food", Amount: 1000}, {Category: "Groceries", Amount: 2000},
+	}}.addTotals(totals)
+	Expense{Category: "Food", Currency: "EUR", Amount: 700}.addTotals(totals)
+
+	assert.Equal(t, exportTotal{count: 1, total: 4000}, *totals[exportTotalKey{kindExpense, "Groceries", "EUR"}])
+	assert.Equal(t, exportTotal{count: 1, total: 1700}, *totals[exportTotalKey{kindExpense, "Food", "EUR"}])
+}
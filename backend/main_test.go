@@ -28,34 +28,117 @@ func setupTestDB() {
 	if err != nil {
 		panic("failed to connect test db")
 	}
-	db.AutoMigrate(&User{}, &Expense{}, &Budget{}, &Income{})
+	db.AutoMigrate(&User{}, &Expense{}, &Budget{}, &Income{}, &Session{}, &LoginCode{}, &ExchangeRate{}, &Category{}, &Tag{}, &ExpenseSplit{}, &RecurringRule{}, &RecurringOverride{}, &Bill{}, &BillPayment{}, &Account{}, &Transfer{}, &ImportBatch{}, &CalendarFeed{}, &TransactionRule{})
 }
 
 // setupRouter registers all routes on a Gin engine in TestMode.
 func setupRouter() *gin.Engine {
 	gin.SetMode(gin.TestMode)
+	jwtKey = []byte("test-secret")
 	r := gin.New()
 	r.POST("/register", RegisterUser)
 	r.POST("/login", LoginUser)
-
-	r.POST("/expenses", AddExpense)
-	r.GET("/expenses", GetExpenses)
-	r.DELETE("/expenses/:id", DeleteExpense)
-	r.PUT("/expenses/:id/paid", UpdateExpenseStatus)
-
-	r.GET("/users/:id", GetUser)
+	r.POST("/login/google/exchange", ExchangeLoginCode)
+	r.POST("/auth/refresh", RefreshSession)
+	r.POST("/auth/logout", Logout)
+	r.GET("/ical/:file", ServeCalendarFeed)
+
+	auth := r.Group("/", AuthMiddleware())
+	auth.POST("/expenses", AddExpense)
+	auth.GET("/expenses", GetExpenses)
+	auth.PUT("/expenses/:id", UpdateExpense)
+	auth.PATCH("/expenses/:id", UpdateExpense)
+	auth.DELETE("/expenses/:id", DeleteExpense)
+	auth.PUT("/expenses/:id/paid", UpdateExpenseStatus)
+
+	auth.GET("/users/:id", GetUser)
 	// new user‑update routes
-	r.PUT("/users/:id/username", UpdateUsername)
-	r.PUT("/users/:id/password", UpdatePassword)
-	r.PUT("/users/:id/email", UpdateEmail)
-
-	r.POST("/incomes", AddIncome)
-	r.GET("/incomes", GetIncomes)
-	r.DELETE("/incomes/:id", DeleteIncome)
-
-	r.POST("/budget", SetBudget)
-	r.GET("/budget", GetBudgetDetails)
-	r.DELETE("/budget/:id", DeleteBudget)
+	auth.PUT("/users/:id/username", UpdateUsername)
+	auth.PUT("/users/:id/password", UpdatePassword)
+	auth.PUT("/users/:id/email", UpdateEmail)
+	auth.PUT("/users/:id/base-currency", UpdateBaseCurrency)
+	auth.PUT("/users/:id/timezone", UpdateTimezone)
+
+	auth.POST("/incomes", AddIncome)
+	auth.GET("/incomes", GetIncomes)
+	auth.PUT("/incomes/:id", UpdateIncome)
+	auth.PATCH("/incomes/:id", UpdateIncome)
+	auth.DELETE("/incomes/:id", DeleteIncome)
+
+	auth.POST("/budget", SetBudget)
+	auth.GET("/budget", GetBudgetDetails)
+	auth.PUT("/budget/:id", UpdateBudget)
+	auth.PATCH("/budget/:id", UpdateBudget)
+	auth.DELETE("/budget/:id", DeleteBudget)
+	auth.GET("/budget/:id/progress", GetBudgetProgress)
+
+	auth.GET("/categories", GetCategories)
+	auth.POST("/categories", AddCategory)
+	auth.PUT("/categories/:id", UpdateCategory)
+	auth.PATCH("/categories/:id", UpdateCategory)
+	auth.DELETE("/categories/:id", DeleteCategory)
+	auth.GET("/tags", GetTags)
+	auth.POST("/tags", AddTag)
+	auth.PUT("/tags/:id", RenameTag)
+	auth.PATCH("/tags/:id", RenameTag)
+	auth.POST("/tags/:id/merge", MergeTag)
+	auth.DELETE("/tags/:id", DeleteTag)
+	auth.GET("/recurring", GetRecurringRules)
+	auth.POST("/recurring", AddRecurringRule)
+	auth.PUT("/recurring/:id", UpdateRecurringRule)
+	auth.PATCH("/recurring/:id", UpdateRecurringRule)
+	auth.DELETE("/recurring/:id", DeleteRecurringRule)
+	auth.GET("/recurring/:id/preview", PreviewRecurringRule)
+	auth.PUT("/recurring/:id/occurrences/:date", SetRecurringOverride)
+	auth.DELETE("/recurring/:id/occurrences/:date", DeleteRecurringOverride)
+	auth.GET("/rules", GetTransactionRules)
+	auth.POST("/rules", AddTransactionRule)
+	auth.PUT("/rules/:id", UpdateTransactionRule)
+	auth.PATCH("/rules/:id", UpdateTransactionRule)
+	auth.DELETE("/rules/:id", DeleteTransactionRule)
+	auth.POST("/rules/apply", ApplyTransactionRules)
+	auth.GET("/bills", GetBills)
+	auth.GET("/bills/upcoming", GetUpcomingBills)
+	auth.POST("/bills", AddBill)
+	auth.PUT("/bills/:id", UpdateBill)
+	auth.PATCH("/bills/:id", UpdateBill)
+	auth.DELETE("/bills/:id", DeleteBill)
+	auth.POST("/bills/:id/payments", AddBillPayment)
+	auth.DELETE("/bills/:id/payments/:paymentId", DeleteBillPayment)
+	auth.GET("/accounts", GetAccounts)
+	auth.POST("/accounts", AddAccount)
+	auth.PUT("/accounts/:id", UpdateAccount)
+	auth.PATCH("/accounts/:id", UpdateAccount)
+	auth.DELETE("/accounts/:id", DeleteAccount)
+	auth.GET("/accounts/:id/balance", GetAccountBalance)
+	auth.GET("/accounts/:id/ledger", GetAccountLedger)
+	auth.GET("/transfers", GetTransfers)
+	auth.POST("/transfers", AddTransfer)
+	auth.PUT("/transfers/:id", UpdateTransfer)
+	auth.PATCH("/transfers/:id", UpdateTransfer)
+	auth.DELETE("/transfers/:id", DeleteTransfer)
+	auth.POST("/import/csv", ImportCSV)
+	auth.POST("/import/ofx", ImportOFX)
+	auth.POST("/import/qif", ImportQIF)
+	auth.POST("/import/camt053", ImportCAMT053)
+	auth.POST("/import/mt940", ImportMT940)
+	auth.GET("/imports", GetImportBatches)
+	auth.GET("/imports/:id", GetImportBatch)
+	auth.DELETE("/imports/:id", DeleteImportBatch)
+	auth.POST("/import/archive", RestoreArchive)
+	auth.GET("/export", ExportArchive)
+	auth.GET("/export/ledger", ExportLedger)
+	auth.GET("/export/transactions", ExportTransactions)
+	auth.GET("/calendar/feed", GetCalendarFeed)
+	auth.POST("/calendar/feed", CreateCalendarFeed)
+	auth.DELETE("/calendar/feed", RevokeCalendarFeed)
+	auth.GET("/reports/totals", GetTotals)
+	auth.GET("/reports/cashflow", GetCashflow)
+	auth.GET("/reports/categories", GetCategoryReport)
+	auth.GET("/reports/merchants", GetMerchantReport)
+
+	auth.GET("/auth/sessions", GetSessions)
+	auth.DELETE("/auth/sessions/:id", RevokeSession)
 
 	// OAuth routes
 	r.GET("/login/google", StartGoogleLogin)
@@ -64,6 +147,34 @@ func setupRouter() *gin.Engine {
 	return r
 }
 
+// mustDate parses a YYYY-MM-DD fixture date.
+func mustDate(s string) Date {
+	d, err := ParseDate(s)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+// withAuth signs req with the bearer token of a new session for the given
+// user.
+func withAuth(req *http.Request, userID uint) *http.Request {
+	req.Header.Set("Authorization", "Bearer "+sessionToken(userID))
+	return req
+}
+
+// sessionToken opens a session for the given user and returns its access
+// token.
+func sessionToken(userID uint) string {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("POST", "/login", nil)
+	token, _, err := startSession(c, User{ID: userID, Email: "test@example.com"})
+	if err != nil {
+		panic(err)
+	}
+	return token
+}
+
 // --- Registration tests ---
 
 func TestRegisterUser_Success(t *testing.T) {
@@ -137,6 +248,7 @@ func TestLoginUser_Success(t *testing.T) {
 	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
 	assert.Equal(t, "Login successful", resp["message"])
 	assert.EqualValues(t, 1, resp["userId"])
+	assert.NotEmpty(t, resp["token"])
 }
 
 func TestLoginUser_WrongPassword(t *testing.T) {
@@ -184,7 +296,7 @@ func TestGetUser_SuccessAndPasswordCleared(t *testing.T) {
 	db.Create(&User{FullName: "A", Username: "a", Email: "a@a.com", Password: string(hashed)})
 
 	// found
-	req1 := httptest.NewRequest("GET", "/users/1", nil)
+	req1 := withAuth(httptest.NewRequest("GET", "/users/1", nil), 1)
 	w1 := httptest.NewRecorder()
 	r.ServeHTTP(w1, req1)
 	assert.Equal(t, http.StatusOK, w1.Code)
@@ -194,10 +306,16 @@ func TestGetUser_SuccessAndPasswordCleared(t *testing.T) {
 	assert.Empty(t, u.Password)
 
 	// not found
-	req2 := httptest.NewRequest("GET", "/users/999", nil)
+	req2 := withAuth(httptest.NewRequest("GET", "/users/999", nil), 999)
 	w2 := httptest.NewRecorder()
 	r.ServeHTTP(w2, req2)
 	assert.Equal(t, http.StatusNotFound, w2.Code)
+
+	// someone else's profile
+	req3 := withAuth(httptest.NewRequest("GET", "/users/1", nil), 2)
+	w3 := httptest.NewRecorder()
+	r.ServeHTTP(w3, req3)
+	assert.Equal(t, http.StatusForbidden, w3.Code)
 }
 
 // --- Expense endpoints ---
@@ -207,72 +325,102 @@ func TestExpenseEndpoints(t *testing.T) {
 	r := setupRouter()
 
 	// invalid JSON
-	req0 := httptest.NewRequest("POST", "/expenses", bytes.NewBufferString(`{bad}`))
+	req0 := withAuth(httptest.NewRequest("POST", "/expenses", bytes.NewBufferString(`{bad}`)), 1)
 	req0.Header.Set("Content-Type", "application/json")
 	w0 := httptest.NewRecorder()
 	r.ServeHTTP(w0, req0)
 	assert.Equal(t, http.StatusBadRequest, w0.Code)
 
-	// create
-	req1 := httptest.NewRequest("POST", "/expenses", bytes.NewBufferString(
-		`{"user_id":1,"amount":10,"category":"c","description":"d","date":"2025-04-20"}`,
-	))
+	// create, ignoring the user_id in the body
+	req1 := withAuth(httptest.NewRequest("POST", "/expenses", bytes.NewBufferString(
+		`{"user_id":9,"amount":10,"category":"c","description":"d","date":"2025-04-20"}`,
+	)), 1)
 	req1.Header.Set("Content-Type", "application/json")
 	w1 := httptest.NewRecorder()
 	r.ServeHTTP(w1, req1)
 	assert.Equal(t, http.StatusOK, w1.Code)
-
-	// get missing
+	var created Expense
+	assert.NoError(t, json.Unmarshal(w1.Body.Bytes(), &created))
+	assert.EqualValues(t, 1, created.UserID)
+
+	// create with invalid fields
+	reqBad := withAuth(httptest.NewRequest("POST", "/expenses", bytes.NewBufferString(
+		`{"amount":0,"category":"c","date":"2025-04-20"}`,
+	)), 1)
+	reqBad.Header.Set("Content-Type", "application/json")
+	wBad := httptest.NewRecorder()
+	r.ServeHTTP(wBad, reqBad)
+	assert.Equal(t, http.StatusBadRequest, wBad.Code)
+
+	// get without a token
 	req2 := httptest.NewRequest("GET", "/expenses", nil)
 	w2 := httptest.NewRecorder()
 	r.ServeHTTP(w2, req2)
-	assert.Equal(t, http.StatusBadRequest, w2.Code)
+	assert.Equal(t, http.StatusUnauthorized, w2.Code)
 
 	// get none
-	req3 := httptest.NewRequest("GET", "/expenses?user_id=2", nil)
+	req3 := withAuth(httptest.NewRequest("GET", "/expenses", nil), 2)
 	w3 := httptest.NewRecorder()
 	r.ServeHTTP(w3, req3)
-	assert.Equal(t, http.StatusNotFound, w3.Code)
+	assert.Equal(t, http.StatusOK, w3.Code)
+	assert.JSONEq(t, `{"data":[],"next_cursor":null}`, w3.Body.String())
 
-	// insert & get
-	db.Create(&Expense{UserID: 2, Amount: 5, Category: "x", Description: "y", Date: "2025-04-20"})
-	req4 := httptest.NewRequest("GET", "/expenses?user_id=2", nil)
+	// insert & get, ignoring the user_id query parameter
+	db.Create(&Expense{UserID: 2, Amount: 500, Category: "x", Description: "y", Date: mustDate("2025-04-20")})
+	req4 := withAuth(httptest.NewRequest("GET", "/expenses?user_id=1", nil), 2)
 	w4 := httptest.NewRecorder()
 	r.ServeHTTP(w4, req4)
 	assert.Equal(t, http.StatusOK, w4.Code)
+	var listed listResponse[Expense]
+	assert.NoError(t, json.Unmarshal(w4.Body.Bytes(), &listed))
+	assert.Len(t, listed.Data, 1)
+	assert.EqualValues(t, 2, listed.Data[0].UserID)
 
 	// update missing
-	req5 := httptest.NewRequest("PUT", "/expenses/999/paid", bytes.NewBufferString(`{"paid":true}`))
+	req5 := withAuth(httptest.NewRequest("PUT", "/expenses/999/paid", bytes.NewBufferString(`{"paid":true}`)), 1)
 	req5.Header.Set("Content-Type", "application/json")
 	w5 := httptest.NewRecorder()
 	r.ServeHTTP(w5, req5)
 	assert.Equal(t, http.StatusNotFound, w5.Code)
 
 	// update invalid JSON
-	req6 := httptest.NewRequest("PUT", "/expenses/1/paid", bytes.NewBufferString(`{bad}`))
+	req6 := withAuth(httptest.NewRequest("PUT", "/expenses/1/paid", bytes.NewBufferString(`{bad}`)), 1)
 	req6.Header.Set("Content-Type", "application/json")
 	w6 := httptest.NewRecorder()
 	r.ServeHTTP(w6, req6)
 	assert.Equal(t, http.StatusBadRequest, w6.Code)
 
-	// update success
-	req7 := httptest.NewRequest("PUT", "/expenses/1/paid", bytes.NewBufferString(`{"paid":true}`))
+	// update someone else's
+	req7 := withAuth(httptest.NewRequest("PUT", "/expenses/1/paid", bytes.NewBufferString(`{"paid":true}`)), 2)
 	req7.Header.Set("Content-Type", "application/json")
 	w7 := httptest.NewRecorder()
 	r.ServeHTTP(w7, req7)
-	assert.Equal(t, http.StatusOK, w7.Code)
+	assert.Equal(t, http.StatusForbidden, w7.Code)
+
+	// update success
+	req8 := withAuth(httptest.NewRequest("PUT", "/expenses/1/paid", bytes.NewBufferString(`{"paid":true}`)), 1)
+	req8.Header.Set("Content-Type", "application/json")
+	w8 := httptest.NewRecorder()
+	r.ServeHTTP(w8, req8)
+	assert.Equal(t, http.StatusOK, w8.Code)
+
+	// delete someone else's
+	reqDel0 := withAuth(httptest.NewRequest("DELETE", "/expenses/1", nil), 2)
+	wDel0 := httptest.NewRecorder()
+	r.ServeHTTP(wDel0, reqDel0)
+	assert.Equal(t, http.StatusForbidden, wDel0.Code)
 
 	// delete existing
-	reqDel1 := httptest.NewRequest("DELETE", "/expenses/1", nil)
+	reqDel1 := withAuth(httptest.NewRequest("DELETE", "/expenses/1", nil), 1)
 	wDel1 := httptest.NewRecorder()
 	r.ServeHTTP(wDel1, reqDel1)
 	assert.Equal(t, http.StatusOK, wDel1.Code)
 
 	// delete missing
-	reqDel2 := httptest.NewRequest("DELETE", "/expenses/999", nil)
+	reqDel2 := withAuth(httptest.NewRequest("DELETE", "/expenses/999", nil), 1)
 	wDel2 := httptest.NewRecorder()
 	r.ServeHTTP(wDel2, reqDel2)
-	assert.Equal(t, http.StatusOK, wDel2.Code)
+	assert.Equal(t, http.StatusNotFound, wDel2.Code)
 }
 
 // --- Income endpoints ---
@@ -282,51 +430,65 @@ func TestIncomeEndpoints(t *testing.T) {
 	r := setupRouter()
 
 	// invalid JSON
-	req0 := httptest.NewRequest("POST", "/incomes", bytes.NewBufferString(`{bad}`))
+	req0 := withAuth(httptest.NewRequest("POST", "/incomes", bytes.NewBufferString(`{bad}`)), 1)
 	req0.Header.Set("Content-Type", "application/json")
 	w0 := httptest.NewRecorder()
 	r.ServeHTTP(w0, req0)
 	assert.Equal(t, http.StatusBadRequest, w0.Code)
 
-	// create
-	req1 := httptest.NewRequest("POST", "/incomes", bytes.NewBufferString(
-		`{"user_id":1,"amount":100,"category":"sal","description":"d","date":"2025-04-20"}`,
-	))
+	// create, ignoring the user_id in the body
+	req1 := withAuth(httptest.NewRequest("POST", "/incomes", bytes.NewBufferString(
+		`{"user_id":9,"amount":100,"category":"sal","description":"d","date":"2025-04-20"}`,
+	)), 1)
 	req1.Header.Set("Content-Type", "application/json")
 	w1 := httptest.NewRecorder()
 	r.ServeHTTP(w1, req1)
 	assert.Equal(t, http.StatusOK, w1.Code)
+	var created Income
+	assert.NoError(t, json.Unmarshal(w1.Body.Bytes(), &created))
+	assert.EqualValues(t, 1, created.UserID)
 
-	// get missing
+	// get without a token
 	req2 := httptest.NewRequest("GET", "/incomes", nil)
 	w2 := httptest.NewRecorder()
 	r.ServeHTTP(w2, req2)
-	assert.Equal(t, http.StatusBadRequest, w2.Code)
+	assert.Equal(t, http.StatusUnauthorized, w2.Code)
 
 	// get none
-	req3 := httptest.NewRequest("GET", "/incomes?user_id=2", nil)
+	req3 := withAuth(httptest.NewRequest("GET", "/incomes", nil), 2)
 	w3 := httptest.NewRecorder()
 	r.ServeHTTP(w3, req3)
-	assert.Equal(t, http.StatusNotFound, w3.Code)
+	assert.Equal(t, http.StatusOK, w3.Code)
+	assert.JSONEq(t, `{"data":[],"next_cursor":null}`, w3.Body.String())
 
-	// insert & get
-	db.Create(&Income{UserID: 2, Amount: 50, Category: "x", Description: "y", Date: "2025-04-20"})
-	req4 := httptest.NewRequest("GET", "/incomes?user_id=2", nil)
+	// insert & get, ignoring the user_id query parameter
+	db.Create(&Income{UserID: 2, Amount: 5000, Category: "x", Description: "y", Date: mustDate("2025-04-20")})
+	req4 := withAuth(httptest.NewRequest("GET", "/incomes?user_id=1", nil), 2)
 	w4 := httptest.NewRecorder()
 	r.ServeHTTP(w4, req4)
 	assert.Equal(t, http.StatusOK, w4.Code)
+	var listed listResponse[Income]
+	assert.NoError(t, json.Unmarshal(w4.Body.Bytes(), &listed))
+	assert.Len(t, listed.Data, 1)
+	assert.EqualValues(t, 2, listed.Data[0].UserID)
+
+	// delete someone else's
+	reqDel0 := withAuth(httptest.NewRequest("DELETE", "/incomes/1", nil), 2)
+	wDel0 := httptest.NewRecorder()
+	r.ServeHTTP(wDel0, reqDel0)
+	assert.Equal(t, http.StatusForbidden, wDel0.Code)
 
 	// delete existing
-	reqDel1 := httptest.NewRequest("DELETE", "/incomes/1", nil)
+	reqDel1 := withAuth(httptest.NewRequest("DELETE", "/incomes/1", nil), 1)
 	wDel1 := httptest.NewRecorder()
 	r.ServeHTTP(wDel1, reqDel1)
 	assert.Equal(t, http.StatusOK, wDel1.Code)
 
 	// delete missing
-	reqDel2 := httptest.NewRequest("DELETE", "/incomes/999", nil)
+	reqDel2 := withAuth(httptest.NewRequest("DELETE", "/incomes/999", nil), 1)
 	wDel2 := httptest.NewRecorder()
 	r.ServeHTTP(wDel2, reqDel2)
-	assert.Equal(t, http.StatusOK, wDel2.Code)
+	assert.Equal(t, http.StatusNotFound, wDel2.Code)
 }
 
 // --- Budget endpoints ---
@@ -336,51 +498,64 @@ func TestBudgetEndpoints(t *testing.T) {
 	r := setupRouter()
 
 	// invalid JSON
-	req0 := httptest.NewRequest("POST", "/budget", bytes.NewBufferString(`{bad}`))
+	req0 := withAuth(httptest.NewRequest("POST", "/budget", bytes.NewBufferString(`{bad}`)), 1)
 	req0.Header.Set("Content-Type", "application/json")
 	w0 := httptest.NewRecorder()
 	r.ServeHTTP(w0, req0)
 	assert.Equal(t, http.StatusBadRequest, w0.Code)
 
-	// create
-	req1 := httptest.NewRequest("POST", "/budget", bytes.NewBufferString(
-		`{"user_id":1,"budget_name":"b","budget_amount":100,"start_date":"2025-04-01","end_date":"2025-04-30"}`,
-	))
+	// create, ignoring the user_id in the body
+	req1 := withAuth(httptest.NewRequest("POST", "/budget", bytes.NewBufferString(
+		`{"user_id":9,"budget_name":"b","budget_amount":100,"start_date":"2025-04-01","end_date":"2025-04-30"}`,
+	)), 1)
 	req1.Header.Set("Content-Type", "application/json")
 	w1 := httptest.NewRecorder()
 	r.ServeHTTP(w1, req1)
 	assert.Equal(t, http.StatusOK, w1.Code)
+	var created Budget
+	assert.NoError(t, json.Unmarshal(w1.Body.Bytes(), &created))
+	assert.EqualValues(t, 1, created.UserID)
 
-	// get missing
+	// get without a token
 	req2 := httptest.NewRequest("GET", "/budget", nil)
 	w2 := httptest.NewRecorder()
 	r.ServeHTTP(w2, req2)
-	assert.Equal(t, http.StatusBadRequest, w2.Code)
+	assert.Equal(t, http.StatusUnauthorized, w2.Code)
 
 	// get none
-	req3 := httptest.NewRequest("GET", "/budget?user_id=2", nil)
+	req3 := withAuth(httptest.NewRequest("GET", "/budget", nil), 2)
 	w3 := httptest.NewRecorder()
 	r.ServeHTTP(w3, req3)
 	assert.Equal(t, http.StatusNotFound, w3.Code)
 
-	// insert & get
-	db.Create(&Budget{UserID: 2, BudgetName: "b", BudgetAmount: 50, StartDate: "2025-04-01", EndDate: "2025-04-30"})
-	req4 := httptest.NewRequest("GET", "/budget?user_id=2", nil)
+	// insert & get, ignoring the user_id query parameter
+	db.Create(&Budget{UserID: 2, BudgetName: "b", BudgetAmount: 5000, StartDate: mustDate("2025-04-01"), EndDate: mustDate("2025-04-30")})
+	req4 := withAuth(httptest.NewRequest("GET", "/budget?user_id=1", nil), 2)
 	w4 := httptest.NewRecorder()
 	r.ServeHTTP(w4, req4)
 	assert.Equal(t, http.StatusOK, w4.Code)
+	var listed []Budget
+	assert.NoError(t, json.Unmarshal(w4.Body.Bytes(), &listed))
+	assert.Len(t, listed, 1)
+	assert.EqualValues(t, 2, listed[0].UserID)
+
+	// delete someone else's
+	reqDel0 := withAuth(httptest.NewRequest("DELETE", "/budget/1", nil), 2)
+	wDel0 := httptest.NewRecorder()
+	r.ServeHTTP(wDel0, reqDel0)
+	assert.Equal(t, http.StatusForbidden, wDel0.Code)
 
 	// delete existing
-	reqDel1 := httptest.NewRequest("DELETE", "/budget/1", nil)
+	reqDel1 := withAuth(httptest.NewRequest("DELETE", "/budget/1", nil), 1)
 	wDel1 := httptest.NewRecorder()
 	r.ServeHTTP(wDel1, reqDel1)
 	assert.Equal(t, http.StatusOK, wDel1.Code)
 
 	// delete missing
-	reqDel2 := httptest.NewRequest("DELETE", "/budget/999", nil)
+	reqDel2 := withAuth(httptest.NewRequest("DELETE", "/budget/999", nil), 1)
 	wDel2 := httptest.NewRecorder()
 	r.ServeHTTP(wDel2, reqDel2)
-	assert.Equal(t, http.StatusOK, wDel2.Code)
+	assert.Equal(t, http.StatusNotFound, wDel2.Code)
 }
 
 // --- Helpers & OAuth ---
@@ -396,12 +571,13 @@ func TestJWTandStateHelpers(t *testing.T) {
 
 	// JWT
 	jwtKey = []byte("secret")
-	tkn := generateJWT("e@e.com", 42)
+	tkn := generateJWT("e@e.com", 42, "fam")
 	parsed, err := jwt.Parse(tkn, func(tkn *jwt.Token) (interface{}, error) { return jwtKey, nil })
 	assert.NoError(t, err)
 	claims := parsed.Claims.(jwt.MapClaims)
 	assert.Equal(t, "e@e.com", claims["email"])
 	assert.EqualValues(t, 42, claims["userId"])
+	assert.Equal(t, "fam", claims["sid"])
 	exp := int64(claims["exp"].(float64))
 	assert.True(t, exp > time.Now().Unix())
 }
@@ -473,21 +649,21 @@ func TestUpdateUsernameEndpoint(t *testing.T) {
 
 	// bad ID
 	w := httptest.NewRecorder()
-	req := httptest.NewRequest("PUT", "/users/abc/username", bytes.NewBufferString(`{"username":"x"}`))
+	req := withAuth(httptest.NewRequest("PUT", "/users/abc/username", bytes.NewBufferString(`{"username":"x"}`)), 1)
 	req.Header.Set("Content-Type", "application/json")
 	r.ServeHTTP(w, req)
 	assert.Equal(t, http.StatusBadRequest, w.Code)
 
 	// invalid JSON
 	w = httptest.NewRecorder()
-	req = httptest.NewRequest("PUT", "/users/1/username", bytes.NewBufferString(`{bad}`))
+	req = withAuth(httptest.NewRequest("PUT", "/users/1/username", bytes.NewBufferString(`{bad}`)), 1)
 	req.Header.Set("Content-Type", "application/json")
 	r.ServeHTTP(w, req)
 	assert.Equal(t, http.StatusBadRequest, w.Code)
 
 	// user not found
 	w = httptest.NewRecorder()
-	req = httptest.NewRequest("PUT", "/users/999/username", bytes.NewBufferString(`{"username":"x"}`))
+	req = withAuth(httptest.NewRequest("PUT", "/users/999/username", bytes.NewBufferString(`{"username":"x"}`)), 999)
 	req.Header.Set("Content-Type", "application/json")
 	r.ServeHTTP(w, req)
 	assert.Equal(t, http.StatusNotFound, w.Code)
@@ -496,14 +672,14 @@ func TestUpdateUsernameEndpoint(t *testing.T) {
 	db.Create(&User{FullName: "A", Username: "u1", Email: "a@x.com", Password: "p"})
 	db.Create(&User{FullName: "B", Username: "u2", Email: "b@x.com", Password: "p"})
 	w = httptest.NewRecorder()
-	req = httptest.NewRequest("PUT", "/users/2/username", bytes.NewBufferString(`{"username":"u1"}`))
+	req = withAuth(httptest.NewRequest("PUT", "/users/2/username", bytes.NewBufferString(`{"username":"u1"}`)), 2)
 	req.Header.Set("Content-Type", "application/json")
 	r.ServeHTTP(w, req)
 	assert.Equal(t, http.StatusConflict, w.Code)
 
 	// success
 	w = httptest.NewRecorder()
-	req = httptest.NewRequest("PUT", "/users/1/username", bytes.NewBufferString(`{"username":"newname"}`))
+	req = withAuth(httptest.NewRequest("PUT", "/users/1/username", bytes.NewBufferString(`{"username":"newname"}`)), 1)
 	req.Header.Set("Content-Type", "application/json")
 	r.ServeHTTP(w, req)
 	assert.Equal(t, http.StatusOK, w.Code)
@@ -522,21 +698,21 @@ func TestUpdatePasswordEndpoint(t *testing.T) {
 
 	// bad ID
 	w := httptest.NewRecorder()
-	req := httptest.NewRequest("PUT", "/users/abc/password", bytes.NewBufferString(`{"currentPassword":"a","newPassword":"b"}`))
+	req := withAuth(httptest.NewRequest("PUT", "/users/abc/password", bytes.NewBufferString(`{"currentPassword":"a","newPassword":"b"}`)), 1)
 	req.Header.Set("Content-Type", "application/json")
 	r.ServeHTTP(w, req)
 	assert.Equal(t, http.StatusBadRequest, w.Code)
 
 	// invalid JSON
 	w = httptest.NewRecorder()
-	req = httptest.NewRequest("PUT", "/users/1/password", bytes.NewBufferString(`{bad}`))
+	req = withAuth(httptest.NewRequest("PUT", "/users/1/password", bytes.NewBufferString(`{bad}`)), 1)
 	req.Header.Set("Content-Type", "application/json")
 	r.ServeHTTP(w, req)
 	assert.Equal(t, http.StatusBadRequest, w.Code)
 
 	// user not found
 	w = httptest.NewRecorder()
-	req = httptest.NewRequest("PUT", "/users/999/password", bytes.NewBufferString(`{"currentPassword":"x","newPassword":"y"}`))
+	req = withAuth(httptest.NewRequest("PUT", "/users/999/password", bytes.NewBufferString(`{"currentPassword":"x","newPassword":"y"}`)), 999)
 	req.Header.Set("Content-Type", "application/json")
 	r.ServeHTTP(w, req)
 	assert.Equal(t, http.StatusNotFound, w.Code)
@@ -545,14 +721,14 @@ func TestUpdatePasswordEndpoint(t *testing.T) {
 	hashed, _ := bcrypt.GenerateFromPassword([]byte("right"), bcrypt.DefaultCost)
 	db.Create(&User{FullName: "T", Username: "u", Email: "e@x.com", Password: string(hashed)})
 	w = httptest.NewRecorder()
-	req = httptest.NewRequest("PUT", "/users/1/password", bytes.NewBufferString(`{"currentPassword":"wrong","newPassword":"newpass"}`))
+	req = withAuth(httptest.NewRequest("PUT", "/users/1/password", bytes.NewBufferString(`{"currentPassword":"wrong","newPassword":"newpass"}`)), 1)
 	req.Header.Set("Content-Type", "application/json")
 	r.ServeHTTP(w, req)
 	assert.Equal(t, http.StatusUnauthorized, w.Code)
 
 	// success
 	w = httptest.NewRecorder()
-	req = httptest.NewRequest("PUT", "/users/1/password", bytes.NewBufferString(`{"currentPassword":"right","newPassword":"newpass"}`))
+	req = withAuth(httptest.NewRequest("PUT", "/users/1/password", bytes.NewBufferString(`{"currentPassword":"right","newPassword":"newpass"}`)), 1)
 	req.Header.Set("Content-Type", "application/json")
 	r.ServeHTTP(w, req)
 	assert.Equal(t, http.StatusOK, w.Code)
@@ -568,21 +744,21 @@ func TestUpdateEmailEndpoint(t *testing.T) {
 
 	// bad ID
 	w := httptest.NewRecorder()
-	req := httptest.NewRequest("PUT", "/users/abc/email", bytes.NewBufferString(`{"email":"x@x.com"}`))
+	req := withAuth(httptest.NewRequest("PUT", "/users/abc/email", bytes.NewBufferString(`{"email":"x@x.com"}`)), 1)
 	req.Header.Set("Content-Type", "application/json")
 	r.ServeHTTP(w, req)
 	assert.Equal(t, http.StatusBadRequest, w.Code)
 
 	// invalid JSON
 	w = httptest.NewRecorder()
-	req = httptest.NewRequest("PUT", "/users/1/email", bytes.NewBufferString(`{bad}`))
+	req = withAuth(httptest.NewRequest("PUT", "/users/1/email", bytes.NewBufferString(`{bad}`)), 1)
 	req.Header.Set("Content-Type", "application/json")
 	r.ServeHTTP(w, req)
 	assert.Equal(t, http.StatusBadRequest, w.Code)
 
 	// user not found
 	w = httptest.NewRecorder()
-	req = httptest.NewRequest("PUT", "/users/999/email", bytes.NewBufferString(`{"email":"x@x.com"}`))
+	req = withAuth(httptest.NewRequest("PUT", "/users/999/email", bytes.NewBufferString(`{"email":"x@x.com"}`)), 999)
 	req.Header.Set("Content-Type", "application/json")
 	r.ServeHTTP(w, req)
 	assert.Equal(t, http.StatusNotFound, w.Code)
@@ -591,14 +767,14 @@ func TestUpdateEmailEndpoint(t *testing.T) {
 	db.Create(&User{FullName: "A", Username: "u1", Email: "a@x.com", Password: "p"})
 	db.Create(&User{FullName: "B", Username: "u2", Email: "b@x.com", Password: "p"})
 	w = httptest.NewRecorder()
-	req = httptest.NewRequest("PUT", "/users/2/email", bytes.NewBufferString(`{"email":"a@x.com"}`))
+	req = withAuth(httptest.NewRequest("PUT", "/users/2/email", bytes.NewBufferString(`{"email":"a@x.com"}`)), 2)
 	req.Header.Set("Content-Type", "application/json")
 	r.ServeHTTP(w, req)
 	assert.Equal(t, http.StatusConflict, w.Code)
 
 	// success
 	w = httptest.NewRecorder()
-	req = httptest.NewRequest("PUT", "/users/1/email", bytes.NewBufferString(`{"email":"new@x.com"}`))
+	req = withAuth(httptest.NewRequest("PUT", "/users/1/email", bytes.NewBufferString(`{"email":"new@x.com"}`)), 1)
 	req.Header.Set("Content-Type", "application/json")
 	r.ServeHTTP(w, req)
 	assert.Equal(t, http.StatusOK, w.Code)
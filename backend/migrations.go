@@ -0,0 +1,270 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// migrateMoneyColumns converts the floating-point amount columns written
+// before Money existed into integer cents. It must run before AutoMigrate,
+// which would otherwise change the column type and drop the fractions.
+func migrateMoneyColumns(db *gorm.DB) error {
+	targets := []struct{ table, column string }{
+		{"expenses", "amount"},
+		{"incomes", "amount"},
+		{"budgets", "budget_amount"},
+	}
+	for _, t := range targets {
+		legacy, err := isFractionalColumn(db, t.table, t.column)
+		if err != nil {
+			return err
+		}
+		if !legacy {
+			continue
+		}
+
+		// Amounts finer than a cent cannot be kept exactly; name them so
+		// they can be checked by hand.
+		var lossy []struct {
+			ID     uint
+			Amount float64
+		}
+		err = db.Table(t.table).
+			Select("id, ? AS amount", clause.Column{Name: t.column}).
+			Where("ABS(? * 100 - ROUND(? * 100)) > 0.000001", clause.Column{Name: t.column}, clause.Column{Name: t.column}).
+			Scan(&lossy).Error
+		if err != nil {
+			return err
+		}
+		for _, row := range lossy {
+			log.Printf("migrate %s.%s: row %d amount %v rounded to the nearest cent", t.table, t.column, row.ID, row.Amount)
+		}
+
+		tmp := t.column + "_minor"
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if !tx.Migrator().HasColumn(t.table, tmp) {
+				if err := tx.Exec("ALTER TABLE ? ADD COLUMN ? BIGINT", clause.Table{Name: t.table}, clause.Column{Name: tmp}).Error; err != nil {
+					return err
+				}
+			}
+			if err := tx.Exec("UPDATE ? SET ? = ROUND(? * 100)", clause.Table{Name: t.table}, clause.Column{Name: tmp}, clause.Column{Name: t.column}).Error; err != nil {
+				return err
+			}
+			return replaceColumn(tx, t.table, t.column, tmp)
+		})
+		if err != nil {
+			return fmt.Errorf("migrate %s.%s: %w", t.table, t.column, err)
+		}
+	}
+	return nil
+}
+
+// unparsedValue is a legacy value a migration could not convert.
+type unparsedValue struct {
+	Table, Column string
+	ID            uint
+	Value         string
+}
+
+// legacyTimeLayouts are the formats clients are known to have written into
+// the old free-form date columns, most specific first.
+var legacyTimeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+	"2006/01/02",
+	"01/02/2006",
+	"1/2/2006",
+	"Jan 2, 2006",
+	"January 2, 2006",
+}
+
+func parseLegacyTime(s string) (time.Time, bool) {
+	s = strings.TrimSpace(s)
+	for _, layout := range legacyTimeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// migrateDateColumns converts the free-form text date and creation-time
+// columns into DATE and timestamp columns. Values it cannot parse are left
+// empty and returned so they can be reported.
+func migrateDateColumns(db *gorm.DB) ([]unparsedValue, error) {
+	timestampType := "DATETIME"
+	if db.Dialector.Name() == "postgres" {
+		timestampType = "TIMESTAMPTZ"
+	}
+	targets := []struct {
+		table, column string
+		isDate        bool
+	}{
+		{"expenses", "date", true},
+		{"expenses", "created_at", false},
+		{"incomes", "date", true},
+		{"incomes", "created_at", false},
+		{"budgets", "start_date", true},
+		{"budgets", "end_date", true},
+		{"budgets", "created_at", false},
+	}
+
+	var unparsed []unparsedValue
+	for _, t := range targets {
+		legacy, err := isTextColumn(db, t.table, t.column)
+		if err != nil {
+			return nil, err
+		}
+		if !legacy {
+			continue
+		}
+
+		var rows []struct {
+			ID    uint
+			Value *string
+		}
+		if err := db.Table(t.table).Select("id, ? AS value", clause.Column{Name: t.column}).Scan(&rows).Error; err != nil {
+			return nil, err
+		}
+
+		tmp := t.column + "_new"
+		colType := timestampType
+		if t.isDate {
+			colType = "DATE"
+		}
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if !tx.Migrator().HasColumn(t.table, tmp) {
+				if err := tx.Exec("ALTER TABLE ? ADD COLUMN ? "+colType, clause.Table{Name: t.table}, clause.Column{Name: tmp}).Error; err != nil {
+					return err
+				}
+			}
+			for _, row := range rows {
+				if row.Value == nil || strings.TrimSpace(*row.Value) == "" {
+					continue
+				}
+				parsed, ok := parseLegacyTime(*row.Value)
+				if !ok {
+					unparsed = append(unparsed, unparsedValue{t.table, t.column, row.ID, *row.Value})
+					continue
+				}
+				var value interface{} = parsed.UTC()
+				if t.isDate {
+					value = DateOf(parsed)
+				}
+				if err := tx.Table(t.table).Where("id = ?", row.ID).Update(tmp, value).Error; err != nil {
+					return err
+				}
+			}
+			return replaceColumn(tx, t.table, t.column, tmp)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("migrate %s.%s: %w", t.table, t.column, err)
+		}
+	}
+	return unparsed, nil
+}
+
+// replaceColumn drops table.column and renames tmp to take its place.
+func replaceColumn(tx *gorm.DB, table, column, tmp string) error {
+	if err := tx.Exec("ALTER TABLE ? DROP COLUMN ?", clause.Table{Name: table}, clause.Column{Name: column}).Error; err != nil {
+		return err
+	}
+	return tx.Exec("ALTER TABLE ? RENAME COLUMN ? TO ?", clause.Table{Name: table}, clause.Column{Name: tmp}, clause.Column{Name: column}).Error
+}
+
+// isTextColumn reports whether table.column exists and still has a text type.
+func isTextColumn(db *gorm.DB, table, column string) (bool, error) {
+	return columnTypeContains(db, table, column, "text", "char")
+}
+
+// isFractionalColumn reports whether table.column exists and still has a
+// floating-point or decimal type.
+func isFractionalColumn(db *gorm.DB, table, column string) (bool, error) {
+	return columnTypeContains(db, table, column, "float", "real", "double", "numeric", "decimal")
+}
+
+// columnTypeContains reports whether table.column exists and its database
+// type name contains any of the given fragments.
+func columnTypeContains(db *gorm.DB, table, column string, fragments ...string) (bool, error) {
+	if !db.Migrator().HasTable(table) {
+		return false, nil
+	}
+	cols, err := db.Migrator().ColumnTypes(table)
+	if err != nil {
+		return false, err
+	}
+	for _, col := range cols {
+		if col.Name() != column {
+			continue
+		}
+		name := strings.ToLower(col.DatabaseTypeName())
+		for _, f := range fragments {
+			if strings.Contains(name, f) {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// migrateCategoryNames files transactions written before categories existed
+// under Category rows. Names that differ only in case or surrounding
+// whitespace are merged into one category, named with the spelling used
+// most, and the transactions take that name.
+func migrateCategoryNames(db *gorm.DB) error {
+	targets := []struct {
+		model interface{}
+		kind  string
+	}{
+		{&Expense{}, kindExpense},
+		{&Income{}, kindIncome},
+	}
+	for _, t := range targets {
+		var names []struct {
+			UserID   uint
+			Category string
+			Uses     int64
+		}
+		err := db.Model(t.model).
+			Select("user_id, category, COUNT(*) AS uses").
+			Where("category_id IS NULL AND TRIM(COALESCE(category, '')) <> ''").
+			Group("user_id, category").
+			Order("user_id, uses DESC, category").
+			Scan(&names).Error
+		if err != nil {
+			return err
+		}
+
+		err = db.Transaction(func(tx *gorm.DB) error {
+			for _, n := range names {
+				cat, err := findCategoryByName(tx, n.UserID, t.kind, n.Category)
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					cat = Category{UserID: n.UserID, Name: strings.TrimSpace(n.Category), Kind: t.kind}
+					err = tx.Create(&cat).Error
+				}
+				if err != nil {
+					return err
+				}
+				err = tx.Model(t.model).
+					Where("user_id = ? AND category = ? AND category_id IS NULL", n.UserID, n.Category).
+					Updates(map[string]interface{}{"category_id": cat.ID, "category": cat.Name}).Error
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("migrate %s categories: %w", t.kind, err)
+		}
+	}
+	return nil
+}
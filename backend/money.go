@@ -0,0 +1,197 @@
+package main
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// defaultCurrency is used for records created without a currency code.
+const defaultCurrency = "USD"
+
+// Money is an exact amount held as an integer number of hundredths of the
+// record's currency. It is stored as a BIGINT so that SQL sums stay exact,
+// and travels over JSON as a decimal such as 12.50 whatever the currency,
+// so that 1500 yen read 1500.00. Hundredths are the minor unit of most
+// currencies; amounts in those without one must be whole, and those with
+// three decimals are not accepted (see validCurrency).
+type Money int64
+
+var errInvalidMoney = errors.New("amount must be a decimal with at most two fractional digits")
+
+// ParseMoney parses a plain decimal string such as "12", "-3.5" or "0.07".
+// It rejects exponents and anything finer than a hundredth rather than
+// rounding.
+func ParseMoney(s string) (Money, error) {
+	s = strings.TrimSpace(s)
+	neg := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(s, "-")
+
+	whole, frac, _ := strings.Cut(s, ".")
+	if whole == "" || len(frac) > 2 || !isDigits(whole) || (frac != "" && !isDigits(frac)) {
+		return 0, errInvalidMoney
+	}
+	frac += strings.Repeat("0", 2-len(frac))
+
+	units, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil || units > (math.MaxInt64-99)/100 {
+		return 0, errInvalidMoney
+	}
+	cents, _ := strconv.ParseInt(frac, 10, 64)
+	m := Money(units*100 + cents)
+	if neg {
+		m = -m
+	}
+	return m, nil
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// String formats m with exactly two fractional digits.
+func (m Money) String() string {
+	sign := ""
+	n := int64(m)
+	if n < 0 {
+		sign = "-"
+		n = -n
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, n/100, n%100)
+}
+
+// Float64 returns m in major units. Only use it for ratios and display,
+// never for arithmetic that is stored.
+func (m Money) Float64() float64 {
+	return float64(m) / 100
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// UnmarshalJSON accepts both JSON numbers and strings.
+func (m *Money) UnmarshalJSON(data []byte) error {
+	s := string(data)
+	if s == "null" {
+		return nil
+	}
+	if unquoted, err := strconv.Unquote(s); err == nil {
+		s = unquoted
+	}
+	parsed, err := ParseMoney(s)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+func (Money) GormDataType() string {
+	return "bigint"
+}
+
+func (m Money) Value() (driver.Value, error) {
+	return int64(m), nil
+}
+
+func (m *Money) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*m = 0
+	case int64:
+		*m = Money(v)
+	case float64:
+		*m = Money(math.Round(v))
+	case []byte:
+		n, err := strconv.ParseInt(string(v), 10, 64)
+		if err != nil {
+			return err
+		}
+		*m = Money(n)
+	case string:
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return err
+		}
+		*m = Money(n)
+	default:
+		return fmt.Errorf("cannot scan %T into Money", value)
+	}
+	return nil
+}
+
+// Format formats m with as many fractional digits as currency has minor
+// units, e.g. "1500" for JPY and "12.50" for EUR.
+func (m Money) Format(currency string) string {
+	if currencyDigits(currency) == 0 {
+		return strings.TrimSuffix(m.String(), ".00")
+	}
+	return m.String()
+}
+
+// fits reports whether m can be paid in currency, i.e. is a whole number
+// of its minor units.
+func (m Money) fits(currency string) bool {
+	return currencyDigits(currency) != 0 || m%100 == 0
+}
+
+// minorUnitError is an amount finer than the minor unit of its currency.
+type minorUnitError struct{ field, currency string }
+
+func (e minorUnitError) Error() string {
+	return fmt.Sprintf("%s must be a whole number of %s", e.field, e.currency)
+}
+
+// fractionError answers an amount finer than the minor unit of currency.
+func fractionError(field, currency string) error {
+	return minorUnitError{field, currency}
+}
+
+// zeroDigitCurrencies and threeDigitCurrencies list the ISO 4217
+// currencies whose minor unit is not the hundredth.
+var (
+	zeroDigitCurrencies  = []string{"BIF", "CLP", "DJF", "GNF", "ISK", "JPY", "KMF", "KRW", "PYG", "RWF", "UGX", "UYI", "VND", "VUV", "XAF", "XOF", "XPF"}
+	threeDigitCurrencies = []string{"BHD", "IQD", "JOD", "KWD", "LYD", "OMR", "TND"}
+)
+
+// currencyDigits is the number of minor-unit digits ISO 4217 gives code:
+// 0, 2 or 3.
+func currencyDigits(code string) int {
+	switch {
+	case slices.Contains(zeroDigitCurrencies, code):
+		return 0
+	case slices.Contains(threeDigitCurrencies, code):
+		return 3
+	default:
+		return 2
+	}
+}
+
+// validCurrency reports whether amounts can be held in code: an ISO 4217
+// code whose minor unit is no finer than the hundredth Money counts in.
+func validCurrency(code string) bool {
+	return isCurrencyCode(code) && currencyDigits(code) <= 2
+}
+
+// isCurrencyCode reports whether code looks like an ISO 4217 code.
+func isCurrencyCode(code string) bool {
+	if len(code) != 3 {
+		return false
+	}
+	for _, r := range code {
+		if r < 'A' || r > 'Z' {
+			return false
+		}
+	}
+	return true
+}
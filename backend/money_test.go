@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestParseMoney(t *testing.T) {
+	valid := map[string]Money{
+		"0":        0,
+		"12":       1200,
+		"12.5":     1250,
+		"12.34":    1234,
+		"0.07":     7,
+		"-3.10":    -310,
+		" 100.00 ": 10000,
+	}
+	for in, want := range valid {
+		got, err := ParseMoney(in)
+		assert.NoError(t, err, in)
+		assert.Equal(t, want, got, in)
+	}
+
+	for _, in := range []string{"", "-", ".5", "1.234", "1e3", "12,50", "abc", "1.2.3", "99999999999999999999"} {
+		_, err := ParseMoney(in)
+		assert.Error(t, err, in)
+	}
+}
+
+func TestMoneyJSON(t *testing.T) {
+	var e struct {
+		A Money `json:"a"`
+		B Money `json:"b"`
+	}
+	assert.NoError(t, json.Unmarshal([]byte(`{"a":0.1,"b":"0.2"}`), &e))
+	assert.Equal(t, Money(10), e.A)
+	assert.Equal(t, Money(20), e.B)
+	assert.Equal(t, Money(30), e.A+e.B)
+
+	out, err := json.Marshal(e)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"a":0.10,"b":0.20}`, string(out))
+	assert.Equal(t, "-0.05", Money(-5).String())
+
+	assert.Error(t, json.Unmarshal([]byte(`{"a":0.001}`), &e))
+	assert.Error(t, json.Unmarshal([]byte(`{"a":true}`), &e))
+}
+
+func TestMoneyMinorUnits(t *testing.T) {
+	assert.Equal(t, 0, currencyDigits("JPY"))
+	assert.Equal(t, 2, currencyDigits("EUR"))
+	assert.Equal(t, 3, currencyDigits("KWD"))
+
+	assert.Equal(t, "1500", Money(150000).Format("JPY"))
+	assert.Equal(t, "-7", Money(-700).Format("KRW"))
+	assert.Equal(t, "12.50", Money(1250).Format("USD"))
+
+	assert.True(t, Money(150000).fits("JPY"))
+	assert.False(t, Money(150050).fits("JPY"))
+	assert.True(t, Money(150050).fits("USD"))
+
+	assert.True(t, validCurrency("JPY"))
+	assert.False(t, validCurrency("KWD"))
+	assert.False(t, validCurrency("usd"))
+	assert.True(t, isCurrencyCode("KWD"))
+}
+
+func TestMoneyRoundTripsThroughDB(t *testing.T) {
+	setupTestDB()
+	db.Create(&Expense{UserID: 1, Amount: 1, Category: "c", Date: mustDate("2025-01-01")})
+	db.Create(&Expense{UserID: 1, Amount: 2, Category: "c", Date: mustDate("2025-01-01")})
+
+	var total Money
+	assert.NoError(t, db.Model(&Expense{}).Select("SUM(amount)").Scan(&total).Error)
+	assert.Equal(t, Money(3), total)
+
+	var e Expense
+	db.First(&e)
+	assert.Equal(t, Money(1), e.Amount)
+	assert.Equal(t, "USD", e.Currency)
+}
+
+func TestMigrateMoneyColumns(t *testing.T) {
+	var err error
+	db, err = gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	assert.NoError(t, err)
+
+	// the schema as it was with float64 amounts
+	assert.NoError(t, db.Exec(`CREATE TABLE expenses (id integer PRIMARY KEY, user_id integer, amount real, category text, description text, date text, created_at text)`).Error)
+	assert.NoError(t, db.Exec(`CREATE TABLE budgets (id integer PRIMARY KEY, user_id integer, budget_name text, budget_amount real, start_date text, end_date text, notes text, created_at text)`).Error)
+	db.Exec(`INSERT INTO expenses (id, user_id, amount, category, date) VALUES (1, 1, 12.34, 'c', '2025-01-01'), (2, 1, 0.1, 'c', '2025-01-01'), (3, 1, 19.99, 'c', '2025-01-01')`)
+	db.Exec(`INSERT INTO budgets (id, user_id, budget_name, budget_amount, start_date, end_date) VALUES (1, 1, 'b', 1500.5, '2025-01-01', '2025-01-31')`)
+
+	assert.NoError(t, migrateMoneyColumns(db))
+	// running it again is a no-op
+	assert.NoError(t, migrateMoneyColumns(db))
+	assert.NoError(t, db.AutoMigrate(&Expense{}, &Budget{}))
+
+	var expenses []Expense
+	db.Order("id").Find(&expenses)
+	assert.Len(t, expenses, 3)
+	assert.Equal(t, Money(1234), expenses[0].Amount)
+	assert.Equal(t, Money(10), expenses[1].Amount)
+	assert.Equal(t, Money(1999), expenses[2].Amount)
+	assert.Equal(t, "c", expenses[0].Category)
+
+	var b Budget
+	db.First(&b, 1)
+	assert.Equal(t, Money(150050), b.BudgetAmount)
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	mt940Tag = regexp.MustCompile(`^:(\d\d[A-Z]?):(.*)$`)
+	// :61: value date, entry date, debit/credit mark, funds code, amount,
+	// transaction type, then references.
+	mt940Line = regexp.MustCompile(`^(\d{6})(\d{4})?(RC|RD|C|D)([A-Z])?(\d+,\d*)([NFS][A-Z0-9]{3})(.*)$`)
+)
+
+// mt940Field is a tagged field of an MT940 message, with its continuation
+// lines.
+type mt940Field struct {
+	tag   string
+	lines []string
+}
+
+// mt940Fields splits an MT940 file into fields. SWIFT block headers are
+// dropped, and a lone "-" ends a message.
+func mt940Fields(data string) []mt940Field {
+	var fields []mt940Field
+	for _, line := range strings.Split(strings.TrimPrefix(data, "\ufeff"), "\n") {
+		line = strings.TrimRight(line, "\r ")
+		if strings.HasPrefix(line, "{") {
+			i := strings.Index(line, "{4:")
+			if i < 0 {
+				continue
+			}
+			line = line[i+3:]
+		}
+		switch {
+		case line == "" || line == "}":
+		case line == "-" || line == "-}":
+			fields = append(fields, mt940Field{tag: "-"})
+		case mt940Tag.MatchString(line):
+			m := mt940Tag.FindStringSubmatch(line)
+			fields = append(fields, mt940Field{tag: m[1], lines: []string{m[2]}})
+		case len(fields) > 0:
+			f := &fields[len(fields)-1]
+			f.lines = append(f.lines, line)
+		}
+	}
+	return fields
+}
+
+// parseMT940Date reads a YYMMDD date.
+func parseMT940Date(s string) (Date, error) {
+	d, err := ParseDate("20" + s[0:2] + "-" + s[2:4] + "-" + s[4:6])
+	if err != nil {
+		return Date{}, fmt.Errorf("date %q is not a valid YYMMDD date", s)
+	}
+	return d, nil
+}
+
+// parseMT940Balance reads a balance field such as C250430EUR2254,10.
+func parseMT940Balance(s string) (Money, Date, string, error) {
+	if len(s) < 11 || (s[0] != 'C' && s[0] != 'D') {
+		return 0, Date{}, "", fmt.Errorf("balance %q is not valid", s)
+	}
+	date, err := parseMT940Date(s[1:7])
+	if err != nil {
+		return 0, Date{}, "", err
+	}
+	amount, err := parseStatementAmount(s[10:], ",")
+	if err != nil {
+		return 0, Date{}, "", fmt.Errorf("balance %q is not valid", s)
+	}
+	if s[0] == 'D' {
+		amount = -amount
+	}
+	return amount, date, strings.ToUpper(s[7:10]), nil
+}
+
+// mt940Transaction reads a :61: statement line. The entry date, when
+// given, is the booking date; it takes its year from the value date, which
+// may fall in the next or previous year.
+func mt940Transaction(f mt940Field) statementTransaction {
+	var t statementTransaction
+	m := mt940Line.FindStringSubmatch(f.lines[0])
+	if m == nil {
+		t.Errors = append(t.Errors, fmt.Sprintf("statement line %q is not valid", f.lines[0]))
+		return t
+	}
+	valueDate, err := parseMT940Date(m[1])
+	if err != nil {
+		t.Errors = append(t.Errors, err.Error())
+	}
+	t.Date = valueDate
+	if m[2] != "" && err == nil {
+		month, _ := strconv.Atoi(m[2][:2])
+		day, _ := strconv.Atoi(m[2][2:])
+		year := valueDate.Year()
+		switch {
+		case month == 12 && valueDate.Month() == time.January:
+			year--
+		case month == 1 && valueDate.Month() == time.December:
+			year++
+		}
+		if entry := NewDate(year, time.Month(month), day); entry.Day() == day {
+			t.Date = entry
+		}
+	}
+	if t.Amount, err = parseStatementAmount(m[5], ","); err != nil {
+		t.Errors = append(t.Errors, "amount is not valid")
+	}
+	if m[3] == "D" || m[3] == "RC" {
+		t.Amount = -t.Amount
+	}
+	t.Type = m[6]
+	// The account servicer's reference follows //; the customer's
+	// reference before it is not unique.
+	if _, ref, ok := strings.Cut(m[7], "//"); ok {
+		t.ID = strings.TrimSpace(ref)
+	}
+	if len(f.lines) > 1 {
+		t.Memo = strings.TrimSpace(strings.Join(f.lines[1:], " "))
+	}
+	return t
+}
+
+// describeMT940 fills in a transaction's text from its :86: field. The
+// structured form used by German banks, a three-digit code followed by
+// ?NN subfields, gives the counterparty's name in ?32 and ?33 and the
+// purpose in ?20 to ?29 and ?60 to ?63.
+func describeMT940(t *statementTransaction, f mt940Field) {
+	info := strings.Join(f.lines, "")
+	if len(info) < 4 || info[3] != '?' || strings.Trim(info[:3], "0123456789") != "" {
+		t.Name, t.Memo = strings.Join(f.lines, " "), ""
+		return
+	}
+	var name, purpose string
+	for _, sub := range strings.Split(info[4:], "?") {
+		if len(sub) < 2 {
+			continue
+		}
+		code, text := sub[:2], sub[2:]
+		switch {
+		case code == "32" || code == "33":
+			name += text
+		case code >= "20" && code <= "29", code >= "60" && code <= "63":
+			purpose += text
+		}
+	}
+	t.Name, t.Memo = name, purpose
+}
+
+// parseMT940 reads the statements in an MT940 file, one per :20: field.
+func parseMT940(data string) ([]bankStatement, error) {
+	var statements []bankStatement
+	var st *bankStatement
+	var last string
+	for _, f := range mt940Fields(data) {
+		if f.tag == "20" || st == nil && f.tag != "-" {
+			statements = append(statements, bankStatement{})
+			st = &statements[len(statements)-1]
+		}
+		switch f.tag {
+		case "-":
+			st = nil
+		case "25":
+			st.Account = strings.TrimSpace(f.lines[0])
+		case "60F", "60M":
+			if _, _, currency, err := parseMT940Balance(f.lines[0]); err == nil {
+				st.Currency = currency
+			}
+		case "61":
+			st.Transactions = append(st.Transactions, mt940Transaction(f))
+		case "86":
+			if last == "61" {
+				describeMT940(&st.Transactions[len(st.Transactions)-1], f)
+			}
+		case "62F", "62M":
+			amount, date, currency, err := parseMT940Balance(f.lines[0])
+			if err != nil {
+				return nil, err
+			}
+			st.LedgerBalance, st.BalanceDate = &amount, date
+			if st.Currency == "" {
+				st.Currency = currency
+			}
+		}
+		last = f.tag
+	}
+	if len(statements) == 0 {
+		return nil, errors.New("file is not an MT940 statement")
+	}
+	for _, st := range statements {
+		if st.Account == "" {
+			return nil, errors.New("statement has no account (field :25:)")
+		}
+	}
+	return statements, nil
+}
+
+// ImportMT940 reads a SWIFT MT940 statement uploaded as the multipart
+// field file. The optional field settings holds account_id and
+// default_category as JSON; the currency is the statement's.
+// Transactions are recognised by the bank's reference, or by their date,
+// amount and text when there is none.
+func ImportMT940(c *gin.Context) {
+	var settings importSettings
+	if !bindImportSettings(c, &settings) {
+		return
+	}
+	data, ok := readImportFile(c, maxImportFileSize)
+	if !ok {
+		return
+	}
+	statements, err := parseMT940(data)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	importStatements(c, "mt940", settings, statements)
+}
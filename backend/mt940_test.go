@@ -0,0 +1,45 @@
+package main
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseMT940(t *testing.T) {
+	data, err := os.ReadFile("testdata/mt940/statement.sta")
+	assert.NoError(t, err)
+	statements, err := parseMT940(string(data))
+	assert.NoError(t, err)
+	if !assert.Len(t, statements, 1) {
+		return
+	}
+	st := statements[0]
+	assert.Equal(t, "37040044/0532013000", st.Account)
+	assert.Equal(t, "EUR", st.Currency)
+	assert.Equal(t, Money(225410), *st.LedgerBalance)
+	assert.Equal(t, mustDate("2025-04-30"), st.BalanceDate)
+	if assert.Len(t, st.Transactions, 3) {
+		assert.Equal(t, statementTransaction{ID: "BK20250401001", Type: "NMSC", Date: mustDate("2025-04-01"), Amount: -4590,
+			Name: "Supermarkt GmbH", Memo: "Einkauf 0815"}, st.Transactions[0])
+		assert.Equal(t, Money(250000), st.Transactions[1].Amount)
+		assert.Equal(t, "Gehalt April Personalnr 42", st.Transactions[1].Memo)
+		assert.Equal(t, "ACME GmbH", st.Transactions[1].Name)
+		assert.Empty(t, st.Transactions[2].ID)
+		assert.Equal(t, "Miete April Hausverwaltung", st.Transactions[2].Name)
+	}
+
+	// a booking on 31 December valued on 2 January
+	statements, err = parseMT940(":20:X\n:25:DE1\n:61:2501021231RD12,00NTRFREF\n:62F:C250102EUR0,00\n-\n")
+	assert.NoError(t, err)
+	if assert.Len(t, statements[0].Transactions, 1) {
+		assert.Equal(t, mustDate("2024-12-31"), statements[0].Transactions[0].Date)
+		assert.Equal(t, Money(1200), statements[0].Transactions[0].Amount) // a reversed debit
+	}
+
+	_, err = parseMT940("date,amount\n")
+	assert.Error(t, err)
+	_, err = parseMT940(":20:X\n:61:2501020102D1,00NTRFREF\n-\n")
+	assert.Error(t, err)
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ofxNode is an element of an OFX document. Aggregates have children;
+// elements have a value.
+type ofxNode struct {
+	name     string
+	value    string
+	children []*ofxNode
+}
+
+// child returns the first direct child named name, or nil.
+func (n *ofxNode) child(name string) *ofxNode {
+	for _, c := range n.children {
+		if c.name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// text returns the value of the element at path below n, or "".
+func (n *ofxNode) text(path ...string) string {
+	for _, name := range path {
+		if n = n.child(name); n == nil {
+			return ""
+		}
+	}
+	return n.value
+}
+
+// findAll returns every aggregate below n named one of names.
+func (n *ofxNode) findAll(names ...string) []*ofxNode {
+	var found []*ofxNode
+	for _, c := range n.children {
+		for _, name := range names {
+			if c.name == name {
+				found = append(found, c)
+			}
+		}
+		found = append(found, c.findAll(names...)...)
+	}
+	return found
+}
+
+// parseOFX reads an OFX document. Version 1 files are SGML, whose elements
+// usually have no end tags, and version 2 files are XML; both are read by
+// treating a tag followed by text as an element and any other tag as the
+// start of an aggregate, which its end tag closes.
+func parseOFX(data string) (*ofxNode, error) {
+	start := strings.Index(strings.ToUpper(data), "<OFX>")
+	if start < 0 {
+		return nil, errors.New("file is not an OFX statement")
+	}
+	data = data[start:]
+
+	root := &ofxNode{}
+	stack := []*ofxNode{root}
+	for len(data) > 0 {
+		open := strings.IndexByte(data, '<')
+		if open < 0 {
+			break
+		}
+		end := strings.IndexByte(data[open:], '>')
+		if end < 0 {
+			return nil, errors.New("OFX tag is not closed")
+		}
+		tag := strings.TrimSpace(data[open+1 : open+end])
+		data = data[open+end+1:]
+		if tag == "" || tag[0] == '?' || tag[0] == '!' {
+			continue
+		}
+
+		if tag[0] == '/' {
+			name := strings.ToUpper(strings.TrimSpace(tag[1:]))
+			for i := len(stack) - 1; i > 0; i-- {
+				if stack[i].name == name {
+					stack = stack[:i]
+					break
+				}
+			}
+			continue
+		}
+
+		name := strings.ToUpper(strings.Fields(tag)[0])
+		node := &ofxNode{name: name}
+		parent := stack[len(stack)-1]
+		parent.children = append(parent.children, node)
+
+		next := strings.IndexByte(data, '<')
+		if next < 0 {
+			next = len(data)
+		}
+		if value := strings.TrimSpace(data[:next]); value != "" {
+			node.value = html.UnescapeString(value)
+			data = data[next:]
+			// An XML element's end tag belongs to it, not to an aggregate.
+			if closing := "</" + name + ">"; strings.HasPrefix(strings.ToUpper(data), closing) {
+				data = data[len(closing):]
+			}
+			continue
+		}
+		stack = append(stack, node)
+	}
+	if root.child("OFX") == nil {
+		return nil, errors.New("file is not an OFX statement")
+	}
+	return root, nil
+}
+
+// parseOFXDate reads the date part of an OFX datetime such as
+// 20250401120000.000[-5:EST].
+func parseOFXDate(s string) (Date, error) {
+	if len(s) < 8 {
+		return Date{}, fmt.Errorf("date %q is not an OFX date", s)
+	}
+	d, err := ParseDate(s[0:4] + "-" + s[4:6] + "-" + s[6:8])
+	if err != nil {
+		return Date{}, fmt.Errorf("date %q is not an OFX date", s)
+	}
+	return d, nil
+}
+
+// ofxStatements returns the bank and credit card statements in doc.
+func ofxStatements(doc *ofxNode) ([]bankStatement, error) {
+	var statements []bankStatement
+	for _, rs := range doc.findAll("STMTRS", "CCSTMTRS") {
+		st := bankStatement{Currency: strings.ToUpper(rs.text("CURDEF"))}
+		if st.Account = rs.text("BANKACCTFROM", "ACCTID"); st.Account == "" {
+			st.Account = rs.text("CCACCTFROM", "ACCTID")
+		}
+		if bal := rs.child("LEDGERBAL"); bal != nil {
+			amount, err := parseBankAmount(bal.text("BALAMT"))
+			if err != nil {
+				return nil, errors.New("LEDGERBAL has an invalid BALAMT")
+			}
+			date, err := parseOFXDate(bal.text("DTASOF"))
+			if err != nil {
+				return nil, err
+			}
+			st.LedgerBalance, st.BalanceDate = &amount, date
+		}
+		if list := rs.child("BANKTRANLIST"); list != nil {
+			for _, trn := range list.children {
+				if trn.name == "STMTTRN" {
+					st.Transactions = append(st.Transactions, ofxTransaction(trn))
+				}
+			}
+		}
+		statements = append(statements, st)
+	}
+	if len(statements) == 0 {
+		return nil, errors.New("file has no bank or credit card statement")
+	}
+	return statements, nil
+}
+
+// ofxTransaction reads a STMTTRN aggregate. Its FITID, which banks keep
+// unique per account, is the transaction's id.
+func ofxTransaction(trn *ofxNode) statementTransaction {
+	t := statementTransaction{ID: trn.text("FITID"), Type: trn.text("TRNTYPE"), Name: trn.text("NAME"), Memo: trn.text("MEMO")}
+	var err error
+	if t.Date, err = parseOFXDate(trn.text("DTPOSTED")); err != nil {
+		t.Errors = append(t.Errors, "DTPOSTED is missing or invalid")
+	}
+	if t.Amount, err = parseBankAmount(trn.text("TRNAMT")); err != nil {
+		t.Errors = append(t.Errors, "TRNAMT is missing or invalid")
+	}
+	return t
+}
+
+// ImportOFX reads an OFX or QFX statement uploaded as the multipart field
+// file. The optional field settings holds account_id and default_category
+// as JSON; the currency is the statement's. Transactions are recognised by
+// FITID, so importing a file again adds nothing. When an account is given
+// and the statement has a ledger balance, the response compares the two.
+func ImportOFX(c *gin.Context) {
+	var settings importSettings
+	if !bindImportSettings(c, &settings) {
+		return
+	}
+	data, ok := readImportFile(c, maxImportFileSize)
+	if !ok {
+		return
+	}
+	doc, err := parseOFX(data)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	statements, err := ofxStatements(doc)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	importStatements(c, "ofx", settings, statements)
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func readOFXFixture(t *testing.T, name string) []bankStatement {
+	data, err := os.ReadFile("testdata/ofx/" + name)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	doc, err := parseOFX(string(data))
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	statements, err := ofxStatements(doc)
+	if !assert.NoError(t, err) || !assert.Len(t, statements, 1) {
+		t.FailNow()
+	}
+	return statements
+}
+
+func TestParseOFX(t *testing.T) {
+	// version 1, SGML without end tags
+	st := readOFXFixture(t, "checking.ofx")[0]
+	assert.Equal(t, "USD", st.Currency)
+	assert.Equal(t, "000123456789", st.Account)
+	assert.Equal(t, Money(225410), *st.LedgerBalance)
+	assert.Equal(t, mustDate("2025-04-30"), st.BalanceDate)
+	if assert.Len(t, st.Transactions, 3) {
+		assert.Equal(t, statementTransaction{ID: "2025040101", Type: "POS", Date: mustDate("2025-04-01"), Amount: -4590,
+			Name: "TRADER JOE&S #123", Memo: "Groceries"}, st.Transactions[0])
+		assert.Equal(t, Money(250000), st.Transactions[1].Amount)
+		assert.Equal(t, "Rent April", st.Transactions[2].Memo)
+	}
+
+	// version 2, XML with a decimal comma
+	st = readOFXFixture(t, "card.qfx")[0]
+	assert.Equal(t, "EUR", st.Currency)
+	assert.Equal(t, "4111XXXXXXXX1111", st.Account)
+	assert.Equal(t, Money(-7949), *st.LedgerBalance)
+	rows := st.rows("ofx", "Card")
+	if assert.Len(t, rows, 3) {
+		assert.Equal(t, importRow{Kind: kindExpense, Date: mustDate("2025-04-10"), Amount: 1999,
+			Description: "Streaming Service", Category: "Card", ExternalID: "ofx:4111XXXXXXXX1111:CC-0001"}, rows[0])
+		assert.Equal(t, kindIncome, rows[1].Kind)
+		assert.Equal(t, "Cashback", rows[1].Description)
+		assert.Equal(t, "Café Central", rows[2].Description)
+	}
+
+	for _, s := range []string{"", "date,amount\n", "<OFX><SIGNONMSGSRSV1></SIGNONMSGSRSV1></OFX>"} {
+		doc, err := parseOFX(s)
+		if err == nil {
+			_, err = ofxStatements(doc)
+		}
+		assert.Error(t, err, s)
+	}
+}
+
+func TestImportOFX(t *testing.T) {
+	setupTestDB()
+	r := setupRouter()
+	db.Create(&User{FullName: "A", Username: "a", Email: "a@x.com", Password: "p", BaseCurrency: "USD"})
+	db.Create(&[]Account{
+		{UserID: 1, Name: "Checking", Type: accountChecking, Currency: "USD", OpeningBalance: 100000},
+		{UserID: 1, Name: "Card", Type: accountCreditCard, Currency: "EUR"},
+	})
+	data, _ := os.ReadFile("testdata/ofx/checking.ofx")
+	checking := string(data)
+	settings := map[string]string{"settings": `{"account_id":1}`}
+
+	// preview
+	w := uploadFile(r, "/import/ofx", checking, settings, 1)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var result importResult
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+	assert.False(t, result.Committed)
+	assert.Equal(t, 3, result.Valid)
+	assert.Equal(t, "Uncategorized", result.Rows[0].Category)
+	assert.Equal(t, &balanceCheck{Date: mustDate("2025-04-30"), StatementBalance: 225410, AccountBalance: 225410, Matches: true}, result.BalanceCheck)
+
+	settings["commit"] = "true"
+	w = uploadFile(r, "/import/ofx", checking, settings, 1)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+	assert.True(t, result.Committed)
+	assert.Equal(t, 2, result.Expenses)
+	assert.Equal(t, 1, result.Incomes)
+
+	var expense Expense
+	db.Where("external_id = ?", "ofx:000123456789:2025040101").First(&expense)
+	assert.Equal(t, Money(4590), expense.Amount)
+	assert.Equal(t, "USD", expense.Currency)
+	if assert.NotNil(t, expense.AccountID) {
+		assert.EqualValues(t, 1, *expense.AccountID)
+	}
+
+	// importing the same file again is a no-op
+	w = uploadFile(r, "/import/ofx", checking, settings, 1)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+	assert.Equal(t, 0, result.Valid)
+	assert.Equal(t, 3, result.Duplicates)
+	assert.Zero(t, result.Expenses+result.Incomes)
+	assert.True(t, result.BalanceCheck.Matches)
+	var count int64
+	db.Model(&Expense{}).Count(&count)
+	assert.EqualValues(t, 2, count)
+	db.Model(&Income{}).Count(&count)
+	assert.EqualValues(t, 1, count)
+
+	// the card statement is in euros, so it cannot go to the dollar account
+	data, _ = os.ReadFile("testdata/ofx/card.qfx")
+	w = uploadFile(r, "/import/ofx", string(data), map[string]string{"settings": `{"account_id":1}`}, 1)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = uploadFile(r, "/import/ofx", string(data), map[string]string{"settings": `{"account_id":2}`}, 1)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+	assert.Equal(t, Money(-7949), result.BalanceCheck.AccountBalance)
+	assert.True(t, result.BalanceCheck.Matches)
+
+	assert.Equal(t, http.StatusBadRequest, uploadFile(r, "/import/ofx", "date,amount\n", nil, 1).Code)
+	assert.Equal(t, http.StatusBadRequest, uploadFile(r, "/import/ofx", checking, map[string]string{"settings": "{"}, 1).Code)
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// qifSettings adds the order of day and month, which QIF leaves to the
+// program that wrote the file.
+type qifSettings struct {
+	importSettings
+	DateFormat string `json:"date_format"` // MM/DD/YYYY (default) or DD/MM/YYYY
+}
+
+// parseQIFDate reads a QIF date such as 4/ 1'25, 04/01/2025 or 2025-04-01.
+// Two-digit years before 70 are in this century.
+func parseQIFDate(s string, dayFirst bool) (Date, error) {
+	parts := strings.Split(strings.NewReplacer("'", "/", "-", "/", ".", "/", " ", "").Replace(s), "/")
+	if len(parts) != 3 {
+		return Date{}, fmt.Errorf("date %q is not a QIF date", s)
+	}
+	var n [3]int
+	for i, p := range parts {
+		v, err := strconv.Atoi(p)
+		if err != nil {
+			return Date{}, fmt.Errorf("date %q is not a QIF date", s)
+		}
+		n[i] = v
+	}
+	y, m, d, yearDigits := n[2], n[0], n[1], len(parts[2])
+	switch {
+	case len(parts[0]) == 4:
+		y, m, d, yearDigits = n[0], n[1], n[2], 4
+	case dayFirst:
+		m, d = n[1], n[0]
+	}
+	if yearDigits <= 2 {
+		if y < 70 {
+			y += 2000
+		} else {
+			y += 1900
+		}
+	}
+	date := NewDate(y, time.Month(m), d)
+	if date.Year() != y || int(date.Month()) != m || date.Day() != d {
+		return Date{}, fmt.Errorf("date %q is not a QIF date", s)
+	}
+	return date, nil
+}
+
+// qifCategory reads an L field: Parent:Child/Class names a category, of
+// which the most specific part is kept, and [Account] a transfer, which
+// has none.
+func qifCategory(s string) string {
+	if strings.HasPrefix(s, "[") {
+		return ""
+	}
+	s, _, _ = strings.Cut(s, "/")
+	if i := strings.LastIndex(s, ":"); i >= 0 {
+		s = s[i+1:]
+	}
+	return strings.TrimSpace(s)
+}
+
+// parseQIF reads the bank, cash and credit card registers in a QIF file,
+// one statement each. Investment registers and lists of categories or
+// classes are skipped. Splits are read as a single transaction.
+func parseQIF(data string, dayFirst bool) ([]bankStatement, error) {
+	var statements []bankStatement
+	var st *bankStatement
+	account, inAccount := "", false
+	fields := map[byte]string{}
+
+	for _, line := range strings.Split(strings.TrimPrefix(data, "\ufeff"), "\n") {
+		line = strings.TrimRight(line, "\r")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if line[0] == '!' {
+			header := strings.ToLower(strings.TrimSpace(line))
+			inAccount = header == "!account"
+			switch header {
+			case "!type:bank", "!type:cash", "!type:ccard", "!type:oth a", "!type:oth l":
+				statements = append(statements, bankStatement{Account: account})
+				st = &statements[len(statements)-1]
+			default:
+				if !strings.HasPrefix(header, "!option") && !strings.HasPrefix(header, "!clear") {
+					st = nil
+				}
+			}
+			clear(fields)
+			continue
+		}
+		if line[0] != '^' {
+			// S, E and $ lines belong to splits; only the first
+			// occurrence of other codes is kept.
+			if _, ok := fields[line[0]]; !ok {
+				fields[line[0]] = strings.TrimSpace(line[1:])
+			}
+			continue
+		}
+
+		switch {
+		case inAccount:
+			account = fields['N']
+		case st != nil:
+			t := statementTransaction{Name: fields['P'], Memo: fields['M'], Category: qifCategory(fields['L'])}
+			var err error
+			if s := fields['D']; s == "" {
+				t.Errors = append(t.Errors, "date is missing")
+			} else if t.Date, err = parseQIFDate(s, dayFirst); err != nil {
+				t.Errors = append(t.Errors, err.Error())
+			}
+			amount := fields['T']
+			if amount == "" {
+				amount = fields['U']
+			}
+			if t.Amount, err = parseBankAmount(amount); err != nil {
+				t.Errors = append(t.Errors, "amount is missing or invalid")
+			}
+			st.Transactions = append(st.Transactions, t)
+		}
+		clear(fields)
+	}
+	if len(statements) == 0 {
+		return nil, errors.New("file has no bank, cash or credit card register")
+	}
+	return statements, nil
+}
+
+// ImportQIF reads a QIF file uploaded as the multipart field file. The
+// optional field settings holds currency, account_id, default_category and
+// date_format as JSON. QIF has no transaction ids, so transactions are
+// recognised by their date, amount, payee and memo.
+func ImportQIF(c *gin.Context) {
+	var settings qifSettings
+	if !bindImportSettings(c, &settings) {
+		return
+	}
+	dayFirst := false
+	switch strings.ToUpper(settings.DateFormat) {
+	case "", "MM/DD/YYYY":
+	case "DD/MM/YYYY":
+		dayFirst = true
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "date_format must be MM/DD/YYYY or DD/MM/YYYY"})
+		return
+	}
+	data, ok := readImportFile(c, maxImportFileSize)
+	if !ok {
+		return
+	}
+	statements, err := parseQIF(data, dayFirst)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	importStatements(c, "qif", settings.importSettings, statements)
+}
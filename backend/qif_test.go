@@ -0,0 +1,60 @@
+package main
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseQIFDate(t *testing.T) {
+	for s, want := range map[string]string{
+		"4/ 1'25":    "2025-04-01",
+		"04/01/2025": "2025-04-01",
+		"4/1/99":     "1999-04-01",
+		"2025-04-01": "2025-04-01",
+	} {
+		got, err := parseQIFDate(s, false)
+		assert.NoError(t, err, s)
+		assert.Equal(t, mustDate(want), got, s)
+	}
+	got, err := parseQIFDate("13.04.2025", true)
+	assert.NoError(t, err)
+	assert.Equal(t, mustDate("2025-04-13"), got)
+
+	for _, s := range []string{"13/04/2025", "4/31'25", "April 1", "1/2"} {
+		_, err := parseQIFDate(s, false)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestParseQIF(t *testing.T) {
+	data, err := os.ReadFile("testdata/qif/checking.qif")
+	assert.NoError(t, err)
+	statements, err := parseQIF(string(data), false)
+	assert.NoError(t, err)
+	if !assert.Len(t, statements, 1) {
+		return
+	}
+	st := statements[0]
+	assert.Equal(t, "Everyday Checking", st.Account)
+	assert.Empty(t, st.Currency)
+	if assert.Len(t, st.Transactions, 7) {
+		assert.Equal(t, statementTransaction{Date: mustDate("2025-04-01"), Amount: -4590, Name: "Trader Joe's",
+			Memo: "Weekly shop", Category: "Groceries"}, st.Transactions[0])
+		assert.Equal(t, Money(250000), st.Transactions[1].Amount)
+		assert.Equal(t, "Housing", st.Transactions[2].Category) // the class is dropped
+		assert.Equal(t, Money(-120000), st.Transactions[2].Amount)
+		assert.Empty(t, st.Transactions[5].Category) // a transfer
+		assert.Len(t, st.Transactions[6].Errors, 1)
+	}
+
+	// identical transactions get distinct fingerprints
+	rows := st.rows("qif", "Uncategorized")
+	assert.Equal(t, "Uncategorized", rows[3].Category)
+	assert.NotEqual(t, rows[3].ExternalID, rows[4].ExternalID)
+	assert.Equal(t, rows[3].ExternalID[:len(rows[3].ExternalID)-1], rows[4].ExternalID[:len(rows[4].ExternalID)-1])
+
+	_, err = parseQIF("!Type:Invst\nD4/1'25\nT1.00\n^\n", false)
+	assert.Error(t, err)
+}
@@ -0,0 +1,438 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Recurrence frequencies, named after the RRULE FREQ values of RFC 5545.
+const (
+	freqDaily   = "daily"
+	freqWeekly  = "weekly"
+	freqMonthly = "monthly"
+	freqYearly  = "yearly"
+)
+
+// RecurringRule creates an expense or income from its template fields every
+// Interval days, weeks, months or years from StartDate, until EndDate or
+// Count occurrences, whichever comes first. Monthly and yearly occurrences
+// that fall on a day the month lacks, such as the 31st, move to the last
+// day of the month.
+type RecurringRule struct {
+	ID        uint   `json:"id" gorm:"primaryKey"`
+	UserID    uint   `json:"user_id" gorm:"not null;index"`
+	Kind      string `json:"kind" gorm:"not null"`
+	Frequency string `json:"frequency" gorm:"not null"`
+	Interval  int    `json:"interval" gorm:"not null;default:1"`
+	StartDate Date   `json:"start_date" gorm:"not null"`
+	EndDate   Date   `json:"end_date"`
+	Count     int    `json:"count"` // 0 for no limit
+
+	Amount      Money  `json:"amount"`
+	Currency    string `json:"currency" gorm:"size:3;not null;default:USD"`
+	AccountID   *uint  `json:"account_id"`
+	CategoryID  *uint  `json:"category_id"`
+	Category    string `json:"category"`
+	Description string `json:"description"`
+
+	// Generated counts the occurrences already handled, skipped ones
+	// included. NextDate is the first one still to come, or null once the
+	// rule has run out.
+	Generated int       `json:"generated"`
+	NextDate  Date      `json:"next_date" gorm:"index"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (r RecurringRule) OwnerID() uint { return r.UserID }
+
+// RecurringOverride changes or skips one occurrence of a rule before it is
+// generated. Zero fields keep the rule's values.
+type RecurringOverride struct {
+	ID          uint    `json:"id" gorm:"primaryKey"`
+	RuleID      uint    `json:"rule_id" gorm:"not null;uniqueIndex:idx_rule_occurrence"`
+	Occurrence  Date    `json:"occurrence" gorm:"not null;uniqueIndex:idx_rule_occurrence"`
+	Skip        bool    `json:"skip"`
+	Date        Date    `json:"date"` // the day to book it on instead
+	Amount      Money   `json:"amount"`
+	Description *string `json:"description"`
+}
+
+// occurrence returns the date of the rule's nth occurrence, counting from 0.
+func (r RecurringRule) occurrence(n int) Date {
+	k := n * r.Interval
+	switch r.Frequency {
+	case freqDaily:
+		return r.StartDate.AddDays(k)
+	case freqWeekly:
+		return r.StartDate.AddDays(7 * k)
+	case freqYearly:
+		return addMonthsClamped(r.StartDate, 12*k)
+	default:
+		return addMonthsClamped(r.StartDate, k)
+	}
+}
+
+// addMonthsClamped moves d by months, keeping its day of the month where
+// the target month has it and using the month's last day otherwise.
+func addMonthsClamped(d Date, months int) Date {
+	first := NewDate(d.Year(), d.Month(), 1).AddMonths(months)
+	last := first.AddMonths(1).AddDays(-1).Day()
+	day := d.Day()
+	if day > last {
+		day = last
+	}
+	return NewDate(first.Year(), first.Month(), day)
+}
+
+// ended reports whether the rule has no nth occurrence.
+func (r RecurringRule) ended(n int) bool {
+	if r.Count > 0 && n >= r.Count {
+		return true
+	}
+	return !r.EndDate.IsZero() && r.occurrence(n).After(r.EndDate)
+}
+
+// seek returns the index of the first occurrence on or after d.
+func (r RecurringRule) seek(d Date) int {
+	n := 0
+	for !r.ended(n) && r.occurrence(n).Before(d) {
+		n++
+	}
+	return n
+}
+
+// advanceTo records that every occurrence before n has been handled.
+func (r *RecurringRule) advanceTo(n int) {
+	r.Generated = n
+	r.NextDate = Date{}
+	if !r.ended(n) {
+		r.NextDate = r.occurrence(n)
+	}
+}
+
+func (r RecurringRule) validate() error {
+	if r.Kind != kindExpense && r.Kind != kindIncome {
+		return errors.New("kind must be expense or income")
+	}
+	switch r.Frequency {
+	case freqDaily, freqWeekly, freqMonthly, freqYearly:
+	default:
+		return errors.New("frequency must be daily, weekly, monthly or yearly")
+	}
+	if r.Interval < 1 {
+		return errors.New("interval must be at least 1")
+	}
+	if r.StartDate.IsZero() {
+		return errors.New("start_date is required")
+	}
+	if !r.EndDate.IsZero() && r.EndDate.Before(r.StartDate) {
+		return errors.New("end_date must not be before start_date")
+	}
+	if r.Count < 0 {
+		return errors.New("count must not be negative")
+	}
+	if r.Amount <= 0 {
+		return errors.New("amount must be greater than zero")
+	}
+	if r.CategoryID == nil && strings.TrimSpace(r.Category) == "" {
+		return errors.New("category is required")
+	}
+	if !validCurrency(r.Currency) {
+		return errInvalidCurrency
+	}
+	if !r.Amount.fits(r.Currency) {
+		return fractionError("amount", r.Currency)
+	}
+	return nil
+}
+
+// normalize fills in defaults and accepts RRULE spellings such as MONTHLY.
+func (r *RecurringRule) normalize() {
+	r.Kind = strings.ToLower(strings.TrimSpace(r.Kind))
+	r.Frequency = strings.ToLower(strings.TrimSpace(r.Frequency))
+	if r.Interval == 0 {
+		r.Interval = 1
+	}
+	r.Currency = currencyFor(r.UserID, r.Currency)
+}
+
+// scheduleChanged reports whether a and b produce different dates.
+func scheduleChanged(a, b RecurringRule) bool {
+	return a.Frequency != b.Frequency || a.Interval != b.Interval || a.StartDate != b.StartDate ||
+		a.EndDate != b.EndDate || a.Count != b.Count
+}
+
+// plannedOccurrence is an occurrence as it will be generated.
+type plannedOccurrence struct {
+	Occurrence  Date   `json:"occurrence"`
+	Date        Date   `json:"date"`
+	Amount      Money  `json:"amount"`
+	Currency    string `json:"currency"`
+	Category    string `json:"category"`
+	Description string `json:"description"`
+	Skipped     bool   `json:"skipped"`
+}
+
+// plan applies the override for the occurrence on day, if any.
+func (r RecurringRule) plan(day Date, o *RecurringOverride) plannedOccurrence {
+	p := plannedOccurrence{Occurrence: day, Date: day, Amount: r.Amount, Currency: r.Currency, Category: r.Category, Description: r.Description}
+	if o == nil {
+		return p
+	}
+	p.Skipped = o.Skip
+	if !o.Date.IsZero() {
+		p.Date = o.Date
+	}
+	if o.Amount != 0 {
+		p.Amount = o.Amount
+	}
+	if o.Description != nil {
+		p.Description = *o.Description
+	}
+	return p
+}
+
+func loadOverrides(tx *gorm.DB, ruleID uint) (map[Date]*RecurringOverride, error) {
+	var overrides []RecurringOverride
+	if err := tx.Where("rule_id = ?", ruleID).Find(&overrides).Error; err != nil {
+		return nil, err
+	}
+	byDate := map[Date]*RecurringOverride{}
+	for i := range overrides {
+		byDate[overrides[i].Occurrence] = &overrides[i]
+	}
+	return byDate, nil
+}
+
+func GetRecurringRules(c *gin.Context) {
+	rules := []RecurringRule{}
+	if err := db.Where("user_id = ?", currentUserID(c)).Order("id").Find(&rules).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve recurring rules"})
+		return
+	}
+	c.JSON(http.StatusOK, rules)
+}
+
+// AddRecurringRule saves a rule and books any occurrences already due.
+func AddRecurringRule(c *gin.Context) {
+	var rule RecurringRule
+	if err := c.ShouldBindJSON(&rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	rule.ID = 0
+	rule.UserID = currentUserID(c)
+	rule.CreatedAt = time.Time{}
+	rule.normalize()
+	if err := rule.validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := checkAccount(rule.UserID, rule.AccountID, rule.Currency); err != nil {
+		accountError(c, err)
+		return
+	}
+	var err error
+	if rule.CategoryID, rule.Category, err = resolveCategory(rule.UserID, rule.Kind, rule.CategoryID, rule.Category); err != nil {
+		categoryError(c, err)
+		return
+	}
+	rule.advanceTo(0)
+
+	if err := db.Create(&rule).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save recurring rule"})
+		return
+	}
+	if err := generateRule(&rule, today(rule.UserID)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate occurrences"})
+		return
+	}
+	c.JSON(http.StatusOK, rule)
+}
+
+// UpdateRecurringRule replaces or patches a rule. Occurrences already
+// generated stay as they are; a new schedule applies from the next
+// occurrence that was due.
+func UpdateRecurringRule(c *gin.Context) {
+	var rule RecurringRule
+	if !findOwned(c, &rule, "Recurring rule not found") {
+		return
+	}
+
+	var updated RecurringRule
+	if err := bindUpdate(c, rule, &updated); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	updated.ID, updated.UserID, updated.CreatedAt = rule.ID, rule.UserID, rule.CreatedAt
+	updated.Generated, updated.NextDate = rule.Generated, rule.NextDate
+	updated.normalize()
+	if updated.Kind != rule.Kind {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "kind cannot be changed"})
+		return
+	}
+	if err := updated.validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := checkAccount(updated.UserID, updated.AccountID, updated.Currency); err != nil {
+		accountError(c, err)
+		return
+	}
+	if renamedOnly(updated.CategoryID, rule.CategoryID, updated.Category, rule.Category) {
+		updated.CategoryID = nil
+	}
+	var err error
+	if updated.CategoryID, updated.Category, err = resolveCategory(updated.UserID, updated.Kind, updated.CategoryID, updated.Category); err != nil {
+		categoryError(c, err)
+		return
+	}
+
+	if scheduleChanged(rule, updated) {
+		from := rule.NextDate
+		if from.IsZero() {
+			from = today(rule.UserID)
+		}
+		updated.advanceTo(updated.seek(from))
+	}
+
+	if err := db.Save(&updated).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update recurring rule"})
+		return
+	}
+	if err := generateRule(&updated, today(updated.UserID)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate occurrences"})
+		return
+	}
+	c.JSON(http.StatusOK, updated)
+}
+
+// DeleteRecurringRule stops a rule. The transactions it generated are kept.
+func DeleteRecurringRule(c *gin.Context) {
+	var rule RecurringRule
+	if !findOwned(c, &rule, "Recurring rule not found") {
+		return
+	}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		for _, model := range []interface{}{&Expense{}, &Income{}} {
+			if err := tx.Model(model).Where("recurring_rule_id = ?", rule.ID).Update("recurring_rule_id", nil).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Where("rule_id = ?", rule.ID).Delete(&RecurringOverride{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&rule).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete recurring rule"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Recurring rule deleted"})
+}
+
+// PreviewRecurringRule lists the next occurrences, 10 unless count says
+// otherwise, with any overrides applied.
+func PreviewRecurringRule(c *gin.Context) {
+	var rule RecurringRule
+	if !findOwned(c, &rule, "Recurring rule not found") {
+		return
+	}
+	count := 10
+	if s := c.Query("count"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > 100 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "count must be between 1 and 100"})
+			return
+		}
+		count = n
+	}
+	overrides, err := loadOverrides(db, rule.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load overrides"})
+		return
+	}
+
+	upcoming := []plannedOccurrence{}
+	for n := rule.Generated; len(upcoming) < count && !rule.ended(n); n++ {
+		day := rule.occurrence(n)
+		upcoming = append(upcoming, rule.plan(day, overrides[day]))
+	}
+	c.JSON(http.StatusOK, upcoming)
+}
+
+// findOccurrence loads the caller's rule and checks that the :date route
+// parameter is one of its occurrences still to come. It writes the error
+// response itself and reports whether the handler should continue.
+func findOccurrence(c *gin.Context, rule *RecurringRule) (Date, bool) {
+	if !findOwned(c, rule, "Recurring rule not found") {
+		return Date{}, false
+	}
+	day, err := ParseDate(c.Param("date"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return Date{}, false
+	}
+	n := rule.seek(day)
+	if rule.ended(n) || rule.occurrence(n) != day {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Not an occurrence of this rule"})
+		return Date{}, false
+	}
+	if n < rule.Generated {
+		c.JSON(http.StatusConflict, gin.H{"error": "Occurrence already generated; edit the transaction instead"})
+		return Date{}, false
+	}
+	return day, true
+}
+
+// SetRecurringOverride skips or edits one upcoming occurrence.
+func SetRecurringOverride(c *gin.Context) {
+	var rule RecurringRule
+	day, ok := findOccurrence(c, &rule)
+	if !ok {
+		return
+	}
+	var override RecurringOverride
+	if err := c.ShouldBindJSON(&override); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	if override.Amount < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "amount must not be negative"})
+		return
+	}
+	override.RuleID, override.Occurrence = rule.ID, day
+
+	var existing RecurringOverride
+	if err := db.Where("rule_id = ? AND occurrence = ?", rule.ID, day).First(&existing).Error; err == nil {
+		override.ID = existing.ID
+	} else {
+		override.ID = 0
+	}
+	if err := db.Save(&override).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save override"})
+		return
+	}
+	c.JSON(http.StatusOK, rule.plan(day, &override))
+}
+
+// DeleteRecurringOverride restores an occurrence to the rule's template.
+func DeleteRecurringOverride(c *gin.Context) {
+	var rule RecurringRule
+	day, ok := findOccurrence(c, &rule)
+	if !ok {
+		return
+	}
+	if err := db.Where("rule_id = ? AND occurrence = ?", rule.ID, day).Delete(&RecurringOverride{}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete override"})
+		return
+	}
+	c.JSON(http.StatusOK, rule.plan(day, nil))
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecurringOccurrences(t *testing.T) {
+	monthly := RecurringRule{Frequency: freqMonthly, Interval: 1, StartDate: mustDate("2025-01-31")}
+	assert.Equal(t, mustDate("2025-02-28"), monthly.occurrence(1))
+	assert.Equal(t, mustDate("2025-03-31"), monthly.occurrence(2))
+	assert.Equal(t, mustDate("2025-04-30"), monthly.occurrence(3))
+
+	leap := RecurringRule{Frequency: freqYearly, Interval: 1, StartDate: mustDate("2024-02-29")}
+	assert.Equal(t, mustDate("2025-02-28"), leap.occurrence(1))
+	assert.Equal(t, mustDate("2028-02-29"), leap.occurrence(4))
+
+	fortnightly := RecurringRule{Frequency: freqWeekly, Interval: 2, StartDate: mustDate("2025-04-01"), EndDate: mustDate("2025-04-29")}
+	assert.Equal(t, mustDate("2025-04-15"), fortnightly.occurrence(1))
+	assert.False(t, fortnightly.ended(2))
+	assert.True(t, fortnightly.ended(3))
+	assert.Equal(t, 1, fortnightly.seek(mustDate("2025-04-02")))
+
+	limited := RecurringRule{Frequency: freqDaily, Interval: 3, StartDate: mustDate("2025-04-01"), Count: 2}
+	assert.Equal(t, mustDate("2025-04-04"), limited.occurrence(1))
+	assert.True(t, limited.ended(2))
+	limited.advanceTo(2)
+	assert.True(t, limited.NextDate.IsZero())
+}
+
+func TestRecurringRuleEndpoints(t *testing.T) {
+	setupTestDB()
+	r := setupRouter()
+	db.Create(&User{FullName: "A", Username: "a", Email: "a@x.com", Password: "p", BaseCurrency: "USD"})
+
+	for _, body := range []string{
+		`{"kind":"transfer","frequency":"monthly","start_date":"2025-01-31","amount":10,"category":"Rent"}`,
+		`{"kind":"expense","frequency":"hourly","start_date":"2025-01-31","amount":10,"category":"Rent"}`,
+		`{"kind":"expense","frequency":"monthly","amount":10,"category":"Rent"}`,
+		`{"kind":"expense","frequency":"monthly","start_date":"2025-01-31","end_date":"2025-01-01","amount":10,"category":"Rent"}`,
+		`{"kind":"expense","frequency":"monthly","start_date":"2025-01-31","amount":0,"category":"Rent"}`,
+	} {
+		assert.Equal(t, http.StatusBadRequest, sendJSON(r, "POST", "/recurring", body, 1).Code, body)
+	}
+
+	// a rule starting in the past catches up at once
+	w := sendJSON(r, "POST", "/recurring", `{"kind":"expense","frequency":"MONTHLY","start_date":"2025-01-31","count":3,
+		"amount":"1200.00","category":"Rent","description":"Flat"}`, 1)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var rent RecurringRule
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &rent))
+	assert.Equal(t, freqMonthly, rent.Frequency)
+	assert.Equal(t, 3, rent.Generated)
+	assert.True(t, rent.NextDate.IsZero())
+
+	var expenses []Expense
+	db.Where("recurring_rule_id = ?", rent.ID).Order("date").Find(&expenses)
+	if assert.Len(t, expenses, 3) {
+		assert.Equal(t, mustDate("2025-02-28"), expenses[1].Date)
+		assert.Equal(t, Money(120000), expenses[1].Amount)
+		assert.NotNil(t, expenses[1].CategoryID)
+	}
+
+	// running again books nothing twice
+	assert.NoError(t, generateRule(&rent, today(1)))
+	db.Model(&rent).Update("generated", 0)
+	assert.NoError(t, generateRule(&rent, today(1)))
+	var count int64
+	db.Model(&Expense{}).Where("recurring_rule_id = ?", rent.ID).Count(&count)
+	assert.EqualValues(t, 3, count)
+
+	// a future rule can be previewed and its occurrences skipped or edited
+	start := today(1).AddDays(7)
+	w = sendJSON(r, "POST", "/recurring", `{"kind":"income","frequency":"weekly","start_date":"`+start.String()+`",
+		"amount":500,"category":"Salary"}`, 1)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var salary RecurringRule
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &salary))
+	assert.Equal(t, 0, salary.Generated)
+	assert.Equal(t, start, salary.NextDate)
+
+	second, third := start.AddDays(7).String(), start.AddDays(14).String()
+	assert.Equal(t, http.StatusOK, sendJSON(r, "PUT", "/recurring/2/occurrences/"+second, `{"skip":true}`, 1).Code)
+	assert.Equal(t, http.StatusOK, sendJSON(r, "PUT", "/recurring/2/occurrences/"+second, `{"amount":750,"description":"With bonus"}`, 1).Code)
+	assert.Equal(t, http.StatusOK, sendJSON(r, "PUT", "/recurring/2/occurrences/"+third, `{"skip":true}`, 1).Code)
+
+	var preview []plannedOccurrence
+	assert.Equal(t, http.StatusOK, getJSON(r, "/recurring/2/preview?count=4", 1, &preview))
+	if assert.Len(t, preview, 4) {
+		assert.Equal(t, Money(50000), preview[0].Amount)
+		assert.False(t, preview[1].Skipped)
+		assert.Equal(t, Money(75000), preview[1].Amount)
+		assert.Equal(t, "With bonus", preview[1].Description)
+		assert.True(t, preview[2].Skipped)
+	}
+	assert.Equal(t, http.StatusOK, sendJSON(r, "DELETE", "/recurring/2/occurrences/"+third, "", 1).Code)
+	assert.Equal(t, http.StatusOK, getJSON(r, "/recurring/2/preview", 1, &preview))
+	assert.Len(t, preview, 10)
+	assert.False(t, preview[2].Skipped)
+
+	// the first rule's occurrences are history, and dates off the schedule are not occurrences
+	assert.Equal(t, http.StatusConflict, sendJSON(r, "PUT", "/recurring/1/occurrences/2025-02-28", `{"skip":true}`, 1).Code)
+	assert.Equal(t, http.StatusNotFound, sendJSON(r, "PUT", "/recurring/2/occurrences/"+start.AddDays(1).String(), `{"skip":true}`, 1).Code)
+	assert.Equal(t, http.StatusBadRequest, getJSON(r, "/recurring/2/preview?count=0", 1, &preview))
+	assert.Equal(t, http.StatusForbidden, getJSON(r, "/recurring/2/preview", 2, &preview))
+
+	// after downtime the scheduler catches up in one go
+	generateDue(start.AddDays(15).Time())
+	var incomes []Income
+	db.Where("recurring_rule_id = ?", salary.ID).Order("date").Find(&incomes)
+	if assert.Len(t, incomes, 3) {
+		assert.Equal(t, start, incomes[0].Date)
+		assert.Equal(t, Money(75000), incomes[1].Amount)
+		assert.Equal(t, "With bonus", incomes[1].Description)
+		assert.Equal(t, start.AddDays(14), incomes[2].Date)
+	}
+	db.First(&salary, salary.ID)
+	assert.Equal(t, 3, salary.Generated)
+	assert.Equal(t, start.AddDays(21), salary.NextDate)
+
+	// changing the schedule applies from the next occurrence
+	w = sendJSON(r, "PATCH", "/recurring/2", `{"frequency":"monthly"}`, 1)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &salary))
+	assert.Equal(t, addMonthsClamped(start, 1), salary.NextDate)
+	assert.Equal(t, http.StatusBadRequest, sendJSON(r, "PATCH", "/recurring/2", `{"kind":"expense"}`, 1).Code)
+
+	// deleting a rule keeps what it generated
+	assert.Equal(t, http.StatusOK, sendJSON(r, "DELETE", "/recurring/2", "", 1).Code)
+	db.Model(&Income{}).Where("recurring_rule_id IS NULL").Count(&count)
+	assert.EqualValues(t, 3, count)
+	db.Model(&RecurringOverride{}).Count(&count)
+	assert.Zero(t, count)
+	var rules []RecurringRule
+	assert.Equal(t, http.StatusOK, getJSON(r, "/recurring", 1, &rules))
+	assert.Len(t, rules, 1)
+}
+
+func TestRecurringCatchUpInBatches(t *testing.T) {
+	setupTestDB()
+	r := setupRouter()
+	db.Create(&User{FullName: "A", Username: "a", Email: "a@x.com", Password: "p", BaseCurrency: "USD"})
+
+	// the request books one batch; the scheduler books the rest
+	start := today(1).AddDays(-generateBatchSize - 99)
+	w := sendJSON(r, "POST", "/recurring", `{"kind":"expense","frequency":"daily","start_date":"`+start.String()+`",
+		"amount":1,"category":"Coffee"}`, 1)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var rule RecurringRule
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &rule))
+	assert.Equal(t, generateBatchSize, rule.Generated)
+	assert.Equal(t, start.AddDays(generateBatchSize), rule.NextDate)
+
+	generateDue(time.Now())
+	var count int64
+	db.Model(&Expense{}).Where("recurring_rule_id = ?", rule.ID).Count(&count)
+	assert.EqualValues(t, generateBatchSize+100, count)
+	db.First(&rule, rule.ID)
+	assert.Equal(t, today(1).AddDays(1), rule.NextDate)
+}
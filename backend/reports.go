@@ -0,0 +1,512 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// dateRange reads the optional from/to query parameters; an absent bound
+// is the zero Date. It writes the error response itself and reports
+// whether the handler should continue.
+func dateRange(c *gin.Context) (Date, Date, bool) {
+	var from, to Date
+	var errFrom, errTo error
+	if s := c.Query("from"); s != "" {
+		from, errFrom = ParseDate(s)
+	}
+	if s := c.Query("to"); s != "" {
+		to, errTo = ParseDate(s)
+	}
+	if errFrom != nil || errTo != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from and to must be formatted as YYYY-MM-DD"})
+		return Date{}, Date{}, false
+	}
+	if !from.IsZero() && !to.IsZero() && to.Before(from) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "to must not be before from"})
+		return Date{}, Date{}, false
+	}
+	return from, to, true
+}
+
+// inDateRange limits query to transactions dated within [from, to].
+func inDateRange(query *gorm.DB, from, to Date) *gorm.DB {
+	if !from.IsZero() {
+		query = query.Where("date >= ?", from)
+	}
+	if !to.IsZero() {
+		query = query.Where("date <= ?", to)
+	}
+	return query
+}
+
+// sumConverted totals the amount column of query in cv's currency. The
+// database sums per currency and date, and only those partial sums are
+// converted, each at the rate for its date.
+func sumConverted(query *gorm.DB, cv *converter) (Money, error) {
+	var rows []struct {
+		Currency string
+		Date     Date
+		Total    Money
+	}
+	if err := query.Select("currency, date, SUM(amount) AS total").Group("currency, date").Scan(&rows).Error; err != nil {
+		return 0, err
+	}
+
+	var sum Money
+	for _, row := range rows {
+		converted, err := cv.Convert(row.Total, row.Currency, row.Date)
+		if err != nil {
+			return 0, err
+		}
+		sum += converted
+	}
+	return sum, nil
+}
+
+// reportError answers a failed report query, telling the caller when it
+// failed only for lack of exchange rates.
+func reportError(c *gin.Context, err error) {
+	if errors.Is(err, errNoRate) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build report"})
+}
+
+func GetTotals(c *gin.Context) {
+	from, to, ok := dateRange(c)
+	if !ok {
+		return
+	}
+	tags, ok := parseTagFilter(c)
+	if !ok {
+		return
+	}
+	userID := currentUserID(c)
+	cv := newConverter(db, baseCurrencyOf(userID))
+
+	income, err := sumConverted(inDateRange(reportTransactions(userID, kindIncome, tags), from, to), cv)
+	if err != nil {
+		reportError(c, err)
+		return
+	}
+	expenses, err := sumConverted(inDateRange(reportTransactions(userID, kindExpense, tags), from, to), cv)
+	if err != nil {
+		reportError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"currency": cv.target,
+		"income":   income,
+		"expenses": expenses,
+		"net":      income - expenses,
+	})
+}
+
+// granularity is the length of the periods a report is broken into.
+type granularity string
+
+const (
+	byWeek  granularity = "week"
+	byMonth granularity = "month"
+	byYear  granularity = "year"
+)
+
+// periodStart returns the first day of the period d falls in. Weeks start
+// on Monday, as ISO 8601 has them.
+func (g granularity) periodStart(d Date) Date {
+	switch g {
+	case byWeek:
+		return d.AddDays(-((int(d.Weekday()) + 6) % 7))
+	case byYear:
+		return NewDate(d.Year(), time.January, 1)
+	default:
+		return NewDate(d.Year(), d.Month(), 1)
+	}
+}
+
+// next returns the first day of the period after the one starting at start.
+func (g granularity) next(start Date) Date {
+	switch g {
+	case byWeek:
+		return start.AddDays(7)
+	case byYear:
+		return start.AddMonths(12)
+	default:
+		return start.AddMonths(1)
+	}
+}
+
+// label names the period starting at start, e.g. 2025-W16, 2025-04 or 2025.
+func (g granularity) label(start Date) string {
+	switch g {
+	case byWeek:
+		year, week := start.Time().ISOWeek()
+		return fmt.Sprintf("%d-W%02d", year, week)
+	case byYear:
+		return strconv.Itoa(start.Year())
+	default:
+		return start.Time().Format("2006-01")
+	}
+}
+
+// periodExpr is the SQL for the first day of the period the date column
+// falls in, as YYYY-MM-DD text.
+func (g granularity) periodExpr(db *gorm.DB) string {
+	if db.Dialector.Name() == "postgres" {
+		return fmt.Sprintf("to_char(date_trunc('%s', date), 'YYYY-MM-DD')", g)
+	}
+	switch g {
+	case byWeek:
+		return "date(date, '-' || ((CAST(strftime('%w', date) AS INTEGER) + 6) % 7) || ' days')"
+	case byYear:
+		return "strftime('%Y-01-01', date)"
+	default:
+		return "strftime('%Y-%m-01', date)"
+	}
+}
+
+// groupTotal is the converted sum of one group of transactions and how
+// many transactions it holds.
+type groupTotal struct {
+	Total Money `json:"total"`
+	Count int64 `json:"count"`
+}
+
+// sumGrouped totals the amount column of query per value of the SQL
+// expression key, in cv's currency. The database does the summing; amounts
+// already in the target currency come back as one row per key, and others
+// per day so that each can be converted at its own rate.
+func sumGrouped(query *gorm.DB, key string, cv *converter) (map[string]groupTotal, error) {
+	var rows []struct {
+		Key      string
+		Currency string
+		RateDate Date
+		Total    Money
+		Count    int64
+	}
+	err := query.
+		Select(key+" AS key, currency, CASE WHEN currency = ? THEN NULL ELSE date END AS rate_date, SUM(amount) AS total, COUNT(DISTINCT id) AS count", cv.target).
+		Group("1, 2, 3").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	groups := map[string]groupTotal{}
+	for _, row := range rows {
+		converted, err := cv.Convert(row.Total, row.Currency, row.RateDate)
+		if err != nil {
+			return nil, err
+		}
+		g := groups[row.Key]
+		g.Total += converted
+		g.Count += row.Count
+		groups[row.Key] = g
+	}
+	return groups, nil
+}
+
+// sumByPeriod totals the amount column of query per period in cv's
+// currency, keyed by the first day of each period.
+func sumByPeriod(query *gorm.DB, g granularity, cv *converter) (map[Date]Money, error) {
+	groups, err := sumGrouped(query, g.periodExpr(query), cv)
+	if err != nil {
+		return nil, err
+	}
+	sums := map[Date]Money{}
+	for key, group := range groups {
+		var start Date
+		if err := start.Scan(key); err != nil {
+			return nil, err
+		}
+		sums[start] = group.Total
+	}
+	return sums, nil
+}
+
+// percent returns part as a percentage of whole, to two decimal places.
+func percent(part, whole Money) float64 {
+	return math.Round(float64(part)/float64(whole)*10000) / 100
+}
+
+// cashflowPeriod is one row of the cash-flow report. SavingsRate is the
+// share of income not spent, in percent, and null without income.
+type cashflowPeriod struct {
+	Period      string   `json:"period"`
+	Start       Date     `json:"start"`
+	End         Date     `json:"end"`
+	Income      Money    `json:"income"`
+	Expenses    Money    `json:"expenses"`
+	Net         Money    `json:"net"`
+	SavingsRate *float64 `json:"savings_rate"`
+}
+
+func GetCashflow(c *gin.Context) {
+	g := granularity(c.DefaultQuery("granularity", string(byMonth)))
+	if g != byWeek && g != byMonth && g != byYear {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "granularity must be week, month or year"})
+		return
+	}
+	from, to, ok := dateRange(c)
+	if !ok {
+		return
+	}
+	tags, ok := parseTagFilter(c)
+	if !ok {
+		return
+	}
+	userID := currentUserID(c)
+	cv := newConverter(db, baseCurrencyOf(userID))
+
+	income, err := sumByPeriod(inDateRange(reportTransactions(userID, kindIncome, tags), from, to), g, cv)
+	if err != nil {
+		reportError(c, err)
+		return
+	}
+	expenses, err := sumByPeriod(inDateRange(reportTransactions(userID, kindExpense, tags), from, to), g, cv)
+	if err != nil {
+		reportError(c, err)
+		return
+	}
+
+	// Report every period in the range, including the empty ones, from the
+	// requested bounds or else the first and last with any transactions.
+	var first, last Date
+	if !from.IsZero() {
+		first = g.periodStart(from)
+	}
+	if !to.IsZero() {
+		last = g.periodStart(to)
+	}
+	for _, sums := range []map[Date]Money{income, expenses} {
+		for start := range sums {
+			if from.IsZero() && (first.IsZero() || start.Before(first)) {
+				first = start
+			}
+			if to.IsZero() && (last.IsZero() || start.After(last)) {
+				last = start
+			}
+		}
+	}
+
+	periods := []cashflowPeriod{}
+	if !first.IsZero() && !last.IsZero() {
+		for start := first; !start.After(last); start = g.next(start) {
+			p := cashflowPeriod{
+				Period:   g.label(start),
+				Start:    start,
+				End:      g.next(start).AddDays(-1),
+				Income:   income[start],
+				Expenses: expenses[start],
+			}
+			p.Net = p.Income - p.Expenses
+			if p.Income > 0 {
+				rate := percent(p.Net, p.Income)
+				p.SavingsRate = &rate
+			}
+			periods = append(periods, p)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"currency":    cv.target,
+		"granularity": g,
+		"periods":     periods,
+	})
+}
+
+// reportWindow reads from/to for a report comparing two periods, defaulting
+// to the current month so far in the user's time zone. The previous window
+// is as many days long and ends the day before from.
+func reportWindow(c *gin.Context, userID uint) (from, to, prevFrom, prevTo Date, ok bool) {
+	if from, to, ok = dateRange(c); !ok {
+		return
+	}
+	if to.IsZero() {
+		to = today(userID)
+		if !from.IsZero() && to.Before(from) {
+			to = from
+		}
+	}
+	if from.IsZero() {
+		from = byMonth.periodStart(to)
+	}
+	prevTo = from.AddDays(-1)
+	prevFrom = prevTo.AddDays(-from.DaysUntil(to))
+	return from, to, prevFrom, prevTo, true
+}
+
+// reportTransactions returns the user's transactions of one kind that
+// carry the filtered tags. Split expenses count line by line.
+func reportTransactions(userID uint, kind string, tags tagFilter) *gorm.DB {
+	query := expenseLines()
+	if kind == kindIncome {
+		query = db.Model(&Income{})
+	}
+	return tags.apply(query.Where("user_id = ?", userID), kind)
+}
+
+// transactionsOfKind returns the base query for the user's expenses or
+// incomes, as chosen by the kind query parameter, filtered by tag.
+func transactionsOfKind(c *gin.Context, userID uint) (*gorm.DB, string, bool) {
+	kind := c.DefaultQuery("kind", kindExpense)
+	if kind != kindExpense && kind != kindIncome {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "kind must be expense or income"})
+		return nil, "", false
+	}
+	tags, ok := parseTagFilter(c)
+	if !ok {
+		return nil, "", false
+	}
+	return reportTransactions(userID, kind, tags), kind, true
+}
+
+// categoryTotal is one row of the category report. Change is the percent
+// change from the previous period, and null when nothing was recorded then.
+type categoryTotal struct {
+	Category      string   `json:"category"`
+	Total         Money    `json:"total"`
+	Count         int64    `json:"count"`
+	Share         float64  `json:"share"`
+	PreviousTotal Money    `json:"previous_total"`
+	Change        *float64 `json:"change"`
+}
+
+func GetCategoryReport(c *gin.Context) {
+	userID := currentUserID(c)
+	from, to, prevFrom, prevTo, ok := reportWindow(c, userID)
+	if !ok {
+		return
+	}
+	base, kind, ok := transactionsOfKind(c, userID)
+	if !ok {
+		return
+	}
+	cv := newConverter(db, baseCurrencyOf(userID))
+
+	current, err := sumGrouped(inDateRange(base.Session(&gorm.Session{}), from, to), "category", cv)
+	if err != nil {
+		reportError(c, err)
+		return
+	}
+	previous, err := sumGrouped(inDateRange(base.Session(&gorm.Session{}), prevFrom, prevTo), "category", cv)
+	if err != nil {
+		reportError(c, err)
+		return
+	}
+
+	var total Money
+	for _, g := range current {
+		total += g.Total
+	}
+
+	// Categories that had spending only in the previous period are listed
+	// too, so that a drop to nothing shows up.
+	categories := []categoryTotal{}
+	for name, g := range current {
+		row := categoryTotal{Category: name, Total: g.Total, Count: g.Count, PreviousTotal: previous[name].Total}
+		if total != 0 {
+			row.Share = percent(g.Total, total)
+		}
+		categories = append(categories, row)
+	}
+	for name, g := range previous {
+		if _, ok := current[name]; !ok {
+			categories = append(categories, categoryTotal{Category: name, PreviousTotal: g.Total})
+		}
+	}
+	for i := range categories {
+		if prev := categories[i].PreviousTotal; prev != 0 {
+			change := percent(categories[i].Total-prev, prev)
+			categories[i].Change = &change
+		}
+	}
+	sort.Slice(categories, func(i, j int) bool {
+		if categories[i].Total != categories[j].Total {
+			return categories[i].Total > categories[j].Total
+		}
+		return categories[i].Category < categories[j].Category
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"currency":      cv.target,
+		"kind":          kind,
+		"from":          from,
+		"to":            to,
+		"previous_from": prevFrom,
+		"previous_to":   prevTo,
+		"total":         total,
+		"categories":    categories,
+	})
+}
+
+// merchantTotal is one row of the merchant report.
+type merchantTotal struct {
+	Merchant string `json:"merchant"`
+	groupTotal
+}
+
+// GetMerchantReport ranks the descriptions transactions were recorded with
+// by how much went through them, optionally within one category.
+func GetMerchantReport(c *gin.Context) {
+	userID := currentUserID(c)
+	from, to, _, _, ok := reportWindow(c, userID)
+	if !ok {
+		return
+	}
+	query, kind, ok := transactionsOfKind(c, userID)
+	if !ok {
+		return
+	}
+	limit := 10
+	if s := c.Query("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > 100 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 100"})
+			return
+		}
+		limit = n
+	}
+	query = inDateRange(query, from, to).Where("TRIM(description) <> ''")
+	if category := c.Query("category"); category != "" {
+		query = query.Where("category = ?", category)
+	}
+	cv := newConverter(db, baseCurrencyOf(userID))
+
+	groups, err := sumGrouped(query, "TRIM(description)", cv)
+	if err != nil {
+		reportError(c, err)
+		return
+	}
+	merchants := []merchantTotal{}
+	for name, g := range groups {
+		merchants = append(merchants, merchantTotal{Merchant: name, groupTotal: g})
+	}
+	sort.Slice(merchants, func(i, j int) bool {
+		if merchants[i].Total != merchants[j].Total {
+			return merchants[i].Total > merchants[j].Total
+		}
+		return merchants[i].Merchant < merchants[j].Merchant
+	})
+	if len(merchants) > limit {
+		merchants = merchants[:limit]
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"currency":  cv.target,
+		"kind":      kind,
+		"from":      from,
+		"to":        to,
+		"merchants": merchants,
+	})
+}
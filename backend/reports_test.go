@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGranularityPeriods(t *testing.T) {
+	d := mustDate("2025-04-17") // a Thursday
+	assert.Equal(t, mustDate("2025-04-14"), byWeek.periodStart(d))
+	assert.Equal(t, mustDate("2025-04-01"), byMonth.periodStart(d))
+	assert.Equal(t, mustDate("2025-01-01"), byYear.periodStart(d))
+	assert.Equal(t, mustDate("2025-04-14"), byWeek.periodStart(mustDate("2025-04-14")))
+	assert.Equal(t, mustDate("2025-04-14"), byWeek.periodStart(mustDate("2025-04-20")))
+
+	assert.Equal(t, "2025-W16", byWeek.label(mustDate("2025-04-14")))
+	assert.Equal(t, "2025-W01", byWeek.label(mustDate("2024-12-30")))
+	assert.Equal(t, "2025-04", byMonth.label(mustDate("2025-04-01")))
+	assert.Equal(t, "2025", byYear.label(mustDate("2025-01-01")))
+}
+
+func TestCashflowReport(t *testing.T) {
+	setupTestDB()
+	r := setupRouter()
+	_, err := loadExchangeRates(db, "testdata/eurofxref.xml")
+	assert.NoError(t, err)
+	db.Create(&User{FullName: "A", Username: "a", Email: "a@x.com", Password: "p", BaseCurrency: "USD"})
+	db.Create(&[]Income{
+		{UserID: 1, Amount: 100000, Currency: "USD", Category: "Salary", Date: mustDate("2025-03-03")},
+		{UserID: 1, Amount: 200000, Currency: "USD", Category: "Salary", Date: mustDate("2025-04-16")},
+		{UserID: 1, Amount: 50000, Currency: "USD", Category: "Bonus", Date: mustDate("2025-04-17")},
+		{UserID: 2, Amount: 99900, Currency: "USD", Category: "Salary", Date: mustDate("2025-04-17")},
+	})
+	db.Create(&[]Expense{
+		{UserID: 1, Amount: 40000, Currency: "USD", Category: "Rent", Date: mustDate("2025-03-10")},
+		{UserID: 1, Amount: 10000, Currency: "EUR", Category: "Travel", Date: mustDate("2025-04-16")},
+		{UserID: 1, Amount: 10000, Currency: "EUR", Category: "Travel", Date: mustDate("2025-04-17")},
+		{UserID: 1, Amount: 5000, Currency: "USD", Category: "Food", Date: mustDate("2025-06-02")},
+	})
+
+	type report struct {
+		Currency    string           `json:"currency"`
+		Granularity string           `json:"granularity"`
+		Periods     []cashflowPeriod `json:"periods"`
+	}
+	get := func(query string) (int, report) {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, withAuth(httptest.NewRequest("GET", "/reports/cashflow"+query, nil), 1))
+		var resp report
+		if w.Code == http.StatusOK {
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		}
+		return w.Code, resp
+	}
+	rate := func(f float64) *float64 { return &f }
+
+	// months, with the empty one in between; euros are converted per day
+	code, resp := get("")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "USD", resp.Currency)
+	assert.Equal(t, "month", resp.Granularity)
+	assert.Equal(t, []cashflowPeriod{
+		{Period: "2025-03", Start: mustDate("2025-03-01"), End: mustDate("2025-03-31"), Income: 100000, Expenses: 40000, Net: 60000, SavingsRate: rate(60)},
+		{Period: "2025-04", Start: mustDate("2025-04-01"), End: mustDate("2025-04-30"), Income: 250000, Expenses: 22620, Net: 227380, SavingsRate: rate(90.95)},
+		{Period: "2025-05", Start: mustDate("2025-05-01"), End: mustDate("2025-05-31")},
+		{Period: "2025-06", Start: mustDate("2025-06-01"), End: mustDate("2025-06-30"), Expenses: 5000, Net: -5000},
+	}, resp.Periods)
+
+	// years
+	_, resp = get("?granularity=year")
+	assert.Equal(t, []cashflowPeriod{
+		{Period: "2025", Start: mustDate("2025-01-01"), End: mustDate("2025-12-31"), Income: 350000, Expenses: 67620, Net: 282380, SavingsRate: rate(80.68)},
+	}, resp.Periods)
+
+	// weeks within a range, which bounds the periods reported
+	_, resp = get("?granularity=week&from=2025-04-10&to=2025-04-20")
+	assert.Equal(t, []cashflowPeriod{
+		{Period: "2025-W15", Start: mustDate("2025-04-07"), End: mustDate("2025-04-13")},
+		{Period: "2025-W16", Start: mustDate("2025-04-14"), End: mustDate("2025-04-20"), Income: 250000, Expenses: 22620, Net: 227380, SavingsRate: rate(90.95)},
+	}, resp.Periods)
+
+	// nothing recorded
+	_, resp = get("?from=2024-01-01&to=2024-01-31")
+	assert.Equal(t, []cashflowPeriod{{Period: "2024-01", Start: mustDate("2024-01-01"), End: mustDate("2024-01-31")}}, resp.Periods)
+
+	code, _ = get("?granularity=day")
+	assert.Equal(t, http.StatusBadRequest, code)
+	code, _ = get("?to=2025-13-01")
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	// a currency without rates cannot be reported on
+	db.Create(&Expense{UserID: 1, Amount: 100, Currency: "CHF", Category: "Food", Date: mustDate("2025-04-17")})
+	code, _ = get("")
+	assert.Equal(t, http.StatusUnprocessableEntity, code)
+}
+
+func TestCategoryAndMerchantReports(t *testing.T) {
+	setupTestDB()
+	r := setupRouter()
+	_, err := loadExchangeRates(db, "testdata/eurofxref.xml")
+	assert.NoError(t, err)
+	db.Create(&User{FullName: "A", Username: "a", Email: "a@x.com", Password: "p", BaseCurrency: "USD"})
+	db.Create(&[]Expense{
+		// previous period, 2025-04-01 to 2025-04-15
+		{UserID: 1, Amount: 10000, Currency: "USD", Category: "Food", Description: "Market", Date: mustDate("2025-04-05")},
+		{UserID: 1, Amount: 2000, Currency: "USD", Category: "Fun", Description: "Cinema", Date: mustDate("2025-04-06")},
+		// current period, 2025-04-16 to 2025-04-30
+		{UserID: 1, Amount: 6000, Currency: "USD", Category: "Food", Description: "Market", Date: mustDate("2025-04-16")},
+		{UserID: 1, Amount: 10000, Currency: "EUR", Category: "Food", Description: " Market ", Date: mustDate("2025-04-17")},
+		{UserID: 1, Amount: 1000, Currency: "USD", Category: "Food", Description: "Bakery", Date: mustDate("2025-04-20")},
+		{UserID: 1, Amount: 30000, Currency: "USD", Category: "Travel", Description: "Airline", Date: mustDate("2025-04-18")},
+		{UserID: 1, Amount: 500, Currency: "USD", Category: "Travel", Date: mustDate("2025-04-18")},
+		{UserID: 2, Amount: 99900, Currency: "USD", Category: "Food", Description: "Market", Date: mustDate("2025-04-18")},
+	})
+	db.Create(&Income{UserID: 1, Amount: 50000, Currency: "USD", Category: "Salary", Description: "Acme", Date: mustDate("2025-04-20")})
+
+	get := func(path string, dest interface{}) int {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, withAuth(httptest.NewRequest("GET", path, nil), 1))
+		if w.Code == http.StatusOK {
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), dest))
+		}
+		return w.Code
+	}
+	change := func(f float64) *float64 { return &f }
+
+	var categories struct {
+		Currency     string          `json:"currency"`
+		PreviousFrom Date            `json:"previous_from"`
+		PreviousTo   Date            `json:"previous_to"`
+		Total        Money           `json:"total"`
+		Categories   []categoryTotal `json:"categories"`
+	}
+	code := get("/reports/categories?from=2025-04-16&to=2025-04-30", &categories)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "USD", categories.Currency)
+	assert.Equal(t, mustDate("2025-04-01"), categories.PreviousFrom)
+	assert.Equal(t, mustDate("2025-04-15"), categories.PreviousTo)
+	assert.Equal(t, Money(48870), categories.Total)
+	assert.Equal(t, []categoryTotal{
+		{Category: "Travel", Total: 30500, Count: 2, Share: 62.41},
+		{Category: "Food", Total: 18370, Count: 3, Share: 37.59, PreviousTotal: 10000, Change: change(83.7)},
+		{Category: "Fun", PreviousTotal: 2000, Change: change(-100)},
+	}, categories.Categories)
+
+	// incomes
+	code = get("/reports/categories?kind=income&from=2025-04-01&to=2025-04-30", &categories)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, []categoryTotal{{Category: "Salary", Total: 50000, Count: 1, Share: 100}}, categories.Categories)
+
+	var merchants struct {
+		Merchants []merchantTotal `json:"merchants"`
+	}
+	code = get("/reports/merchants?from=2025-04-01&to=2025-04-30&limit=2", &merchants)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, []merchantTotal{
+		{Merchant: "Airline", groupTotal: groupTotal{Total: 30000, Count: 1}},
+		{Merchant: "Market", groupTotal: groupTotal{Total: 27370, Count: 3}},
+	}, merchants.Merchants)
+
+	code = get("/reports/merchants?from=2025-04-01&to=2025-04-30&category=Fun", &merchants)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, []merchantTotal{{Merchant: "Cinema", groupTotal: groupTotal{Total: 2000, Count: 1}}}, merchants.Merchants)
+
+	assert.Equal(t, http.StatusBadRequest, get("/reports/categories?kind=transfer", &categories))
+	assert.Equal(t, http.StatusBadRequest, get("/reports/merchants?limit=0", &merchants))
+}
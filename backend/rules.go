@@ -0,0 +1,502 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// TransactionRule files transactions automatically. Its conditions, all of
+// which must hold, look at the description, the amount and the account;
+// its actions set the category or the description and add tags. Enabled
+// rules run in order of Position, then ID, on every expense or income that
+// is added or imported. Each matching rule applies in turn, on the
+// transaction as the rules before it left it, so a later rule's category or
+// description wins and tags add up.
+type TransactionRule struct {
+	ID       uint   `json:"id" gorm:"primaryKey"`
+	UserID   uint   `json:"user_id" gorm:"not null;index"`
+	Name     string `json:"name"`
+	Kind     string `json:"kind"` // expense or income; empty for both
+	Position int    `json:"position"`
+	Disabled bool   `json:"disabled"`
+
+	// Conditions
+	DescriptionContains string `json:"description_contains"` // ignoring case
+	DescriptionPattern  string `json:"description_pattern"`  // RE2 regular expression
+	MinAmount           *Money `json:"min_amount"`
+	MaxAmount           *Money `json:"max_amount"`
+	AccountID           *uint  `json:"account_id" gorm:"index"`
+
+	// Actions. Split expenses keep the categories of their lines, and
+	// transactions added with a category keep it.
+	CategoryID     *uint  `json:"category_id" gorm:"index"`
+	Category       string `json:"category"`
+	Tags           []Tag  `json:"tags" gorm:"many2many:transaction_rule_tags"`
+	SetDescription string `json:"set_description"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	pattern *regexp.Regexp
+}
+
+func (r TransactionRule) OwnerID() uint { return r.UserID }
+
+func (r *TransactionRule) normalize() {
+	r.Kind = strings.ToLower(strings.TrimSpace(r.Kind))
+	r.DescriptionContains = strings.TrimSpace(r.DescriptionContains)
+	r.SetDescription = strings.TrimSpace(r.SetDescription)
+	r.Category = strings.TrimSpace(r.Category)
+}
+
+// validate checks the rule and compiles its pattern.
+func (r *TransactionRule) validate() error {
+	if r.Kind != "" && r.Kind != kindExpense && r.Kind != kindIncome {
+		return errors.New("kind must be expense, income or empty for both")
+	}
+	if r.DescriptionContains == "" && r.DescriptionPattern == "" && r.MinAmount == nil && r.MaxAmount == nil && r.AccountID == nil {
+		return errors.New("a rule needs a condition: description_contains, description_pattern, min_amount, max_amount or account_id")
+	}
+	if r.DescriptionPattern != "" {
+		re, err := regexp.Compile(r.DescriptionPattern)
+		if err != nil {
+			return errors.New("description_pattern is not a valid regular expression")
+		}
+		r.pattern = re
+	}
+	if r.MinAmount != nil && r.MaxAmount != nil && *r.MinAmount > *r.MaxAmount {
+		return errors.New("min_amount must not be greater than max_amount")
+	}
+	hasCategory := r.CategoryID != nil || r.Category != ""
+	if !hasCategory && len(r.Tags) == 0 && r.SetDescription == "" {
+		return errors.New("a rule needs an action: category, tags or set_description")
+	}
+	if hasCategory && r.Kind == "" {
+		return errors.New("a rule that sets a category needs a kind")
+	}
+	return nil
+}
+
+// checkRuleAccount verifies that id, if set, is one of the user's accounts.
+func checkRuleAccount(userID uint, id *uint) error {
+	if id == nil {
+		return nil
+	}
+	err := db.Where("id = ? AND user_id = ?", *id, userID).First(&Account{}).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return errUnknownAccount
+	}
+	return err
+}
+
+// ruleTarget is what rules look at and change in a transaction.
+type ruleTarget struct {
+	kind         string
+	description  string
+	amount       Money
+	accountID    *uint
+	keepCategory bool // split, or given a category by the client
+	categoryID   *uint
+	category     string
+	tags         []Tag
+	applied      []uint // ids of the rules that matched
+}
+
+func (r TransactionRule) matches(t ruleTarget) bool {
+	switch {
+	case r.Kind != "" && r.Kind != t.kind:
+		return false
+	case r.DescriptionContains != "" && !strings.Contains(strings.ToLower(t.description), strings.ToLower(r.DescriptionContains)):
+		return false
+	case r.pattern != nil && !r.pattern.MatchString(t.description):
+		return false
+	case r.MinAmount != nil && t.amount < *r.MinAmount:
+		return false
+	case r.MaxAmount != nil && t.amount > *r.MaxAmount:
+		return false
+	case r.AccountID != nil && (t.accountID == nil || *t.accountID != *r.AccountID):
+		return false
+	}
+	return true
+}
+
+func (r TransactionRule) apply(t *ruleTarget) {
+	if r.CategoryID != nil && !t.keepCategory {
+		t.categoryID, t.category = r.CategoryID, r.Category
+	}
+	if r.SetDescription != "" {
+		t.description = r.SetDescription
+	}
+	for _, tag := range r.Tags {
+		if !hasTag(t.tags, tag) {
+			t.tags = append(t.tags, tag)
+		}
+	}
+	t.applied = append(t.applied, r.ID)
+}
+
+// hasTag reports whether tags holds tag, by id or else by name.
+func hasTag(tags []Tag, tag Tag) bool {
+	for _, t := range tags {
+		if t.ID != 0 && t.ID == tag.ID || t.ID == 0 && strings.EqualFold(strings.TrimSpace(t.Name), tag.Name) {
+			return true
+		}
+	}
+	return false
+}
+
+// ruleSet is a user's enabled rules in the order they run.
+type ruleSet []TransactionRule
+
+// loadRules returns the user's enabled rules, or only those of ids when
+// ids is not empty.
+func loadRules(userID uint, ids ...uint) (ruleSet, error) {
+	query := db.Preload("Tags").Where("user_id = ? AND disabled = ?", userID, false)
+	if len(ids) > 0 {
+		query = query.Where("id IN ?", ids)
+	}
+	var rules ruleSet
+	if err := query.Order("position, id").Find(&rules).Error; err != nil {
+		return nil, err
+	}
+	for i := range rules {
+		if rules[i].DescriptionPattern != "" {
+			rules[i].pattern, _ = regexp.Compile(rules[i].DescriptionPattern)
+		}
+	}
+	return rules, nil
+}
+
+func (rs ruleSet) run(t *ruleTarget) {
+	for _, r := range rs {
+		if r.matches(*t) {
+			r.apply(t)
+		}
+	}
+}
+
+func expenseTarget(e Expense) ruleTarget {
+	return ruleTarget{kind: kindExpense, description: e.Description, amount: e.Amount, accountID: e.AccountID,
+		keepCategory: len(e.Splits) > 0, categoryID: e.CategoryID, category: e.Category, tags: e.Tags}
+}
+
+func incomeTarget(i Income) ruleTarget {
+	return ruleTarget{kind: kindIncome, description: i.Description, amount: i.Amount, accountID: i.AccountID,
+		categoryID: i.CategoryID, category: i.Category, tags: i.Tags}
+}
+
+// expense runs the rules on a new expense. A category the client gave
+// wins over the rules'.
+func (rs ruleSet) expense(e *Expense) {
+	t := expenseTarget(*e)
+	t.keepCategory = t.keepCategory || e.CategoryID != nil || e.Category != ""
+	rs.run(&t)
+	e.Description, e.CategoryID, e.Category, e.Tags = t.description, t.categoryID, t.category, t.tags
+}
+
+// income runs the rules on a new income. A category the client gave wins
+// over the rules'.
+func (rs ruleSet) income(i *Income) {
+	t := incomeTarget(*i)
+	t.keepCategory = i.CategoryID != nil || i.Category != ""
+	rs.run(&t)
+	i.Description, i.CategoryID, i.Category, i.Tags = t.description, t.categoryID, t.category, t.tags
+}
+
+// importRows runs the rules on the rows an import will save. The rows go
+// to accountID, and are filed by category name.
+func (rs ruleSet) importRows(rows []importRow, accountID *uint) {
+	if len(rs) == 0 {
+		return
+	}
+	for i := range rows {
+		row := &rows[i]
+		if !row.pending() {
+			continue
+		}
+		t := ruleTarget{kind: row.Kind, description: row.Description, amount: row.Amount, accountID: accountID, category: row.Category}
+		rs.run(&t)
+		row.Description, row.Category, row.Rules = t.description, t.category, t.applied
+		for _, tag := range t.tags {
+			row.Tags = append(row.Tags, tag.Name)
+		}
+	}
+}
+
+// ruleFields are the parts of a transaction rules change.
+type ruleFields struct {
+	Description string   `json:"description"`
+	Category    string   `json:"category"`
+	Tags        []string `json:"tags"`
+}
+
+// ruleChange is a transaction the rules changed, or would change.
+type ruleChange struct {
+	Kind   string     `json:"kind"`
+	ID     uint       `json:"id"`
+	Date   Date       `json:"date"`
+	Amount Money      `json:"amount"`
+	Rules  []uint     `json:"rules"`
+	Before ruleFields `json:"before"`
+	After  ruleFields `json:"after"`
+
+	categoryID *uint
+	addedTags  []Tag
+}
+
+// ruleReport answers a run of the rules over existing transactions.
+type ruleReport struct {
+	Committed bool         `json:"committed"`
+	Checked   int          `json:"checked"`
+	Changed   int          `json:"changed"`
+	Changes   []ruleChange `json:"changes"`
+}
+
+func tagNameList(tags []Tag) []string {
+	names := make([]string, 0, len(tags))
+	for _, t := range tags {
+		names = append(names, t.Name)
+	}
+	return names
+}
+
+// check counts a transaction the rules ran on and records what they
+// changed.
+func (report *ruleReport) check(kind string, id uint, date Date, before, after ruleTarget) {
+	report.Checked++
+	var added []Tag
+	for _, tag := range after.tags {
+		if !hasTag(before.tags, tag) {
+			added = append(added, tag)
+		}
+	}
+	sameCategory := before.category == after.category &&
+		(before.categoryID == nil) == (after.categoryID == nil) && (before.categoryID == nil || *before.categoryID == *after.categoryID)
+	if sameCategory && before.description == after.description && len(added) == 0 {
+		return
+	}
+	report.Changed++
+	report.Changes = append(report.Changes, ruleChange{Kind: kind, ID: id, Date: date, Amount: before.amount, Rules: after.applied,
+		Before:     ruleFields{Description: before.description, Category: before.category, Tags: tagNameList(before.tags)},
+		After:      ruleFields{Description: after.description, Category: after.category, Tags: tagNameList(after.tags)},
+		categoryID: after.categoryID, addedTags: added})
+}
+
+// commit saves the changes in one database transaction.
+func (report *ruleReport) commit() error {
+	err := db.Transaction(func(tx *gorm.DB) error {
+		for _, ch := range report.Changes {
+			model := interface{}(&Expense{})
+			if ch.Kind == kindIncome {
+				model = &Income{}
+			}
+			err := tx.Model(model).Where("id = ?", ch.ID).Updates(map[string]interface{}{
+				"description": ch.After.Description, "category_id": ch.categoryID, "category": ch.After.Category,
+			}).Error
+			if err != nil {
+				return err
+			}
+			join := tagJoins[ch.Kind]
+			for _, tag := range ch.addedTags {
+				if err := tx.Exec("INSERT INTO "+join.table+" ("+join.column+", tag_id) VALUES (?, ?)", ch.ID, tag.ID).Error; err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err == nil {
+		report.Committed = true
+	}
+	return err
+}
+
+func GetTransactionRules(c *gin.Context) {
+	rules := []TransactionRule{}
+	if err := db.Preload("Tags").Where("user_id = ?", currentUserID(c)).Order("position, id").Find(&rules).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve rules"})
+		return
+	}
+	c.JSON(http.StatusOK, rules)
+}
+
+// prepareRule validates a rule and resolves its account, category and
+// tags. It writes the error response itself and reports whether to
+// continue.
+func prepareRule(c *gin.Context, rule *TransactionRule) bool {
+	rule.normalize()
+	if err := rule.validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return false
+	}
+	if err := checkRuleAccount(rule.UserID, rule.AccountID); err != nil {
+		accountError(c, err)
+		return false
+	}
+	if rule.Kind != "" {
+		var err error
+		if rule.CategoryID, rule.Category, err = resolveCategory(rule.UserID, rule.Kind, rule.CategoryID, rule.Category); err != nil {
+			categoryError(c, err)
+			return false
+		}
+	}
+	tags, err := resolveTags(rule.UserID, rule.Tags)
+	if err != nil {
+		tagError(c, err)
+		return false
+	}
+	rule.Tags = tags
+	return true
+}
+
+func AddTransactionRule(c *gin.Context) {
+	var rule TransactionRule
+	if err := c.ShouldBindJSON(&rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	rule.ID = 0
+	rule.UserID = currentUserID(c)
+	rule.CreatedAt = time.Time{}
+	if !prepareRule(c, &rule) {
+		return
+	}
+	if err := db.Omit("Tags.*").Create(&rule).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save rule"})
+		return
+	}
+	c.JSON(http.StatusOK, rule)
+}
+
+// UpdateTransactionRule replaces or patches a rule. Transactions it filed
+// before stay as they are.
+func UpdateTransactionRule(c *gin.Context) {
+	var rule TransactionRule
+	if !findOwned(c, &rule, "Rule not found") {
+		return
+	}
+	if err := db.Preload("Tags").First(&rule, rule.ID).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load rule"})
+		return
+	}
+
+	var updated TransactionRule
+	if err := bindUpdate(c, rule, &updated); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	updated.ID, updated.UserID, updated.CreatedAt = rule.ID, rule.UserID, rule.CreatedAt
+	if renamedOnly(updated.CategoryID, rule.CategoryID, updated.Category, rule.Category) {
+		updated.CategoryID = nil
+	}
+	if !prepareRule(c, &updated) {
+		return
+	}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Tags").Save(&updated).Error; err != nil {
+			return err
+		}
+		return tx.Model(&updated).Omit("Tags.*").Association("Tags").Replace(updated.Tags)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update rule"})
+		return
+	}
+	c.JSON(http.StatusOK, updated)
+}
+
+func DeleteTransactionRule(c *gin.Context) {
+	var rule TransactionRule
+	if !findOwned(c, &rule, "Rule not found") {
+		return
+	}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&rule).Association("Tags").Clear(); err != nil {
+			return err
+		}
+		return tx.Delete(&rule).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete rule"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Rule deleted"})
+}
+
+// ApplyTransactionRules runs the rules over existing transactions: those
+// matching the list filters, of kind (expense, income, or both when
+// empty). rule_id, repeatable, limits the run to those rules. Unless
+// commit=true it is a dry run; either way it answers with every change.
+func ApplyTransactionRules(c *gin.Context) {
+	userID := currentUserID(c)
+	kind := c.Query("kind")
+	if kind != "" && kind != kindExpense && kind != kindIncome {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "kind must be expense or income"})
+		return
+	}
+	var ids []uint
+	for _, s := range c.QueryArray("rule_id") {
+		id, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "rule_id must be a number"})
+			return
+		}
+		ids = append(ids, uint(id))
+	}
+	rules, err := loadRules(userID, ids...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load rules"})
+		return
+	}
+
+	report := ruleReport{Changes: []ruleChange{}}
+	check := func(kind string, id uint, date Date, before ruleTarget) {
+		after := before
+		after.tags = append([]Tag(nil), before.tags...)
+		rules.run(&after)
+		report.check(kind, id, date, before, after)
+	}
+	p := page{sort: "date"}
+	if kind != kindIncome {
+		query, ok := filterExpenses(c, db.Where("user_id = ?", userID))
+		if !ok {
+			return
+		}
+		err = eachBatch(query.Preload("Tags").Preload("Splits"), p, func(expenses []Expense) error {
+			for _, e := range expenses {
+				check(kindExpense, e.ID, e.Date, expenseTarget(e))
+			}
+			return nil
+		})
+	}
+	if err == nil && kind != kindExpense {
+		query, ok := filterTransactions(c, db.Where("user_id = ?", userID), kindIncome)
+		if !ok {
+			return
+		}
+		err = eachBatch(query.Preload("Tags"), p, func(incomes []Income) error {
+			for _, i := range incomes {
+				check(kindIncome, i.ID, i.Date, incomeTarget(i))
+			}
+			return nil
+		})
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to apply rules"})
+		return
+	}
+	if c.Query("commit") == "true" {
+		if err := report.commit(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save rule changes"})
+			return
+		}
+	}
+	c.JSON(http.StatusOK, report)
+}
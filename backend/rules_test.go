@@ -0,0 +1,215 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransactionRuleValidation(t *testing.T) {
+	setupTestDB()
+	r := setupRouter()
+	db.Create(&User{FullName: "A", Username: "a", Email: "a@x.com", Password: "p"})
+	db.Create(&Account{UserID: 2, Name: "Theirs", Currency: "USD"})
+
+	for _, body := range []string{
+		`{"kind":"transfer","description_contains":"x","set_description":"y"}`,
+		`{"kind":"expense","category":"Food"}`,
+		`{"kind":"expense","description_contains":"x"}`,
+		`{"kind":"expense","description_pattern":"(","category":"Food"}`,
+		`{"kind":"expense","min_amount":20,"max_amount":10,"category":"Food"}`,
+		`{"description_contains":"x","category":"Food"}`,
+		`{"kind":"expense","account_id":1,"category":"Food"}`,
+	} {
+		assert.Equal(t, http.StatusBadRequest, sendJSON(r, "POST", "/rules", body, 1).Code, body)
+	}
+
+	w := sendJSON(r, "POST", "/rules", `{"name":"Coffee","kind":"expense","description_pattern":"(?i)^coffee","category":" Food ","tags":[{"name":"daily"}]}`, 1)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var rule TransactionRule
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &rule))
+	assert.NotNil(t, rule.CategoryID)
+	assert.Equal(t, "Food", rule.Category)
+	if assert.Len(t, rule.Tags, 1) {
+		assert.Equal(t, "daily", rule.Tags[0].Name)
+	}
+
+	// a category can't go while a rule files into it
+	assert.Equal(t, http.StatusConflict, sendJSON(r, "DELETE", "/categories/1", "", 1).Code)
+
+	assert.Equal(t, http.StatusOK, sendJSON(r, "PATCH", "/rules/1", `{"tags":[],"set_description":"Coffee"}`, 1).Code)
+	var rules []TransactionRule
+	assert.Equal(t, http.StatusOK, getJSON(r, "/rules", 1, &rules))
+	if assert.Len(t, rules, 1) {
+		assert.Empty(t, rules[0].Tags)
+		assert.Equal(t, "Coffee", rules[0].SetDescription)
+		assert.Equal(t, "(?i)^coffee", rules[0].DescriptionPattern)
+	}
+	assert.Equal(t, http.StatusForbidden, sendJSON(r, "PATCH", "/rules/1", `{"name":"x"}`, 2).Code)
+	assert.Equal(t, http.StatusOK, sendJSON(r, "DELETE", "/rules/1", "", 1).Code)
+	assert.Equal(t, http.StatusNotFound, sendJSON(r, "DELETE", "/rules/1", "", 1).Code)
+}
+
+func TestRulesOnCreate(t *testing.T) {
+	setupTestDB()
+	r := setupRouter()
+	db.Create(&User{FullName: "A", Username: "a", Email: "a@x.com", Password: "p"})
+	db.Create(&Account{UserID: 1, Name: "Card", Currency: "USD"})
+
+	for _, body := range []string{
+		`{"kind":"expense","description_contains":"uber","category":"Transport","tags":[{"name":"work"}]}`,
+		`{"kind":"expense","description_contains":"uber","min_amount":50,"category":"Travel"}`,
+		`{"account_id":1,"tags":[{"name":"card"}]}`,
+		`{"kind":"income","description_pattern":"^ACME PAYROLL","category":"Salary","set_description":"Salary"}`,
+		`{"kind":"expense","description_contains":"uber","category":"Never","disabled":true}`,
+	} {
+		assert.Equal(t, http.StatusOK, sendJSON(r, "POST", "/rules", body, 1).Code, body)
+	}
+
+	var expense Expense
+	w := sendJSON(r, "POST", "/expenses", `{"amount":12.5,"description":"Uber ride","date":"2025-04-01","tags":[{"name":"WORK"}]}`, 1)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &expense))
+	assert.Equal(t, "Transport", expense.Category)
+	// the rule's tag is already there, whatever its case
+	assert.Equal(t, []string{"work"}, tagNameList(expense.Tags))
+
+	// later rules win, and tags add up
+	w = sendJSON(r, "POST", "/expenses", `{"amount":80,"description":"UBER airport","account_id":1,"date":"2025-04-01"}`, 1)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &expense))
+	assert.Equal(t, "Travel", expense.Category)
+	assert.ElementsMatch(t, []string{"work", "card"}, tagNameList(expense.Tags))
+
+	// a category given with the request beats the rules
+	w = sendJSON(r, "POST", "/expenses", `{"amount":30,"description":"Uber Eats","category":"Food","date":"2025-04-02"}`, 1)
+	assert.Equal(t, http.StatusOK, w.Code)
+	expense = Expense{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &expense))
+	assert.Equal(t, "Food", expense.Category)
+	assert.Equal(t, []string{"work"}, tagNameList(expense.Tags))
+
+	// without a matching rule a category is still needed
+	assert.Equal(t, http.StatusBadRequest, sendJSON(r, "POST", "/expenses", `{"amount":5,"description":"Kiosk"}`, 1).Code)
+
+	var income Income
+	w = sendJSON(r, "POST", "/incomes", `{"amount":3000,"description":"ACME PAYROLL 0425","date":"2025-04-30"}`, 1)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &income))
+	assert.Equal(t, "Salary", income.Category)
+	assert.Equal(t, "Salary", income.Description)
+	assert.NotNil(t, income.CategoryID)
+	w = sendJSON(r, "POST", "/incomes", `{"amount":100,"description":"ACME PAYROLL bonus","category":"Bonus"}`, 1)
+	income = Income{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &income))
+	assert.Equal(t, "Bonus", income.Category)
+	assert.Equal(t, "Salary", income.Description)
+}
+
+func TestRulesOnImport(t *testing.T) {
+	setupTestDB()
+	r := setupRouter()
+	db.Create(&User{FullName: "A", Username: "a", Email: "a@x.com", Password: "p", BaseCurrency: "EUR"})
+	sendJSON(r, "POST", "/rules", `{"kind":"expense","description_contains":"rewe","category":"Groceries","tags":[{"name":"food"}]}`, 1)
+
+	statement := "date,amount,description\n2025-04-01,-45.90,REWE Markt\n2025-04-02,-9.99,Netflix\n"
+	mapping := `{"date":"date","amount":"amount","description":"description","default_category":"Other"}`
+
+	w := uploadFile(r, "/import/csv", statement, map[string]string{"mapping": mapping}, 1)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var result importResult
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+	if assert.Len(t, result.Rows, 2) {
+		assert.Equal(t, "Groceries", result.Rows[0].Category)
+		assert.Equal(t, []string{"food"}, result.Rows[0].Tags)
+		assert.Equal(t, []uint{1}, result.Rows[0].Rules)
+		assert.Equal(t, "Other", result.Rows[1].Category)
+		assert.Empty(t, result.Rows[1].Rules)
+	}
+
+	w = uploadFile(r, "/import/csv", statement, map[string]string{"mapping": mapping, "commit": "true"}, 1)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var expenses []Expense
+	db.Preload("Tags").Order("id").Find(&expenses)
+	if assert.Len(t, expenses, 2) {
+		assert.Equal(t, "Groceries", expenses[0].Category)
+		assert.Equal(t, []string{"food"}, tagNameList(expenses[0].Tags))
+		assert.Empty(t, expenses[1].Tags)
+	}
+	var tags int64
+	db.Model(&Tag{}).Count(&tags)
+	assert.Equal(t, int64(1), tags)
+}
+
+func TestApplyTransactionRules(t *testing.T) {
+	setupTestDB()
+	r := setupRouter()
+	db.Create(&User{FullName: "A", Username: "a", Email: "a@x.com", Password: "p"})
+	db.Create(&Expense{UserID: 1, Amount: 450, Currency: "USD", Category: "Other", Description: "Starbucks 123", Date: mustDate("2025-04-01")})
+	db.Create(&Expense{UserID: 1, Amount: 6000, Currency: "USD", Category: "Other", Description: "Shell fuel", Date: mustDate("2025-04-02")})
+	db.Create(&Expense{UserID: 1, Amount: 390, Currency: "USD", Category: "Other", Description: "starbucks 456", Date: mustDate("2025-05-01")})
+	db.Create(&Income{UserID: 1, Amount: 100, Currency: "USD", Category: "Other", Description: "Starbucks refund", Date: mustDate("2025-04-03")})
+	db.Create(&Expense{UserID: 2, Amount: 450, Currency: "USD", Category: "Other", Description: "Starbucks", Date: mustDate("2025-04-01")})
+	sendJSON(r, "POST", "/rules", `{"kind":"expense","description_contains":"starbucks","category":"Coffee","set_description":"Starbucks"}`, 1)
+	sendJSON(r, "POST", "/rules", `{"description_contains":"shell","tags":[{"name":"car"}]}`, 1)
+
+	// a dry run reports and changes nothing
+	var report ruleReport
+	w := sendJSON(r, "POST", "/rules/apply?to=2025-04-30", "", 1)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+	assert.False(t, report.Committed)
+	assert.Equal(t, 3, report.Checked)
+	assert.Equal(t, 2, report.Changed)
+	if assert.Len(t, report.Changes, 2) {
+		assert.Equal(t, ruleChange{Kind: kindExpense, ID: 1, Date: mustDate("2025-04-01"), Amount: 450, Rules: []uint{1},
+			Before: ruleFields{Description: "Starbucks 123", Category: "Other", Tags: []string{}},
+			After:  ruleFields{Description: "Starbucks", Category: "Coffee", Tags: []string{}}}, report.Changes[0])
+		assert.Equal(t, []string{"car"}, report.Changes[1].After.Tags)
+	}
+	var expense Expense
+	db.First(&expense, 1)
+	assert.Equal(t, "Other", expense.Category)
+
+	// only the chosen rules, only expenses, and for real
+	w = sendJSON(r, "POST", "/rules/apply?kind=expense&rule_id=1&commit=true", "", 1)
+	assert.Equal(t, http.StatusOK, w.Code)
+	report = ruleReport{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+	assert.True(t, report.Committed)
+	assert.Equal(t, 3, report.Checked)
+	assert.Equal(t, 2, report.Changed)
+	expense = Expense{}
+	db.Preload("Tags").First(&expense, 1)
+	assert.Equal(t, "Coffee", expense.Category)
+	assert.NotNil(t, expense.CategoryID)
+	assert.Equal(t, "Starbucks", expense.Description)
+	expense = Expense{}
+	db.Preload("Tags").First(&expense, 2)
+	assert.Empty(t, expense.Tags)
+	expense = Expense{}
+	db.First(&expense, 4)
+	assert.Equal(t, "Other", expense.Category)
+
+	w = sendJSON(r, "POST", "/rules/apply?commit=true", "", 1)
+	report = ruleReport{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+	assert.Equal(t, 4, report.Checked)
+	assert.Equal(t, 1, report.Changed)
+	expense = Expense{}
+	db.Preload("Tags").First(&expense, 2)
+	assert.Equal(t, []string{"car"}, tagNameList(expense.Tags))
+
+	// running again finds nothing left to do
+	w = sendJSON(r, "POST", "/rules/apply", "", 1)
+	report = ruleReport{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+	assert.Zero(t, report.Changed)
+	assert.Empty(t, report.Changes)
+
+	assert.Equal(t, http.StatusBadRequest, sendJSON(r, "POST", "/rules/apply?kind=transfer", "", 1).Code)
+	assert.Equal(t, http.StatusBadRequest, sendJSON(r, "POST", "/rules/apply?rule_id=x", "", 1).Code)
+	assert.Equal(t, http.StatusBadRequest, sendJSON(r, "POST", "/rules/apply?from=x", "", 1).Code)
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// generateBatchSize caps the occurrences one generateRule call books, so
+// that a rule starting far in the past doesn't book years of transactions
+// in a single request; the scheduler books the rest in further batches.
+const generateBatchSize = 500
+
+// generateRule books the occurrences of rule due on or before day that have
+// not been booked yet, at most generateBatchSize of them, applying overrides
+// and leaving out skipped ones. Afterwards rule.NextDate is the first
+// occurrence still to book. It is safe to run more than once for the same
+// day: each occurrence is inserted at most once thanks to the unique (rule,
+// occurrence) index.
+func generateRule(rule *RecurringRule, day Date) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		locked := tx
+		if tx.Dialector.Name() == "postgres" {
+			locked = tx.Clauses(clause.Locking{Strength: "UPDATE"})
+		}
+		if err := locked.First(rule, rule.ID).Error; err != nil {
+			return err
+		}
+		overrides, err := loadOverrides(tx, rule.ID)
+		if err != nil {
+			return err
+		}
+
+		n := rule.Generated
+		for ; n < rule.Generated+generateBatchSize && !rule.ended(n) && !rule.occurrence(n).After(day); n++ {
+			occurrence := rule.occurrence(n)
+			p := rule.plan(occurrence, overrides[occurrence])
+			if p.Skipped {
+				continue
+			}
+			var row interface{}
+			if rule.Kind == kindIncome {
+				row = &Income{UserID: rule.UserID, Amount: p.Amount, Currency: p.Currency, AccountID: rule.AccountID, CategoryID: rule.CategoryID,
+					Category: p.Category, Description: p.Description, Date: p.Date, RecurringRuleID: &rule.ID, Occurrence: occurrence}
+			} else {
+				row = &Expense{UserID: rule.UserID, Amount: p.Amount, Currency: p.Currency, AccountID: rule.AccountID, CategoryID: rule.CategoryID,
+					Category: p.Category, Description: p.Description, Date: p.Date, RecurringRuleID: &rule.ID, Occurrence: occurrence}
+			}
+			if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(row).Error; err != nil {
+				return err
+			}
+		}
+
+		if n == rule.Generated {
+			return nil
+		}
+		rule.advanceTo(n)
+		return tx.Model(rule).Updates(map[string]interface{}{"generated": rule.Generated, "next_date": rule.NextDate}).Error
+	})
+}
+
+// generateDue books the occurrences due as of now for every user, each in
+// their own time zone. Rules that fail are logged and retried on the next
+// run.
+func generateDue(now time.Time) {
+	// No time zone is more than a day ahead of UTC.
+	var rules []RecurringRule
+	horizon := DateOf(now.UTC()).AddDays(1)
+	if err := db.Where("next_date IS NOT NULL AND next_date <= ?", horizon).Order("id").Find(&rules).Error; err != nil {
+		log.Printf("recurring: failed to load due rules: %v", err)
+		return
+	}
+	for i := range rules {
+		rule := &rules[i]
+		day := DateOf(now.In(userLocation(rule.UserID)))
+		// A batch at a time, each in its own transaction, until caught up
+		for !rule.NextDate.IsZero() && !rule.NextDate.After(day) {
+			generated := rule.Generated
+			if err := generateRule(rule, day); err != nil {
+				log.Printf("recurring: rule %d: %v", rule.ID, err)
+				break
+			}
+			if rule.Generated == generated {
+				break
+			}
+		}
+	}
+}
+
+// runScheduler books due occurrences at start-up, which catches up on any
+// missed while the server was down, and then every interval until ctx is
+// cancelled.
+func runScheduler(ctx context.Context, interval time.Duration) {
+	generateDue(time.Now())
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			generateDue(now)
+		}
+	}
+}
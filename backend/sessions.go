@@ -0,0 +1,284 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	accessTokenTTL  = 15 * time.Minute
+	refreshTokenTTL = 30 * 24 * time.Hour
+	loginCodeTTL    = time.Minute
+)
+
+// Session is one refresh token. Every login starts a new family and every
+// refresh rotates the token, so a family is one signed-in device and only
+// its newest, unrotated row is usable.
+type Session struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	UserID    uint       `json:"-" gorm:"index;not null"`
+	FamilyID  string     `json:"-" gorm:"index;not null"`
+	TokenHash string     `json:"-" gorm:"uniqueIndex;not null"`
+	UserAgent string     `json:"user_agent"`
+	IP        string     `json:"ip"`
+	StartedAt time.Time  `json:"started_at"`
+	CreatedAt time.Time  `json:"last_used_at"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	RotatedAt *time.Time `json:"-"`
+	RevokedAt *time.Time `json:"-"`
+	Current   bool       `json:"current" gorm:"-"`
+}
+
+func (s Session) OwnerID() uint { return s.UserID }
+
+// LoginCode hands a Google sign-in over to the SPA. The OAuth callback can
+// only answer with a redirect, so rather than tokens it puts this short-lived,
+// single-use code in the URL, and the SPA trades it for the tokens with a
+// POST. Only the code's hash is kept.
+type LoginCode struct {
+	ID        uint      `gorm:"primaryKey"`
+	UserID    uint      `gorm:"not null"`
+	CodeHash  string    `gorm:"uniqueIndex;not null"`
+	ExpiresAt time.Time `gorm:"index;not null"`
+}
+
+func randomToken(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// issueRefreshToken stores a new refresh token in the given session family
+// and returns its plaintext value; only the hash is kept.
+func issueRefreshToken(tx *gorm.DB, c *gin.Context, userID uint, familyID string, startedAt time.Time) (string, error) {
+	token := randomToken(32)
+	session := Session{
+		UserID:    userID,
+		FamilyID:  familyID,
+		TokenHash: hashToken(token),
+		UserAgent: c.Request.UserAgent(),
+		IP:        c.ClientIP(),
+		StartedAt: startedAt,
+		ExpiresAt: time.Now().Add(refreshTokenTTL),
+	}
+	if err := tx.Create(&session).Error; err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// startSession opens a new session family for the user and returns an
+// access token and refresh token for it.
+func startSession(c *gin.Context, user User) (string, string, error) {
+	familyID := randomToken(16)
+	refresh, err := issueRefreshToken(db, c, user.ID, familyID, time.Now())
+	if err != nil {
+		return "", "", err
+	}
+	return generateJWT(user.Email, user.ID, familyID), refresh, nil
+}
+
+// issueLoginCode stores a new login code for the user and returns it,
+// clearing out codes that expired unused.
+func issueLoginCode(userID uint) (string, error) {
+	if err := db.Where("expires_at <= ?", time.Now()).Delete(&LoginCode{}).Error; err != nil {
+		return "", err
+	}
+	code := randomToken(32)
+	err := db.Create(&LoginCode{UserID: userID, CodeHash: hashToken(code), ExpiresAt: time.Now().Add(loginCodeTTL)}).Error
+	if err != nil {
+		return "", err
+	}
+	return code, nil
+}
+
+// revokeSessions ends every session of the user matching the extra
+// conditions, e.g. a single family.
+func revokeSessions(tx *gorm.DB, userID uint, query string, args ...interface{}) error {
+	return tx.Model(&Session{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Where(query, args...).
+		Update("revoked_at", time.Now()).Error
+}
+
+// sessionActive reports whether the user's session family is still signed
+// in, so that access tokens stop working as soon as it is revoked rather
+// than when they expire.
+func sessionActive(userID uint, familyID string) (bool, error) {
+	var n int64
+	err := db.Model(&Session{}).
+		Where("user_id = ? AND family_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, familyID, time.Now()).
+		Count(&n).Error
+	return n > 0, err
+}
+
+func RefreshSession(c *gin.Context) {
+	var input struct {
+		RefreshToken string `json:"refresh_token" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	var session Session
+	if err := db.Where("token_hash = ?", hashToken(input.RefreshToken)).First(&session).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+		return
+	}
+	if session.RevokedAt != nil || time.Now().After(session.ExpiresAt) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Session expired"})
+		return
+	}
+
+	var user User
+	if err := db.First(&user, session.UserID).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+		return
+	}
+
+	var refresh string
+	reused := false
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// Only one caller can rotate a token; anyone else is replaying it
+		res := tx.Model(&Session{}).
+			Where("id = ? AND rotated_at IS NULL", session.ID).
+			Update("rotated_at", time.Now())
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			reused = true
+			return nil
+		}
+		var err error
+		refresh, err = issueRefreshToken(tx, c, user.ID, session.FamilyID, session.StartedAt)
+		return err
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh session"})
+		return
+	}
+
+	if reused {
+		// A rotated token came back, so it has leaked: end the whole family
+		if err := revokeSessions(db, session.UserID, "family_id = ?", session.FamilyID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke session"})
+			return
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token reuse detected"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"token":         generateJWT(user.Email, user.ID, session.FamilyID),
+		"refresh_token": refresh,
+	})
+}
+
+// ExchangeLoginCode trades a login code from the Google callback for a new
+// session, answering like LoginUser. A code works once.
+func ExchangeLoginCode(c *gin.Context) {
+	var input struct {
+		Code string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	var code LoginCode
+	if err := db.Where("code_hash = ? AND expires_at > ?", hashToken(input.Code), time.Now()).First(&code).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired login code"})
+		return
+	}
+	// Only one caller can delete the code; anyone else is replaying it
+	res := db.Delete(&code)
+	if res.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start session"})
+		return
+	}
+	if res.RowsAffected == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired login code"})
+		return
+	}
+
+	var user User
+	if err := db.First(&user, code.UserID).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired login code"})
+		return
+	}
+	token, refresh, err := startSession(c, user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start session"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message":       "Login successful",
+		"userId":        user.ID,
+		"token":         token,
+		"refresh_token": refresh,
+	})
+}
+
+func Logout(c *gin.Context) {
+	var input struct {
+		RefreshToken string `json:"refresh_token" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	var session Session
+	if err := db.Where("token_hash = ?", hashToken(input.RefreshToken)).First(&session).Error; err == nil {
+		if err := revokeSessions(db, session.UserID, "family_id = ?", session.FamilyID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log out"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out"})
+}
+
+func GetSessions(c *gin.Context) {
+	var sessions []Session
+	result := db.Where("user_id = ? AND revoked_at IS NULL AND rotated_at IS NULL AND expires_at > ?",
+		currentUserID(c), time.Now()).
+		Order("created_at DESC").
+		Find(&sessions)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve sessions"})
+		return
+	}
+
+	current := currentSessionID(c)
+	for i := range sessions {
+		sessions[i].Current = current != "" && sessions[i].FamilyID == current
+	}
+	c.JSON(http.StatusOK, sessions)
+}
+
+func RevokeSession(c *gin.Context) {
+	var session Session
+	if !findOwned(c, &session, "Session not found") {
+		return
+	}
+	if err := revokeSessions(db, session.UserID, "family_id = ?", session.FamilyID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke session"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Session revoked"})
+}
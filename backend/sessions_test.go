@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// login signs in as the seeded user and returns the access and refresh tokens.
+func login(t *testing.T, r *gin.Engine, email, password string) (string, string) {
+	req := httptest.NewRequest("POST", "/login", bytes.NewBufferString(
+		`{"email":"`+email+`","password":"`+password+`"}`,
+	))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var resp map[string]interface{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	return resp["token"].(string), resp["refresh_token"].(string)
+}
+
+func refresh(r *gin.Engine, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/auth/refresh", bytes.NewBufferString(`{"refresh_token":"`+token+`"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+// authStatus returns the status of an authenticated request made with token.
+func authStatus(r *gin.Engine, token string) int {
+	req := httptest.NewRequest("GET", "/auth/sessions", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w.Code
+}
+
+func seedUser(email, password string) User {
+	hashed, _ := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	user := User{FullName: "T", Username: email, Email: email, Password: string(hashed)}
+	db.Create(&user)
+	return user
+}
+
+func TestRefreshRotatesAndDetectsReuse(t *testing.T) {
+	setupTestDB()
+	r := setupRouter()
+	seedUser("a@x.com", "pw")
+
+	_, rt1 := login(t, r, "a@x.com", "pw")
+
+	// rotate
+	w := refresh(r, rt1)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var resp map[string]string
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	rt2 := resp["refresh_token"]
+	assert.NotEmpty(t, resp["token"])
+	assert.NotEqual(t, rt1, rt2)
+
+	// the new access token works
+	req := httptest.NewRequest("GET", "/auth/sessions", nil)
+	req.Header.Set("Authorization", "Bearer "+resp["token"])
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// replaying the old token revokes the whole family
+	assert.Equal(t, http.StatusUnauthorized, refresh(r, rt1).Code)
+	assert.Equal(t, http.StatusUnauthorized, refresh(r, rt2).Code)
+	assert.Equal(t, http.StatusUnauthorized, authStatus(r, resp["token"]))
+
+	// garbage and malformed input
+	assert.Equal(t, http.StatusUnauthorized, refresh(r, "nope").Code)
+	req = httptest.NewRequest("POST", "/auth/refresh", bytes.NewBufferString(`{}`))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestLogoutRevokesSession(t *testing.T) {
+	setupTestDB()
+	r := setupRouter()
+	seedUser("a@x.com", "pw")
+
+	at, rt := login(t, r, "a@x.com", "pw")
+	assert.Equal(t, http.StatusOK, authStatus(r, at))
+
+	req := httptest.NewRequest("POST", "/auth/logout", bytes.NewBufferString(`{"refresh_token":"`+rt+`"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	assert.Equal(t, http.StatusUnauthorized, refresh(r, rt).Code)
+	// the access token stops working at once, not when it expires
+	assert.Equal(t, http.StatusUnauthorized, authStatus(r, at))
+}
+
+func TestListAndRevokeSessions(t *testing.T) {
+	setupTestDB()
+	r := setupRouter()
+	seedUser("a@x.com", "pw")
+	seedUser("b@x.com", "pw")
+
+	at1, _ := login(t, r, "a@x.com", "pw")
+	at2, rt2 := login(t, r, "a@x.com", "pw")
+	at3, _ := login(t, r, "b@x.com", "pw")
+
+	list := func(token string) []Session {
+		req := httptest.NewRequest("GET", "/auth/sessions", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		var sessions []Session
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &sessions))
+		return sessions
+	}
+
+	sessions := list(at1)
+	assert.Len(t, sessions, 2)
+	var other Session
+	for _, s := range sessions {
+		if !s.Current {
+			other = s
+		}
+	}
+	assert.NotZero(t, other.ID)
+
+	// another user cannot revoke it
+	req := httptest.NewRequest("DELETE", "/auth/sessions/"+fmt.Sprint(other.ID), nil)
+	req.Header.Set("Authorization", "Bearer "+at3)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// the owner can
+	req = httptest.NewRequest("DELETE", "/auth/sessions/"+fmt.Sprint(other.ID), nil)
+	req.Header.Set("Authorization", "Bearer "+at1)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	sessions = list(at1)
+	assert.Len(t, sessions, 1)
+	assert.True(t, sessions[0].Current)
+	assert.Equal(t, http.StatusUnauthorized, refresh(r, rt2).Code)
+	assert.Equal(t, http.StatusUnauthorized, authStatus(r, at2))
+	assert.Equal(t, http.StatusOK, authStatus(r, at3))
+}
+
+func TestPasswordChangeEndsOtherSessions(t *testing.T) {
+	setupTestDB()
+	r := setupRouter()
+	user := seedUser("a@x.com", "old")
+
+	at1, rt1 := login(t, r, "a@x.com", "old")
+	at2, rt2 := login(t, r, "a@x.com", "old")
+
+	req := httptest.NewRequest("PUT", "/users/"+fmt.Sprint(user.ID)+"/password", bytes.NewBufferString(
+		`{"currentPassword":"old","newPassword":"new"}`,
+	))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+at1)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	assert.Equal(t, http.StatusUnauthorized, refresh(r, rt2).Code)
+	assert.Equal(t, http.StatusOK, refresh(r, rt1).Code)
+	assert.Equal(t, http.StatusUnauthorized, authStatus(r, at2))
+	assert.Equal(t, http.StatusOK, authStatus(r, at1))
+}
+
+func TestExchangeLoginCode(t *testing.T) {
+	setupTestDB()
+	r := setupRouter()
+	user := seedUser("a@x.com", "pw")
+
+	exchange := func(code string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/login/google/exchange", bytes.NewBufferString(`{"code":"`+code+`"}`))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	code, err := issueLoginCode(user.ID)
+	assert.NoError(t, err)
+	w := exchange(code)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var resp map[string]interface{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.EqualValues(t, user.ID, resp["userId"])
+	assert.Equal(t, http.StatusOK, authStatus(r, resp["token"].(string)))
+	assert.Equal(t, http.StatusOK, refresh(r, resp["refresh_token"].(string)).Code)
+
+	// a code works once, and not after it expires
+	assert.Equal(t, http.StatusUnauthorized, exchange(code).Code)
+	code, _ = issueLoginCode(user.ID)
+	db.Model(&LoginCode{}).Where("user_id = ?", user.ID).Update("expires_at", time.Now().Add(-time.Second))
+	assert.Equal(t, http.StatusUnauthorized, exchange(code).Code)
+	assert.Equal(t, http.StatusUnauthorized, exchange("nope").Code)
+
+	// expired codes are cleared out when the next one is issued
+	issueLoginCode(user.ID)
+	var n int64
+	db.Model(&LoginCode{}).Count(&n)
+	assert.Equal(t, int64(1), n)
+}
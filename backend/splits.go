@@ -0,0 +1,71 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// ExpenseSplit is one line of an expense that spans several categories, such
+// as the groceries on a receipt that also covers household goods. The lines
+// of an expense add up to its amount.
+type ExpenseSplit struct {
+	ID         uint   `json:"id" gorm:"primaryKey"`
+	ExpenseID  uint   `json:"expense_id" gorm:"not null;index"`
+	CategoryID *uint  `json:"category_id" gorm:"index"`
+	Category   string `json:"category"` // name of CategoryID
+	Amount     Money  `json:"amount"`
+	Note       string `json:"note"`
+}
+
+// validateSplits checks the lines of an expense against its amount.
+func (e Expense) validateSplits() error {
+	var sum Money
+	for _, s := range e.Splits {
+		if s.Amount <= 0 {
+			return errors.New("split amounts must be greater than zero")
+		}
+		if s.CategoryID == nil && strings.TrimSpace(s.Category) == "" {
+			return errors.New("every split needs a category")
+		}
+		if !s.Amount.fits(e.Currency) {
+			return fractionError("split amounts", e.Currency)
+		}
+		sum += s.Amount
+	}
+	if sum != e.Amount {
+		return fmt.Errorf("splits add up to %s, not the amount %s", sum, e.Amount)
+	}
+	return nil
+}
+
+// replaceSplits swaps the stored lines of e for e.Splits.
+func replaceSplits(tx *gorm.DB, e *Expense) error {
+	if err := tx.Where("expense_id = ?", e.ID).Delete(&ExpenseSplit{}).Error; err != nil {
+		return err
+	}
+	for i := range e.Splits {
+		e.Splits[i].ID = 0
+		e.Splits[i].ExpenseID = e.ID
+	}
+	if len(e.Splits) == 0 {
+		return nil
+	}
+	return tx.Create(&e.Splits).Error
+}
+
+// expenseLines is a stand-in for the expenses table with one row per line:
+// each split line takes the place of its expense, carrying the line's
+// category and amount, while unsplit expenses appear as they are. Reports
+// built on it count every line under its own category.
+func expenseLines() *gorm.DB {
+	lines := db.Table("expenses AS e").
+		Select("e.id, e.user_id, e.currency, e.date, e.description, e.paid, " +
+			"COALESCE(s.category_id, e.category_id) AS category_id, " +
+			"COALESCE(s.category, e.category) AS category, " +
+			"COALESCE(s.amount, e.amount) AS amount").
+		Joins("LEFT JOIN expense_splits s ON s.expense_id = e.id")
+	return db.Table("(?) AS expenses", lines)
+}
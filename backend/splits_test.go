@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitExpenses(t *testing.T) {
+	setupTestDB()
+	r := setupRouter()
+
+	// lines must add up to the amount
+	for _, body := range []string{
+		`{"amount":50,"date":"2025-04-10","splits":[{"category":"Groceries","amount":30},{"category":"Household","amount":15}]}`,
+		`{"amount":50,"date":"2025-04-10","splits":[{"category":"Groceries","amount":50},{"category":"Household","amount":0}]}`,
+		`{"amount":50,"date":"2025-04-10","splits":[{"category":"Groceries","amount":30},{"amount":20}]}`,
+	} {
+		assert.Equal(t, http.StatusBadRequest, sendJSON(r, "POST", "/expenses", body, 1).Code, body)
+	}
+
+	w := sendJSON(r, "POST", "/expenses", `{"amount":50,"description":"Supermarket","date":"2025-04-10","splits":[
+		{"category":"groceries","amount":"30.50","note":"food"},
+		{"category":"Household","amount":"19.50"}]}`, 1)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var e Expense
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &e))
+	assert.Len(t, e.Splits, 2)
+	assert.NotNil(t, e.Splits[0].CategoryID)
+
+	// a line reuses an existing category, ignoring case
+	assert.Equal(t, http.StatusOK, sendJSON(r, "POST", "/expenses", `{"amount":10,"category":"Groceries","date":"2025-04-11"}`, 1).Code)
+	var count int64
+	db.Model(&Category{}).Where("LOWER(name) = 'groceries'").Count(&count)
+	assert.EqualValues(t, 1, count)
+
+	// category report counts each line on its own
+	var report struct {
+		Categories []categoryTotal `json:"categories"`
+	}
+	code := getJSON(r, "/reports/categories?from=2025-04-01&to=2025-04-30", 1, &report)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, []categoryTotal{
+		{Category: "groceries", Total: 4050, Count: 2, Share: 67.5},
+		{Category: "Household", Total: 1950, Count: 1, Share: 32.5},
+	}, report.Categories)
+
+	// so does budget progress limited to a category
+	db.Create(&Budget{UserID: 1, BudgetName: "Home", BudgetAmount: 10000, Currency: "USD", StartDate: mustDate("2025-04-01"), EndDate: mustDate("2025-04-30"), Categories: []string{"Household"}})
+	var p BudgetProgress
+	assert.Equal(t, http.StatusOK, getJSON(r, "/budget/1/progress", 1, &p))
+	assert.Equal(t, Money(1950), p.Spent)
+
+	// lists carry the lines; patching other fields keeps them
+	w = sendJSON(r, "PATCH", "/expenses/1", `{"description":"Big shop"}`, 1)
+	assert.Equal(t, http.StatusOK, w.Code)
+	_, list := listExpenses(t, nil)
+	assert.Len(t, list.Data, 2)
+	assert.Len(t, list.Data[1].Splits, 2)
+	assert.Equal(t, "Big shop", list.Data[1].Description)
+
+	// changing the amount alone no longer adds up
+	assert.Equal(t, http.StatusBadRequest, sendJSON(r, "PATCH", "/expenses/1", `{"amount":60}`, 1).Code)
+
+	// replacing the lines, or dropping them for a single category
+	w = sendJSON(r, "PATCH", "/expenses/1", `{"amount":60,"splits":[{"category":"Household","amount":60}]}`, 1)
+	assert.Equal(t, http.StatusOK, w.Code)
+	db.Model(&ExpenseSplit{}).Count(&count)
+	assert.EqualValues(t, 1, count)
+	assert.Equal(t, http.StatusBadRequest, sendJSON(r, "PATCH", "/expenses/1", `{"splits":null}`, 1).Code) // no category left
+	assert.Equal(t, http.StatusOK, sendJSON(r, "PATCH", "/expenses/1", `{"splits":null,"category":"Household"}`, 1).Code)
+	db.Model(&ExpenseSplit{}).Count(&count)
+	assert.Zero(t, count)
+
+	// deleting an expense deletes its lines
+	sendJSON(r, "POST", "/expenses", `{"amount":2,"date":"2025-04-10","splits":[{"category":"A","amount":1},{"category":"B","amount":1}]}`, 1)
+	assert.Equal(t, http.StatusOK, sendJSON(r, "DELETE", "/expenses/3", "", 1).Code)
+	db.Model(&ExpenseSplit{}).Count(&count)
+	assert.Zero(t, count)
+}
+
+func TestAddExpenseIgnoresSplitIDs(t *testing.T) {
+	setupTestDB()
+	r := setupRouter()
+	assert.Equal(t, http.StatusOK, sendJSON(r, "POST", "/expenses", `{"amount":50,"date":"2025-04-10","splits":[
+		{"category":"Groceries","amount":30},{"category":"Household","amount":20}]}`, 1).Code)
+
+	// another user naming the first user's lines gets new ones
+	w := sendJSON(r, "POST", "/expenses", `{"amount":6,"date":"2025-04-10","splits":[
+		{"id":1,"expense_id":1,"category":"Fun","amount":6}]}`, 2)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var e Expense
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &e))
+	if assert.Len(t, e.Splits, 1) {
+		assert.NotEqual(t, uint(1), e.Splits[0].ID)
+		assert.Equal(t, e.ID, e.Splits[0].ExpenseID)
+	}
+
+	var lines []ExpenseSplit
+	db.Where("expense_id = ?", 1).Order("id").Find(&lines)
+	if assert.Len(t, lines, 2) {
+		assert.Equal(t, uint(1), lines[0].ID)
+		assert.Equal(t, Money(3000), lines[0].Amount)
+	}
+}
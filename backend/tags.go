@@ -0,0 +1,261 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Tag is a free-form label on expenses and incomes, such as "vacation-2026".
+// Names are unique per user, ignoring case.
+type Tag struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	UserID    uint      `json:"user_id" gorm:"not null;index"`
+	Name      string    `json:"name" gorm:"not null"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (t Tag) OwnerID() uint { return t.UserID }
+
+// tagJoins names the join table and its foreign key for each kind of
+// record that can be tagged: transactions, and the rules that tag them.
+var tagJoins = map[string]struct{ table, column string }{
+	kindExpense: {"expense_tags", "expense_id"},
+	kindIncome:  {"income_tags", "income_id"},
+	"rule":      {"transaction_rule_tags", "transaction_rule_id"},
+}
+
+var errUnknownTag = errors.New("tags must name your own tags by id or name")
+
+func findTagByName(tx *gorm.DB, userID uint, name string) (Tag, error) {
+	var tag Tag
+	err := tx.Where("user_id = ? AND LOWER(name) = ?", userID, strings.ToLower(strings.TrimSpace(name))).
+		Order("id").First(&tag).Error
+	return tag, err
+}
+
+// resolveTags turns the tags a client sent, each given by id or by name,
+// into the user's tag rows, creating tags for new names.
+func resolveTags(userID uint, tags []Tag) ([]Tag, error) {
+	resolved := []Tag{}
+	seen := map[uint]bool{}
+	for _, t := range tags {
+		var tag Tag
+		var err error
+		switch {
+		case t.ID != 0:
+			err = db.Where("id = ? AND user_id = ?", t.ID, userID).First(&tag).Error
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, errUnknownTag
+			}
+		case strings.TrimSpace(t.Name) != "":
+			tag, err = findTagByName(db, userID, t.Name)
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				tag = Tag{UserID: userID, Name: strings.TrimSpace(t.Name)}
+				err = db.Create(&tag).Error
+			}
+		default:
+			return nil, errUnknownTag
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !seen[tag.ID] {
+			seen[tag.ID] = true
+			resolved = append(resolved, tag)
+		}
+	}
+	return resolved, nil
+}
+
+// tagError answers a failed tag lookup.
+func tagError(c *gin.Context, err error) {
+	if errors.Is(err, errUnknownTag) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to look up tags"})
+}
+
+// tagFilter reads the tag filter shared by list and report endpoints: tag
+// names, repeatable, and tag_mode, which is "any" (the default) to match
+// transactions with at least one of them or "all" to require every one.
+type tagFilter struct {
+	names []string
+	all   bool
+}
+
+func parseTagFilter(c *gin.Context) (tagFilter, bool) {
+	var f tagFilter
+	for _, name := range c.QueryArray("tag") {
+		if name = strings.TrimSpace(name); name != "" {
+			f.names = append(f.names, strings.ToLower(name))
+		}
+	}
+	switch c.DefaultQuery("tag_mode", "any") {
+	case "any":
+	case "all":
+		f.all = true
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "tag_mode must be any or all"})
+		return tagFilter{}, false
+	}
+	return f, true
+}
+
+// apply limits query, over transactions of the given kind, to those the
+// filter matches.
+func (f tagFilter) apply(query *gorm.DB, kind string) *gorm.DB {
+	if len(f.names) == 0 {
+		return query
+	}
+	join := tagJoins[kind]
+	sub := db.Table(join.table).
+		Select(join.column).
+		Joins("JOIN tags ON tags.id = "+join.table+".tag_id").
+		Where("LOWER(tags.name) IN ?", f.names)
+	if f.all {
+		sub = sub.Group(join.column).Having("COUNT(DISTINCT tags.id) = ?", len(f.names))
+	}
+	return query.Where("id IN (?)", sub)
+}
+
+func GetTags(c *gin.Context) {
+	tags := []Tag{}
+	if err := db.Where("user_id = ?", currentUserID(c)).Order("name").Find(&tags).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve tags"})
+		return
+	}
+	c.JSON(http.StatusOK, tags)
+}
+
+// validateTagName checks that name is usable for the user's tag id, which
+// is 0 for a new tag.
+func validateTagName(userID, id uint, name string) error {
+	if name == "" {
+		return errors.New("name is required")
+	}
+	if len(name) > 50 {
+		return errors.New("name must be at most 50 characters")
+	}
+	if existing, err := findTagByName(db, userID, name); err == nil && existing.ID != id {
+		return errors.New("a tag with this name already exists")
+	}
+	return nil
+}
+
+func AddTag(c *gin.Context) {
+	var tag Tag
+	if err := c.ShouldBindJSON(&tag); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	tag.ID = 0
+	tag.UserID = currentUserID(c)
+	tag.Name = strings.TrimSpace(tag.Name)
+	if err := validateTagName(tag.UserID, 0, tag.Name); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := db.Create(&tag).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save tag"})
+		return
+	}
+	c.JSON(http.StatusOK, tag)
+}
+
+// RenameTag renames a tag everywhere it is used. To fold it into another
+// existing tag, use MergeTag instead.
+func RenameTag(c *gin.Context) {
+	var tag Tag
+	if !findOwned(c, &tag, "Tag not found") {
+		return
+	}
+	var input struct {
+		Name string `json:"name"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	name := strings.TrimSpace(input.Name)
+	if err := validateTagName(tag.UserID, tag.ID, name); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := db.Model(&tag).Update("name", name).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update tag"})
+		return
+	}
+	c.JSON(http.StatusOK, tag)
+}
+
+// MergeTag moves every use of a tag onto another of the user's tags and
+// deletes it.
+func MergeTag(c *gin.Context) {
+	var tag Tag
+	if !findOwned(c, &tag, "Tag not found") {
+		return
+	}
+	var input struct {
+		Into uint `json:"into"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	var target Tag
+	if err := db.Where("id = ? AND user_id = ?", input.Into, tag.UserID).First(&target).Error; err != nil || target.ID == tag.ID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "into must name another of your tags"})
+		return
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		for _, join := range tagJoins {
+			// Transactions already carrying the target keep a single copy.
+			err := tx.Exec(
+				"INSERT INTO "+join.table+" ("+join.column+", tag_id) SELECT "+join.column+", ? FROM "+join.table+
+					" WHERE tag_id = ? AND "+join.column+" NOT IN (SELECT "+join.column+" FROM "+join.table+" WHERE tag_id = ?)",
+				target.ID, tag.ID, target.ID,
+			).Error
+			if err != nil {
+				return err
+			}
+			if err := tx.Exec("DELETE FROM "+join.table+" WHERE tag_id = ?", tag.ID).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Delete(&tag).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to merge tags"})
+		return
+	}
+	c.JSON(http.StatusOK, target)
+}
+
+// DeleteTag removes a tag from every transaction and deletes it.
+func DeleteTag(c *gin.Context) {
+	var tag Tag
+	if !findOwned(c, &tag, "Tag not found") {
+		return
+	}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		for _, join := range tagJoins {
+			if err := tx.Exec("DELETE FROM "+join.table+" WHERE tag_id = ?", tag.ID).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Delete(&tag).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete tag"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Tag deleted"})
+}
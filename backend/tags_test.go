@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func tagNames(tags []Tag) []string {
+	names := []string{}
+	for _, t := range tags {
+		names = append(names, t.Name)
+	}
+	return names
+}
+
+func TestTaggingTransactions(t *testing.T) {
+	setupTestDB()
+	r := setupRouter()
+
+	w := sendJSON(r, "POST", "/tags", `{"name":" reimbursable "}`, 1)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, http.StatusBadRequest, sendJSON(r, "POST", "/tags", `{"name":"Reimbursable"}`, 1).Code)
+	assert.Equal(t, http.StatusBadRequest, sendJSON(r, "POST", "/tags", `{"name":""}`, 1).Code)
+
+	// tags by id or name; new names are created, repeats collapse
+	w = sendJSON(r, "POST", "/expenses", `{"amount":10,"category":"Travel","date":"2025-04-01","tags":[{"id":1},{"name":"vacation-2026"},{"name":"REIMBURSABLE"}]}`, 1)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var e Expense
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &e))
+	assert.Equal(t, []string{"reimbursable", "vacation-2026"}, tagNames(e.Tags))
+
+	assert.Equal(t, http.StatusOK, sendJSON(r, "POST", "/expenses", `{"amount":20,"category":"Travel","date":"2025-04-02","tags":[{"name":"vacation-2026"}]}`, 1).Code)
+	assert.Equal(t, http.StatusOK, sendJSON(r, "POST", "/expenses", `{"amount":30,"category":"Food","date":"2025-04-03"}`, 1).Code)
+	assert.Equal(t, http.StatusOK, sendJSON(r, "POST", "/incomes", `{"amount":50,"category":"Refund","date":"2025-04-04","tags":[{"id":1}]}`, 1).Code)
+
+	// someone else's tag cannot be used
+	assert.Equal(t, http.StatusBadRequest, sendJSON(r, "POST", "/expenses", `{"amount":5,"category":"Food","date":"2025-04-03","tags":[{"id":1}]}`, 2).Code)
+
+	// any vs all
+	for _, tc := range []struct {
+		query url.Values
+		want  int
+	}{
+		{url.Values{"tag": {"vacation-2026"}}, 2},
+		{url.Values{"tag": {"vacation-2026", "Reimbursable"}}, 2},
+		{url.Values{"tag": {"vacation-2026", "reimbursable"}, "tag_mode": {"all"}}, 1},
+		{url.Values{"tag": {"nothing"}}, 0},
+	} {
+		code, resp := listExpenses(t, tc.query)
+		assert.Equal(t, http.StatusOK, code)
+		assert.Len(t, resp.Data, tc.want, tc.query.Encode())
+	}
+	code, _ := listExpenses(t, url.Values{"tag": {"x"}, "tag_mode": {"some"}})
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	// reports filter the same way
+	w = sendJSON(r, "GET", "/reports/totals?tag=reimbursable", "", 1)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"currency":"USD","income":50,"expenses":10,"net":40}`, w.Body.String())
+
+	// patching other fields keeps the tags; replacing the list replaces them
+	w = sendJSON(r, "PATCH", "/expenses/1", `{"amount":11}`, 1)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &e))
+	assert.Len(t, e.Tags, 2)
+	w = sendJSON(r, "PATCH", "/expenses/1", `{"tags":[{"name":"work"}]}`, 1)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var loaded Expense
+	db.Preload("Tags").First(&loaded, 1)
+	assert.Equal(t, []string{"work"}, tagNames(loaded.Tags))
+}
+
+func TestRenameMergeAndDeleteTags(t *testing.T) {
+	setupTestDB()
+	r := setupRouter()
+	sendJSON(r, "POST", "/expenses", `{"amount":1,"category":"c","date":"2025-04-01","tags":[{"name":"trip"},{"name":"holiday"}]}`, 1)
+	sendJSON(r, "POST", "/expenses", `{"amount":2,"category":"c","date":"2025-04-01","tags":[{"name":"trip"}]}`, 1)
+	sendJSON(r, "POST", "/incomes", `{"amount":3,"category":"c","date":"2025-04-01","tags":[{"name":"trip"}]}`, 1)
+
+	// rename
+	w := sendJSON(r, "PATCH", "/tags/1", `{"name":"Trip 2026"}`, 1)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var tag Tag
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &tag))
+	assert.Equal(t, "Trip 2026", tag.Name)
+	assert.Equal(t, http.StatusBadRequest, sendJSON(r, "PATCH", "/tags/1", `{"name":"HOLIDAY"}`, 1).Code)
+	assert.Equal(t, http.StatusForbidden, sendJSON(r, "PATCH", "/tags/1", `{"name":"mine"}`, 2).Code)
+
+	// merge "Trip 2026" into "holiday": the first expense ends up with one tag
+	assert.Equal(t, http.StatusBadRequest, sendJSON(r, "POST", "/tags/1/merge", `{"into":1}`, 1).Code)
+	assert.Equal(t, http.StatusOK, sendJSON(r, "POST", "/tags/1/merge", `{"into":2}`, 1).Code)
+	var expenses []Expense
+	db.Preload("Tags").Order("id").Find(&expenses)
+	assert.Equal(t, []string{"holiday"}, tagNames(expenses[0].Tags))
+	assert.Equal(t, []string{"holiday"}, tagNames(expenses[1].Tags))
+	var income Income
+	db.Preload("Tags").First(&income)
+	assert.Equal(t, []string{"holiday"}, tagNames(income.Tags))
+	var count int64
+	db.Model(&Tag{}).Count(&count)
+	assert.EqualValues(t, 1, count)
+
+	// delete
+	assert.Equal(t, http.StatusOK, sendJSON(r, "DELETE", "/tags/2", "", 1).Code)
+	db.Table("expense_tags").Count(&count)
+	assert.Zero(t, count)
+	db.Preload("Tags").First(&income)
+	assert.Empty(t, income.Tags)
+
+	// deleting a transaction drops its tag links
+	sendJSON(r, "POST", "/expenses", `{"amount":1,"category":"c","date":"2025-04-01","tags":[{"name":"x"}]}`, 1)
+	assert.Equal(t, http.StatusOK, sendJSON(r, "DELETE", "/expenses/3", "", 1).Code)
+	db.Table("expense_tags").Count(&count)
+	assert.Zero(t, count)
+
+	w = sendJSON(r, "GET", "/tags", "", 1)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var tags []Tag
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &tags))
+	assert.Equal(t, []string{"x"}, tagNames(tags))
+}
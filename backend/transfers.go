@@ -0,0 +1,258 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// kindTransfer marks transfers in account ledgers.
+const kindTransfer = "transfer"
+
+// Transfer moves money from one of the user's accounts to another. It is
+// neither income nor expense, so reports leave it out. Amount leaves the
+// source account in its currency and ToAmount reaches the destination in
+// its own; between accounts in different currencies Rate is the number of
+// destination units per source unit.
+type Transfer struct {
+	ID            uint      `json:"id" gorm:"primaryKey"`
+	UserID        uint      `json:"user_id" gorm:"not null;index"`
+	FromAccountID uint      `json:"from_account_id" gorm:"not null;index"`
+	ToAccountID   uint      `json:"to_account_id" gorm:"not null;index"`
+	Amount        Money     `json:"amount"`
+	ToAmount      Money     `json:"to_amount"`
+	Rate          float64   `json:"rate"`
+	Description   string    `json:"description"`
+	Date          Date      `json:"date" gorm:"index"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+func (t Transfer) OwnerID() uint    { return t.UserID }
+func (t Transfer) primaryKey() uint { return t.ID }
+func (t Transfer) cursorValue(column string) string {
+	return transactionCursorValue(column, t.Date, t.Amount, t.CreatedAt)
+}
+
+var (
+	errTransferAccounts = errors.New("from_account_id and to_account_id must name two different accounts of yours")
+	errSameCurrency     = errors.New("accounts share a currency, so to_amount and rate must match amount")
+	errNeedRate         = errors.New("accounts differ in currency, so to_amount or rate is required")
+	errRateTooSmall     = errors.New("rate is too small for this amount")
+	errRateMismatch     = errors.New("to_amount must equal amount times rate")
+	errRateFraction     = errors.New("rate gives a to_amount finer than the destination currency allows; give to_amount instead")
+)
+
+func (t Transfer) validate() error {
+	if t.Amount <= 0 {
+		return errors.New("amount must be greater than zero")
+	}
+	if t.ToAmount < 0 || t.Rate < 0 || math.IsNaN(t.Rate) || math.IsInf(t.Rate, 0) {
+		return errors.New("to_amount and rate must not be negative")
+	}
+	if t.Date.IsZero() {
+		return errors.New("date is required")
+	}
+	if t.FromAccountID == t.ToAccountID {
+		return errTransferAccounts
+	}
+	return nil
+}
+
+// price settles the destination side of t once the currencies of both
+// accounts are known. Within one currency the amount arrives unchanged;
+// across currencies the client gives to_amount, rate or both, and the
+// missing one is derived. Given both, they must agree up to rounding, and
+// the stored rate is derived from to_amount so that the two never
+// contradict each other. Both amounts must be whole numbers of their
+// currency's minor unit; a rate that would give a fraction of one is
+// refused rather than rounded.
+func (t *Transfer) price(from, to Account) error {
+	if !t.Amount.fits(from.Currency) {
+		return fractionError("amount", from.Currency)
+	}
+	if from.Currency == to.Currency {
+		if t.ToAmount != 0 && t.ToAmount != t.Amount || t.Rate != 0 && t.Rate != 1 {
+			return errSameCurrency
+		}
+		t.ToAmount, t.Rate = t.Amount, 1
+		return nil
+	}
+	switch {
+	case t.ToAmount == 0 && t.Rate == 0:
+		return errNeedRate
+	case t.ToAmount == 0:
+		t.ToAmount = Money(math.Round(float64(t.Amount) * t.Rate))
+		if t.ToAmount <= 0 {
+			return errRateTooSmall
+		}
+		if !t.ToAmount.fits(to.Currency) {
+			return errRateFraction
+		}
+	case !t.ToAmount.fits(to.Currency):
+		return fractionError("to_amount", to.Currency)
+	case t.Rate == 0:
+		t.Rate = transferRate(t.Amount, t.ToAmount)
+	default:
+		// to_amount rounded from amount*rate, or rate from to_amount/amount
+		if math.Abs(float64(t.Amount)*t.Rate-float64(t.ToAmount)) > 1 && t.Rate != transferRate(t.Amount, t.ToAmount) {
+			return errRateMismatch
+		}
+		t.Rate = transferRate(t.Amount, t.ToAmount)
+	}
+	return nil
+}
+
+// transferRate is the rate to_amount/amount, to six decimal places.
+func transferRate(amount, toAmount Money) float64 {
+	return math.Round(float64(toAmount)/float64(amount)*1e6) / 1e6
+}
+
+// saveTransfer checks both accounts and prices and stores t in one
+// database transaction, so that neither account changes currency or owner
+// in between.
+func saveTransfer(t *Transfer) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		var accounts []Account
+		if err := tx.Where("id IN ? AND user_id = ?", []uint{t.FromAccountID, t.ToAccountID}, t.UserID).Find(&accounts).Error; err != nil {
+			return err
+		}
+		if len(accounts) != 2 {
+			return errTransferAccounts
+		}
+		from, to := accounts[0], accounts[1]
+		if from.ID != t.FromAccountID {
+			from, to = to, from
+		}
+		if err := t.price(from, to); err != nil {
+			return err
+		}
+		return tx.Save(t).Error
+	})
+}
+
+// GetTransfers lists the caller's transfers, paginated like expenses.
+// account_id keeps those into or out of one account; from and to bound the
+// dates.
+func GetTransfers(c *gin.Context) {
+	query := db.Where("user_id = ?", currentUserID(c))
+	from, to, ok := dateRange(c)
+	if !ok {
+		return
+	}
+	query = inDateRange(query, from, to)
+	if s := c.Query("account_id"); s != "" {
+		id, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "account_id must be a number"})
+			return
+		}
+		query = query.Where("from_account_id = ? OR to_account_id = ?", id, id)
+	}
+	p, ok := parsePage(c)
+	if !ok {
+		return
+	}
+	query, err := p.apply(query)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cursor"})
+		return
+	}
+
+	var transfers []Transfer
+	if err := query.Find(&transfers).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve transfers"})
+		return
+	}
+	c.JSON(http.StatusOK, newListResponse(transfers, p))
+}
+
+func AddTransfer(c *gin.Context) {
+	var transfer Transfer
+	if err := c.ShouldBindJSON(&transfer); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	transfer.ID = 0
+	transfer.UserID = currentUserID(c)
+	transfer.CreatedAt = time.Time{}
+	if transfer.Date.IsZero() {
+		transfer.Date = today(transfer.UserID)
+	}
+	if err := transfer.validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := saveTransfer(&transfer); err != nil {
+		transferError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, transfer)
+}
+
+// UpdateTransfer replaces or patches a transfer. A patch that changes the
+// amount of a cross-currency transfer without giving to_amount or rate keeps
+// the rate; one that changes only to_amount or only rate derives the other.
+func UpdateTransfer(c *gin.Context) {
+	var transfer Transfer
+	if !findOwned(c, &transfer, "Transfer not found") {
+		return
+	}
+
+	var updated Transfer
+	if err := bindUpdate(c, transfer, &updated); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	updated.ID, updated.UserID, updated.CreatedAt = transfer.ID, transfer.UserID, transfer.CreatedAt
+	// Whichever of to_amount and rate was left alone follows the other
+	switch toSame, rateSame := updated.ToAmount == transfer.ToAmount, updated.Rate == transfer.Rate; {
+	case toSame && rateSame && updated.Amount != transfer.Amount:
+		updated.ToAmount = 0
+	case !toSame && rateSame:
+		updated.Rate = 0
+	case toSame && !rateSame:
+		updated.ToAmount = 0
+	}
+	if err := updated.validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := saveTransfer(&updated); err != nil {
+		transferError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, updated)
+}
+
+func DeleteTransfer(c *gin.Context) {
+	var transfer Transfer
+	if !findOwned(c, &transfer, "Transfer not found") {
+		return
+	}
+	if err := db.Delete(&transfer).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete transfer"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Transfer deleted"})
+}
+
+// transferError answers a transfer that could not be saved.
+func transferError(c *gin.Context, err error) {
+	for _, known := range []error{errTransferAccounts, errSameCurrency, errNeedRate, errRateTooSmall, errRateMismatch, errRateFraction} {
+		if errors.Is(err, known) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if errors.As(err, &minorUnitError{}) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save transfer"})
+}
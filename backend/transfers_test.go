@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransfers(t *testing.T) {
+	setupTestDB()
+	r := setupRouter()
+	db.Create(&User{FullName: "A", Username: "a", Email: "a@x.com", Password: "p", BaseCurrency: "USD"})
+	db.Create(&[]Account{
+		{UserID: 1, Name: "Checking", Type: accountChecking, Currency: "USD", OpeningBalance: 100000},
+		{UserID: 1, Name: "Savings", Type: accountSavings, Currency: "USD"},
+		{UserID: 1, Name: "Euros", Type: accountCash, Currency: "EUR"},
+		{UserID: 2, Name: "Other", Type: accountCash, Currency: "USD"},
+	})
+	checking := uint(1)
+	db.Create(&Income{UserID: 1, Amount: 50000, Currency: "USD", Category: "Salary", Date: mustDate("2025-04-01"), AccountID: &checking})
+
+	for _, body := range []string{
+		`{"from_account_id":1,"to_account_id":1,"amount":10,"date":"2025-04-02"}`,
+		`{"from_account_id":1,"to_account_id":4,"amount":10,"date":"2025-04-02"}`,
+		`{"from_account_id":1,"to_account_id":2,"amount":0,"date":"2025-04-02"}`,
+		`{"from_account_id":1,"to_account_id":2,"amount":10,"rate":1.1,"date":"2025-04-02"}`,
+		`{"from_account_id":1,"to_account_id":3,"amount":10,"date":"2025-04-02"}`,
+		`{"from_account_id":1,"to_account_id":3,"amount":100,"to_amount":92,"rate":0.95,"date":"2025-04-02"}`,
+	} {
+		assert.Equal(t, http.StatusBadRequest, sendJSON(r, "POST", "/transfers", body, 1).Code, body)
+	}
+
+	add := func(body string) Transfer {
+		w := sendJSON(r, "POST", "/transfers", body, 1)
+		assert.Equal(t, http.StatusOK, w.Code, body)
+		var tr Transfer
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &tr))
+		return tr
+	}
+	saving := add(`{"from_account_id":1,"to_account_id":2,"amount":"200.00","description":"Monthly saving","date":"2025-04-02"}`)
+	assert.Equal(t, Money(20000), saving.ToAmount)
+	assert.Equal(t, 1.0, saving.Rate)
+
+	byRate := add(`{"from_account_id":1,"to_account_id":3,"amount":"100.00","rate":0.92,"date":"2025-04-03"}`)
+	assert.Equal(t, Money(9200), byRate.ToAmount)
+	byAmount := add(`{"from_account_id":3,"to_account_id":1,"amount":"46.00","to_amount":"50.00","date":"2025-04-04"}`)
+	assert.Equal(t, 1.086957, byAmount.Rate)
+	// given both, they may differ by rounding only, and the rate follows to_amount
+	both := add(`{"from_account_id":1,"to_account_id":3,"amount":"33.33","to_amount":"30.66","rate":0.92,"date":"2025-04-04"}`)
+	assert.Equal(t, Money(3066), both.ToAmount)
+	assert.Equal(t, 0.919892, both.Rate)
+	assert.Equal(t, http.StatusOK, sendJSON(r, "DELETE", fmt.Sprintf("/transfers/%d", both.ID), "", 1).Code)
+
+	balanceOf := func(id string) Money {
+		var resp struct {
+			Balance Money `json:"balance"`
+		}
+		assert.Equal(t, http.StatusOK, getJSON(r, "/accounts/"+id+"/balance?date=2025-04-30", 1, &resp))
+		return resp.Balance
+	}
+	assert.Equal(t, Money(100000+50000-20000-10000+5000), balanceOf("1"))
+	assert.Equal(t, Money(20000), balanceOf("2"))
+	assert.Equal(t, Money(9200-4600), balanceOf("3"))
+
+	var ledger struct {
+		Entries []ledgerEntry `json:"entries"`
+	}
+	assert.Equal(t, http.StatusOK, getJSON(r, "/accounts/2/ledger", 1, &ledger))
+	assert.Equal(t, []ledgerEntry{{Date: mustDate("2025-04-02"), Kind: kindTransfer, ID: saving.ID, Description: "Monthly saving",
+		Amount: 20000, Balance: 20000}}, ledger.Entries)
+
+	// transfers are neither income nor expense
+	var totals struct {
+		Income   Money `json:"income"`
+		Expenses Money `json:"expenses"`
+	}
+	assert.Equal(t, http.StatusOK, getJSON(r, "/reports/totals", 1, &totals))
+	assert.Equal(t, Money(50000), totals.Income)
+	assert.Zero(t, totals.Expenses)
+	var cashflow struct {
+		Periods []cashflowPeriod `json:"periods"`
+	}
+	assert.Equal(t, http.StatusOK, getJSON(r, "/reports/cashflow?from=2025-04-01&to=2025-04-30", 1, &cashflow))
+	if assert.Len(t, cashflow.Periods, 1) {
+		assert.Equal(t, Money(50000), cashflow.Periods[0].Income)
+		assert.Zero(t, cashflow.Periods[0].Expenses)
+	}
+
+	var list listResponse[Transfer]
+	assert.Equal(t, http.StatusOK, getJSON(r, "/transfers?account_id=3&sort=date", 1, &list))
+	if assert.Len(t, list.Data, 2) {
+		assert.Equal(t, byRate.ID, list.Data[0].ID)
+	}
+
+	// a new amount keeps the rate of a cross-currency transfer
+	w := sendJSON(r, "PATCH", "/transfers/2", `{"amount":"50.00"}`, 1)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &byRate))
+	assert.Equal(t, Money(4600), byRate.ToAmount)
+	// and a new to_amount a new rate
+	w = sendJSON(r, "PATCH", "/transfers/2", `{"to_amount":"47.00"}`, 1)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &byRate))
+	assert.Equal(t, 0.94, byRate.Rate)
+	assert.Equal(t, http.StatusBadRequest, sendJSON(r, "PATCH", "/transfers/2", `{"to_amount":"48.00","rate":0.5}`, 1).Code)
+
+	assert.Equal(t, http.StatusConflict, sendJSON(r, "DELETE", "/accounts/2", "", 1).Code)
+	assert.Equal(t, http.StatusForbidden, sendJSON(r, "DELETE", "/transfers/1", "", 2).Code)
+	assert.Equal(t, http.StatusOK, sendJSON(r, "DELETE", "/transfers/1", "", 1).Code)
+	assert.Equal(t, http.StatusOK, sendJSON(r, "DELETE", "/accounts/2", "", 1).Code)
+}
+
+func TestTransferMinorUnits(t *testing.T) {
+	setupTestDB()
+	r := setupRouter()
+	db.Create(&User{FullName: "A", Username: "a", Email: "a@x.com", Password: "p", BaseCurrency: "USD"})
+	db.Create(&[]Account{
+		{UserID: 1, Name: "Checking", Type: accountChecking, Currency: "USD"},
+		{UserID: 1, Name: "Yen", Type: accountCash, Currency: "JPY"},
+	})
+
+	for body, msg := range map[string]string{
+		`{"from_account_id":1,"to_account_id":2,"amount":"100.00","rate":149.237,"date":"2025-04-10"}`:         errRateFraction.Error(),
+		`{"from_account_id":1,"to_account_id":2,"amount":"100.00","to_amount":"14923.70","date":"2025-04-10"}`: "to_amount must be a whole number of JPY",
+		`{"from_account_id":2,"to_account_id":1,"amount":"0.50","to_amount":"1.00","date":"2025-04-10"}`:       "amount must be a whole number of JPY",
+	} {
+		w := sendJSON(r, "POST", "/transfers", body, 1)
+		assert.Equal(t, http.StatusBadRequest, w.Code, body)
+		assert.Contains(t, w.Body.String(), msg, body)
+	}
+
+	w := sendJSON(r, "POST", "/transfers", `{"from_account_id":1,"to_account_id":2,"amount":"100.00","rate":149.23,"date":"2025-04-10"}`, 1)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var tr Transfer
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &tr))
+	assert.Equal(t, Money(1492300), tr.ToAmount)
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// currencyFor normalises a client-supplied currency code, falling back to
+// the user's base currency when none was given.
+func currencyFor(userID uint, code string) string {
+	if code == "" {
+		return baseCurrencyOf(userID)
+	}
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// baseCurrencyOf returns the currency the user reports in.
+func baseCurrencyOf(userID uint) string {
+	var user User
+	if err := db.Select("base_currency").First(&user, userID).Error; err != nil || user.BaseCurrency == "" {
+		return defaultCurrency
+	}
+	return user.BaseCurrency
+}
+
+var errInvalidCurrency = errors.New("currency must be a three-letter ISO 4217 code with at most two decimals")
+
+func (e Expense) validate() error {
+	if e.Amount <= 0 {
+		return errors.New("amount must be greater than zero")
+	}
+	if e.CategoryID == nil && strings.TrimSpace(e.Category) == "" && len(e.Splits) == 0 {
+		return errors.New("category is required")
+	}
+	if e.Date.IsZero() {
+		return errors.New("date is required")
+	}
+	if !validCurrency(e.Currency) {
+		return errInvalidCurrency
+	}
+	if !e.Amount.fits(e.Currency) {
+		return fractionError("amount", e.Currency)
+	}
+	if len(e.Splits) > 0 {
+		return e.validateSplits()
+	}
+	return nil
+}
+
+func (i Income) validate() error {
+	if i.Amount <= 0 {
+		return errors.New("amount must be greater than zero")
+	}
+	if i.CategoryID == nil && strings.TrimSpace(i.Category) == "" {
+		return errors.New("category is required")
+	}
+	if i.Date.IsZero() {
+		return errors.New("date is required")
+	}
+	if !validCurrency(i.Currency) {
+		return errInvalidCurrency
+	}
+	if !i.Amount.fits(i.Currency) {
+		return fractionError("amount", i.Currency)
+	}
+	return nil
+}
+
+func (b Budget) validate() error {
+	if strings.TrimSpace(b.BudgetName) == "" {
+		return errors.New("budget_name is required")
+	}
+	if b.BudgetAmount <= 0 {
+		return errors.New("budget_amount must be greater than zero")
+	}
+	if b.StartDate.IsZero() || b.EndDate.IsZero() {
+		return errors.New("start_date and end_date are required")
+	}
+	if b.EndDate.Before(b.StartDate) {
+		return errors.New("end_date must not be before start_date")
+	}
+	if !validCurrency(b.Currency) {
+		return errInvalidCurrency
+	}
+	if !b.BudgetAmount.fits(b.Currency) {
+		return fractionError("budget_amount", b.Currency)
+	}
+	return nil
+}
+
+// bindUpdate decodes the request body into next. A PUT body replaces the
+// record outright; a PATCH body is a JSON Merge Patch (RFC 7396) applied to
+// current.
+func bindUpdate(c *gin.Context, current, next interface{}) error {
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		return err
+	}
+	if c.Request.Method == http.MethodPatch {
+		original, err := json.Marshal(current)
+		if err != nil {
+			return err
+		}
+		if body, err = mergePatch(original, body); err != nil {
+			return err
+		}
+	}
+	return json.Unmarshal(body, next)
+}
+
+// mergePatch applies an RFC 7396 JSON Merge Patch to a JSON document.
+func mergePatch(original, patch []byte) ([]byte, error) {
+	var doc, p interface{}
+	if err := json.Unmarshal(original, &doc); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(patch, &p); err != nil {
+		return nil, err
+	}
+	return json.Marshal(applyMergePatch(doc, p))
+}
+
+func applyMergePatch(target, patch interface{}) interface{} {
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	t, ok := target.(map[string]interface{})
+	if !ok {
+		t = map[string]interface{}{}
+	}
+	for k, v := range p {
+		if v == nil {
+			delete(t, k)
+		} else {
+			t[k] = applyMergePatch(t[k], v)
+		}
+	}
+	return t
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMergePatch(t *testing.T) {
+	// examples from RFC 7396, appendix A
+	cases := []struct{ original, patch, want string }{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`{"e":null}`, `{"a":1}`, `{"a":1,"e":null}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+	}
+	for _, tc := range cases {
+		got, err := mergePatch([]byte(tc.original), []byte(tc.patch))
+		assert.NoError(t, err)
+		assert.JSONEq(t, tc.want, string(got), tc.patch)
+	}
+
+	_, err := mergePatch([]byte(`{}`), []byte(`{bad`))
+	assert.Error(t, err)
+}
+
+func TestUpdateExpenseEndpoint(t *testing.T) {
+	setupTestDB()
+	r := setupRouter()
+	created := time.Date(2025, 4, 20, 10, 0, 0, 0, time.UTC)
+	db.Create(&Expense{UserID: 1, Amount: 1000, Category: "Food", Description: "lunch", Date: mustDate("2025-04-20"), CreatedAt: created})
+
+	send := func(method, body string, userID uint) *httptest.ResponseRecorder {
+		req := withAuth(httptest.NewRequest(method, "/expenses/1", bytes.NewBufferString(body)), userID)
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	// patch only the amount
+	w := send("PATCH", `{"amount":12.5,"user_id":2,"id":7}`, 1)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var e Expense
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &e))
+	assert.EqualValues(t, 1, e.ID)
+	assert.EqualValues(t, 1, e.UserID)
+	assert.Equal(t, Money(1250), e.Amount)
+	assert.Equal(t, "Food", e.Category)
+	assert.Equal(t, "lunch", e.Description)
+	assert.True(t, created.Equal(e.CreatedAt))
+	assert.False(t, e.UpdatedAt.IsZero())
+
+	// null removes a field
+	w = send("PATCH", `{"description":null}`, 1)
+	assert.Equal(t, http.StatusOK, w.Code)
+	db.First(&e, 1)
+	assert.Empty(t, e.Description)
+
+	// put replaces the whole record
+	w = send("PUT", `{"amount":20,"category":"Bills","date":"2025-05-01","Paid":true}`, 1)
+	assert.Equal(t, http.StatusOK, w.Code)
+	db.First(&e, 1)
+	assert.Equal(t, Money(2000), e.Amount)
+	assert.Equal(t, "Bills", e.Category)
+	assert.Equal(t, mustDate("2025-05-01"), e.Date)
+	assert.True(t, e.Paid)
+	assert.True(t, created.Equal(e.CreatedAt))
+
+	// validation
+	assert.Equal(t, http.StatusBadRequest, send("PUT", `{"amount":20}`, 1).Code)
+	assert.Equal(t, http.StatusBadRequest, send("PATCH", `{"amount":-1}`, 1).Code)
+	assert.Equal(t, http.StatusBadRequest, send("PATCH", `{"date":"May 1"}`, 1).Code)
+	assert.Equal(t, http.StatusBadRequest, send("PATCH", `{bad}`, 1).Code)
+
+	// ownership
+	assert.Equal(t, http.StatusForbidden, send("PATCH", `{"amount":1}`, 2).Code)
+	db.First(&e, 1)
+	assert.Equal(t, Money(2000), e.Amount)
+}
+
+func TestUpdateIncomeEndpoint(t *testing.T) {
+	setupTestDB()
+	r := setupRouter()
+	db.Create(&Income{UserID: 1, Amount: 10000, Category: "Salary", Date: mustDate("2025-04-01")})
+
+	req := withAuth(httptest.NewRequest("PATCH", "/incomes/1", bytes.NewBufferString(`{"amount":150}`)), 1)
+	req.Header.Set("Content-Type", "application/merge-patch+json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var i Income
+	db.First(&i, 1)
+	assert.Equal(t, Money(15000), i.Amount)
+	assert.Equal(t, "Salary", i.Category)
+
+	req = withAuth(httptest.NewRequest("PUT", "/incomes/999", bytes.NewBufferString(`{}`)), 1)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestUpdateBudgetEndpoint(t *testing.T) {
+	setupTestDB()
+	r := setupRouter()
+	db.Create(&Budget{UserID: 1, BudgetName: "April", BudgetAmount: 50000, StartDate: mustDate("2025-04-01"), EndDate: mustDate("2025-04-30")})
+
+	send := func(method, body string) *httptest.ResponseRecorder {
+		req := withAuth(httptest.NewRequest(method, "/budget/1", bytes.NewBufferString(body)), 1)
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusOK, send("PATCH", `{"budget_amount":600,"notes":"raised"}`).Code)
+	var b Budget
+	db.First(&b, 1)
+	assert.Equal(t, Money(60000), b.BudgetAmount)
+	assert.Equal(t, "raised", b.Notes)
+	assert.Equal(t, "April", b.BudgetName)
+
+	// end before start
+	assert.Equal(t, http.StatusBadRequest, send("PATCH", `{"end_date":"2025-03-01"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, send("PUT", `{"budget_name":"","budget_amount":1,"start_date":"2025-04-01","end_date":"2025-04-30"}`).Code)
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const xlsxContentType = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+
+// Cell styles, indexes into cellXfs of xlsxStyles.
+const (
+	xlsxStyleMoney  = 1
+	xlsxStyleDate   = 2
+	xlsxStyleHeader = 3
+)
+
+const xlsxStyles = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+	`<numFmts count="1"><numFmt numFmtId="164" formatCode="yyyy-mm-dd"/></numFmts>` +
+	`<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>` +
+	`<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>` +
+	`<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>` +
+	`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>` +
+	`<cellXfs count="4">` +
+	`<xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>` +
+	`<xf numFmtId="4" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>` +
+	`<xf numFmtId="164" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>` +
+	`<xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/>` +
+	`</cellXfs></styleSheet>`
+
+// xlsxEpoch is day zero of spreadsheet dates.
+var xlsxEpoch = NewDate(1899, 12, 30)
+
+// xlsxWriter streams a workbook: each sheet's rows go straight into the
+// zip file, and the parts naming the sheets are written on close. Strings
+// are stored inline, so nothing but the sheet names is held in memory.
+// Like archiveWriter it keeps the first error and ignores writes after it.
+type xlsxWriter struct {
+	zw     *zip.Writer
+	cur    io.Writer
+	sheets []string
+	err    error
+}
+
+func newXLSXWriter(w io.Writer) *xlsxWriter {
+	return &xlsxWriter{zw: zip.NewWriter(w)}
+}
+
+func (x *xlsxWriter) write(s string) {
+	if x.err == nil {
+		_, x.err = io.WriteString(x.cur, s)
+	}
+}
+
+// sheet ends the current sheet and starts one called name, whose first
+// row is header.
+func (x *xlsxWriter) sheet(name string, header ...string) {
+	x.endSheet()
+	if x.err != nil {
+		return
+	}
+	x.sheets = append(x.sheets, name)
+	x.cur, x.err = x.zw.Create(fmt.Sprintf("xl/worksheets/sheet%d.xml", len(x.sheets)))
+	x.write(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n" +
+		`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+		`<sheetViews><sheetView workbookViewId="0"><pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/></sheetView></sheetViews>` +
+		`<sheetData>`)
+	x.write("<row>")
+	for _, h := range header {
+		x.text(h, xlsxStyleHeader)
+	}
+	x.write("</row>")
+}
+
+func (x *xlsxWriter) endSheet() {
+	if x.cur != nil {
+		x.write("</sheetData></worksheet>")
+		x.cur = nil
+	}
+}
+
+func (x *xlsxWriter) text(s string, style int) {
+	if style != 0 {
+		x.write(`<c t="inlineStr" s="` + strconv.Itoa(style) + `"><is><t xml:space="preserve">`)
+	} else {
+		x.write(`<c t="inlineStr"><is><t xml:space="preserve">`)
+	}
+	if x.err == nil {
+		x.err = xml.EscapeText(x.cur, []byte(s))
+	}
+	x.write("</t></is></c>")
+}
+
+// row writes a row of the current sheet. Money and dates are stored as
+// numbers, formatted as such; other values as their text.
+func (x *xlsxWriter) row(values ...any) {
+	x.write("<row>")
+	for _, v := range values {
+		switch v := v.(type) {
+		case Money:
+			x.write(`<c s="` + strconv.Itoa(xlsxStyleMoney) + `"><v>` + v.String() + "</v></c>")
+		case Date:
+			if v.IsZero() {
+				x.write("<c/>")
+			} else {
+				x.write(`<c s="` + strconv.Itoa(xlsxStyleDate) + `"><v>` + strconv.Itoa(xlsxEpoch.DaysUntil(v)) + "</v></c>")
+			}
+		case int:
+			x.write("<c><v>" + strconv.Itoa(v) + "</v></c>")
+		case uint:
+			x.write("<c><v>" + strconv.FormatUint(uint64(v), 10) + "</v></c>")
+		default:
+			x.text(fmt.Sprint(v), 0)
+		}
+	}
+	x.write("</row>")
+}
+
+// close ends the last sheet and writes the rest of the workbook.
+func (x *xlsxWriter) close() error {
+	x.endSheet()
+	if x.err != nil {
+		return x.err
+	}
+	var sheets, rels, types string
+	for i, name := range x.sheets {
+		n := i + 1
+		sheets += fmt.Sprintf(`<sheet name="%s" sheetId="%d" r:id="rId%d"/>`, xmlEscape(name), n, n)
+		rels += fmt.Sprintf(`<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet%d.xml"/>`, n, n)
+		types += fmt.Sprintf(`<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`, n)
+	}
+	const header = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n"
+	parts := []struct{ name, content string }{
+		{"xl/workbook.xml", header +
+			`<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+			"<sheets>" + sheets + "</sheets></workbook>"},
+		{"xl/_rels/workbook.xml.rels", header +
+			`<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` + rels +
+			fmt.Sprintf(`<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>`, len(x.sheets)+1) +
+			"</Relationships>"},
+		{"xl/styles.xml", xlsxStyles},
+		{"_rels/.rels", header +
+			`<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+			"</Relationships>"},
+		{"[Content_Types].xml", header +
+			`<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+			`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+			`<Default Extension="xml" ContentType="application/xml"/>` +
+			`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+			`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>` +
+			types + "</Types>"},
+	}
+	for _, part := range parts {
+		w, err := x.zw.Create(part.name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(w, part.content); err != nil {
+			return err
+		}
+	}
+	return x.zw.Close()
+}
+
+func xmlEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
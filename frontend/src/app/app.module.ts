@@ -18,9 +18,10 @@ import { HeaderComponent } from './shared/header/header.component';
 import { ExpenseComponent } from './pages/transactions/expense/expense.component';
 import { IncomeComponent } from './pages/transactions/income/income.component';
 import { BudgetComponent } from './pages/transactions/budget/budget.component';
-import { HttpClientModule } from '@angular/common/http';
+import { HTTP_INTERCEPTORS, HttpClientModule } from '@angular/common/http';
 import { AuthService } from './services/auth.service';
 import { TransactionsService } from './services/transactions.service';
+import { AuthInterceptor } from './services/auth.interceptor';
 import { ActivitiesModalComponent } from './shared/activities-modal/activities-modal.component';
 import { UserComponent } from './pages/user/user.component';
 
@@ -52,7 +53,7 @@ import { UserComponent } from './pages/user/user.component';
     RouterModule.forRoot([]),
     HttpClientModule
   ],
-  providers: [AuthService, TransactionsService],
+  providers: [AuthService, TransactionsService, { provide: HTTP_INTERCEPTORS, useClass: AuthInterceptor, multi: true }],
   bootstrap: [AppComponent]
 })
 export class AppModule { }
@@ -49,7 +49,7 @@ const mockTx = {
   updateExpense: jest.fn(),
 }
 
-const mockAuth = { getUserId: jest.fn() }
+const mockAuth = { getUserId: jest.fn(), exchangeLoginCode: jest.fn() }
 const mockRoute = { snapshot: { queryParamMap: { get: jest.fn() } } } as any
 const mockRouter = { navigate: jest.fn() } as any
 
@@ -114,6 +114,20 @@ describe('DashboardComponent', () => {
     expect(comp.expenses).toBe(100)
   })
 
+  it('ngOnInit trades a Google login code for a session before loading', () => {
+    mockRoute.snapshot.queryParamMap.get.mockImplementation((k: string) => (k === 'code' ? 'abc' : null))
+    mockAuth.exchangeLoginCode.mockReturnValue(of({ userId: 1 }))
+    mockAuth.getUserId.mockReturnValue(1)
+    mockTx.getIncomes.mockReturnValue(of([mkIncome(500)]))
+    mockTx.getExpenses.mockReturnValue(of([mkExpense(100)]))
+    mockTx.getBudget.mockReturnValue(of([]))
+    comp.ngOnInit()
+    expect(mockAuth.exchangeLoginCode).toHaveBeenCalledWith('abc')
+    expect(mockRouter.navigate).toHaveBeenCalledWith([], expect.objectContaining({ queryParams: {} }))
+    expect(comp.income).toBe(500)
+    mockRoute.snapshot.queryParamMap.get.mockReset()
+  })
+
   it('getActivityColor returns hex', () => {
     expect(comp.getActivityColor('income')).toBe('#2ecc71')
     expect(comp.getActivityColor('expense')).toBe('#e74c3c')
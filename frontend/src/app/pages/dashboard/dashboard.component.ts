@@ -139,18 +139,20 @@ export class DashboardComponent implements OnInit, AfterViewInit {
   }
 
   ngOnInit(): void {
-    const token = this.route.snapshot.queryParamMap.get('token');
-    if (token) {
-      if (isPlatformBrowser(this.platformId)) {
-      localStorage.setItem('jwt', token);
-      this.router.navigate([], {
-        relativeTo: this.route,
-        queryParams: {},
-        queryParamsHandling: 'merge'
+    const code = this.route.snapshot.queryParamMap.get('code');
+    if (code && isPlatformBrowser(this.platformId)) {
+      // back from Google sign-in: drop the code from the URL and trade it for a session
+      this.router.navigate([], { relativeTo: this.route, queryParams: {}, replaceUrl: true });
+      this.authService.exchangeLoginCode(code).subscribe({
+        next: () => this.loadDashboard(),
+        error: () => this.router.navigate(['/login'])
       });
+      return;
     }
-       // clean up URL
-    }
+    this.loadDashboard();
+  }
+
+  private loadDashboard(): void {
     this.loggedInUserId = this.authService.getUserId();
     if (this.loggedInUserId) {
       this.fetchIncomeData(this.loggedInUserId);
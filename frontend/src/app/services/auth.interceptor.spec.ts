@@ -0,0 +1,89 @@
+import { TestBed } from '@angular/core/testing';
+import {
+  HttpClientTestingModule,
+  HttpTestingController
+} from '@angular/common/http/testing';
+import { HTTP_INTERCEPTORS, HttpClient, HttpHeaders } from '@angular/common/http';
+import { PLATFORM_ID } from '@angular/core';
+import { Router } from '@angular/router';
+import { AuthInterceptor } from './auth.interceptor';
+import { AuthService } from './auth.service';
+
+const BROWSER_ID = 'browser' as unknown as object;
+const API = 'http://localhost:8080';
+
+describe('AuthInterceptor', () => {
+  let http: HttpClient;
+  let backend: HttpTestingController;
+  let router: { navigate: jest.Mock };
+
+  const withToken = (token: string) => ({ headers: new HttpHeaders({ Authorization: `Bearer ${token}` }) });
+
+  beforeEach(() => {
+    sessionStorage.clear();
+    localStorage.clear();
+    localStorage.setItem('jwt', 'old-access');
+    localStorage.setItem('refreshToken', 'refresh-1');
+    router = { navigate: jest.fn() };
+
+    TestBed.configureTestingModule({
+      imports: [HttpClientTestingModule],
+      providers: [
+        { provide: PLATFORM_ID, useValue: BROWSER_ID },
+        { provide: Router, useValue: router },
+        { provide: HTTP_INTERCEPTORS, useClass: AuthInterceptor, multi: true },
+        AuthService
+      ]
+    });
+
+    http = TestBed.inject(HttpClient);
+    backend = TestBed.inject(HttpTestingController);
+  });
+
+  afterEach(() => backend.verify());
+
+  it('refreshes once on 401 and retries with the new token', () => {
+    const results: any[] = [];
+    http.get(`${API}/expenses`, withToken('old-access')).subscribe(r => results.push(r));
+    http.get(`${API}/incomes`, withToken('old-access')).subscribe(r => results.push(r));
+
+    backend.expectOne(`${API}/expenses`).flush({}, { status: 401, statusText: 'Unauthorized' });
+    backend.expectOne(`${API}/incomes`).flush({}, { status: 401, statusText: 'Unauthorized' });
+
+    const refresh = backend.expectOne(`${API}/auth/refresh`);
+    expect(refresh.request.body).toEqual({ refresh_token: 'refresh-1' });
+    refresh.flush({ token: 'new-access', refresh_token: 'refresh-2' });
+
+    const retries = [backend.expectOne(`${API}/expenses`), backend.expectOne(`${API}/incomes`)];
+    for (const retry of retries) {
+      expect(retry.request.headers.get('Authorization')).toBe('Bearer new-access');
+      retry.flush({ ok: true });
+    }
+    expect(results).toEqual([{ ok: true }, { ok: true }]);
+    expect(localStorage.getItem('jwt')).toBe('new-access');
+    expect(localStorage.getItem('refreshToken')).toBe('refresh-2');
+  });
+
+  it('logs out when the refresh fails', () => {
+    let status = 0;
+    http.get(`${API}/expenses`, withToken('old-access')).subscribe({ error: e => (status = e.status) });
+
+    backend.expectOne(`${API}/expenses`).flush({}, { status: 401, statusText: 'Unauthorized' });
+    backend.expectOne(`${API}/auth/refresh`).flush({}, { status: 401, statusText: 'Unauthorized' });
+    backend.expectOne(`${API}/auth/logout`).flush({});
+
+    expect(status).toBe(401);
+    expect(localStorage.getItem('jwt')).toBeNull();
+    expect(localStorage.getItem('refreshToken')).toBeNull();
+    expect(router.navigate).toHaveBeenCalledWith(['/login']);
+  });
+
+  it('leaves a failed login alone', () => {
+    let status = 0;
+    http.post(`${API}/login`, {}).subscribe({ error: e => (status = e.status) });
+    backend.expectOne(`${API}/login`).flush({}, { status: 401, statusText: 'Unauthorized' });
+
+    expect(status).toBe(401);
+    backend.expectNone(`${API}/auth/refresh`);
+  });
+});
@@ -0,0 +1,61 @@
+import { Injectable, Injector } from '@angular/core';
+import {
+  HttpErrorResponse,
+  HttpEvent,
+  HttpHandler,
+  HttpInterceptor,
+  HttpRequest
+} from '@angular/common/http';
+import { Router } from '@angular/router';
+import { Observable, throwError } from 'rxjs';
+import { catchError, finalize, map, shareReplay, switchMap } from 'rxjs/operators';
+import { AuthService } from './auth.service';
+
+// Routes that answer 401 for a bad login or refresh token; retrying them
+// after a refresh makes no sense.
+const AUTH_PATHS = ['/login', '/auth/refresh', '/auth/logout'];
+
+// Access tokens last 15 minutes. When an authenticated request comes back
+// 401, trade the refresh token for a new access token once and retry the
+// request; if the refresh fails the session is over, so log out.
+@Injectable()
+export class AuthInterceptor implements HttpInterceptor {
+  // The refresh in flight, shared by every request that failed meanwhile,
+  // since a refresh token can only be used once
+  private refreshing: Observable<string> | null = null;
+
+  // AuthService needs HttpClient, which needs this interceptor, so it is
+  // looked up on first use
+  constructor(private injector: Injector, private router: Router) {}
+
+  intercept(req: HttpRequest<any>, next: HttpHandler): Observable<HttpEvent<any>> {
+    return next.handle(req).pipe(
+      catchError(err => {
+        if (!(err instanceof HttpErrorResponse) || err.status !== 401 ||
+            !req.headers.has('Authorization') || AUTH_PATHS.some(p => req.url.endsWith(p))) {
+          return throwError(() => err);
+        }
+        return this.refreshToken().pipe(
+          switchMap(token => next.handle(req.clone({ setHeaders: { Authorization: `Bearer ${token}` } })))
+        );
+      })
+    );
+  }
+
+  private refreshToken(): Observable<string> {
+    if (!this.refreshing) {
+      const auth = this.injector.get(AuthService);
+      this.refreshing = auth.refresh().pipe(
+        map(response => response.token as string),
+        catchError(err => {
+          auth.logout();
+          this.router.navigate(['/login']);
+          return throwError(() => err);
+        }),
+        finalize(() => (this.refreshing = null)),
+        shareReplay(1)
+      );
+    }
+    return this.refreshing;
+  }
+}
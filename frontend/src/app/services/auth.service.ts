@@ -47,15 +47,28 @@ export class AuthService {
   login(email: string, password: string): Observable<any> {
     const user = { email, password };
     return this.http.post<any>(`${this.apiUrl}/login`, user).pipe(
-      tap(response => {
-        if (response && response.userId && isPlatformBrowser(this.platformId)) {
-          sessionStorage.setItem('userId', response.userId.toString());
-          this.userId.next(response.userId);
-        }
-      })
+      tap(response => this.storeSession(response))
     );
   }
 
+  // Trade the one-time code the Google callback redirects with for a session
+  exchangeLoginCode(code: string): Observable<any> {
+    return this.http.post<any>(`${this.apiUrl}/login/google/exchange`, { code }).pipe(
+      tap(response => this.storeSession(response))
+    );
+  }
+
+  private storeSession(response: any): void {
+    if (response && response.userId && isPlatformBrowser(this.platformId)) {
+      sessionStorage.setItem('userId', response.userId.toString());
+      if (response.token) {
+        localStorage.setItem('jwt', response.token);
+        localStorage.setItem('refreshToken', response.refresh_token);
+      }
+      this.userId.next(response.userId);
+    }
+  }
+
   getUserId(): number | null {
     if (isPlatformBrowser(this.platformId)) {
       const userId = sessionStorage.getItem('userId');
@@ -68,10 +81,28 @@ export class AuthService {
     return this.userId.asObservable(); 
   }
 
+  // Trade the stored refresh token for a new access token
+  refresh(): Observable<any> {
+    const refresh_token = isPlatformBrowser(this.platformId) ? localStorage.getItem('refreshToken') : null;
+    return this.http.post<any>(`${this.apiUrl}/auth/refresh`, { refresh_token }).pipe(
+      tap(response => {
+        if (response && response.token && isPlatformBrowser(this.platformId)) {
+          localStorage.setItem('jwt', response.token);
+          localStorage.setItem('refreshToken', response.refresh_token);
+        }
+      })
+    );
+  }
+
   logout(): void {
     if (isPlatformBrowser(this.platformId)) {
+      const refresh_token = localStorage.getItem('refreshToken');
+      if (refresh_token) {
+        this.http.post(`${this.apiUrl}/auth/logout`, { refresh_token }).subscribe({ error: () => {} });
+      }
       sessionStorage.removeItem('userId');
       localStorage.removeItem('jwt');
+      localStorage.removeItem('refreshToken');
       this.userId.next(null);
     }
   }
@@ -48,7 +48,18 @@ describe('TransactionsService', () => {
 
     const req = httpMock.expectOne(`${baseUrl}/incomes?user_id=${userId}`);
     expect(req.request.method).toBe('GET');
-    req.flush(mock);
+    req.flush({ data: mock, next_cursor: null });
+  });
+
+  it('getIncomes ⇒ follows next_cursor across pages', () => {
+    const userId = 1;
+    const first  = [{ amount: 1000, description: 'Salary' }];
+    const second = [{ amount: 200, description: 'Refund' }];
+
+    service.getIncomes(userId).subscribe(r => expect(r).toEqual([...first, ...second]));
+
+    httpMock.expectOne(`${baseUrl}/incomes?user_id=${userId}`).flush({ data: first, next_cursor: 'abc' });
+    httpMock.expectOne(`${baseUrl}/incomes?user_id=${userId}&cursor=abc`).flush({ data: second, next_cursor: null });
   });
 
   it('deleteIncome ⇒ DELETE /incomes/:id', () => {
@@ -81,7 +92,15 @@ describe('TransactionsService', () => {
 
     const req = httpMock.expectOne(`${baseUrl}/expenses?user_id=${userId}`);
     expect(req.request.method).toBe('GET');
-    req.flush(mock);
+    req.flush({ data: mock, next_cursor: null });
+  });
+
+  it('getExpenses ⇒ empty list is not an error', () => {
+    const userId = 1;
+
+    service.getExpenses(userId).subscribe(r => expect(r).toEqual([]));
+
+    httpMock.expectOne(`${baseUrl}/expenses?user_id=${userId}`).flush({ data: [], next_cursor: null });
   });
 
   it('deleteExpense ⇒ DELETE /expenses/:id', () => {
@@ -1,6 +1,7 @@
 import { Injectable } from '@angular/core';
-import { HttpClient, HttpParams } from '@angular/common/http';
-import { Observable } from 'rxjs';
+import { HttpClient, HttpHeaders, HttpParams } from '@angular/common/http';
+import { EMPTY, Observable } from 'rxjs';
+import { expand, reduce } from 'rxjs/operators';
 
 @Injectable({
   providedIn: 'root'
@@ -10,62 +11,79 @@ export class TransactionsService {
 
   constructor(private http: HttpClient) {}
 
+  // Every finance route requires the JWT issued at login
+  private authOptions(params?: HttpParams) {
+    const token = typeof localStorage !== 'undefined' ? localStorage.getItem('jwt') : null;
+    const headers = token ? new HttpHeaders({ Authorization: `Bearer ${token}` }) : new HttpHeaders();
+    return params ? { headers, params } : { headers };
+  }
+
+  // List endpoints return { data, next_cursor }; follow the cursor until
+  // every page is loaded. An empty list is a normal response, not an error.
+  private getAllPages(path: string, params: HttpParams): Observable<any[]> {
+    const page = (p: HttpParams) => this.http.get<any>(`${this.baseUrl}/${path}`, this.authOptions(p));
+    return page(params).pipe(
+      expand(res => res.next_cursor ? page(params.set('cursor', res.next_cursor)) : EMPTY),
+      reduce((all: any[], res: any) => all.concat(res.data), [])
+    );
+  }
+
   // Method to add income
   addIncome(income: any): Observable<any> {
-    return this.http.post(`${this.baseUrl}/incomes`, income);
+    return this.http.post(`${this.baseUrl}/incomes`, income, this.authOptions());
   }
   //Method to get income
   getIncomes(userID: any): Observable<any> {
     const params = new HttpParams().set('user_id', userID); 
-    return this.http.get(`${this.baseUrl}/incomes`, { params });
+    return this.getAllPages('incomes', params);
   }
   //Method to delete income
   deleteIncome(incomeID: any): Observable<any> {
-    return this.http.delete(`${this.baseUrl}/incomes/${incomeID}`);
+    return this.http.delete(`${this.baseUrl}/incomes/${incomeID}`, this.authOptions());
   }
   // Method to add expense
   addExpense(expense: any): Observable<any> {
-    return this.http.post(`${this.baseUrl}/expenses`, expense);
+    return this.http.post(`${this.baseUrl}/expenses`, expense, this.authOptions());
   }
   //Method to get expenses
   getExpenses(userID: any): Observable<any> {
     const params = new HttpParams().set('user_id', userID); 
-    return this.http.get(`${this.baseUrl}/expenses`, { params });
+    return this.getAllPages('expenses', params);
   }
   //Method to delete expenses
   deleteExpense(expenseID: any): Observable<any> {
-    return this.http.delete(`${this.baseUrl}/expenses/${expenseID}`);
+    return this.http.delete(`${this.baseUrl}/expenses/${expenseID}`, this.authOptions());
   }
   // Method to add budget
   addBudget(budget: any): Observable<any> {
-    return this.http.post(`${this.baseUrl}/budget`, budget);
+    return this.http.post(`${this.baseUrl}/budget`, budget, this.authOptions());
   }
   //Method to get budget
   getBudget(userID: any): Observable<any> {
     const params = new HttpParams().set('user_id', userID); 
-    return this.http.get(`${this.baseUrl}/budget`, { params });
+    return this.http.get(`${this.baseUrl}/budget`, this.authOptions(params));
   }
   //Method to delete budget
   deleteBudget(budgetId: any): Observable<any> {
-    return this.http.delete(`${this.baseUrl}/budget/${budgetId}`);
+    return this.http.delete(`${this.baseUrl}/budget/${budgetId}`, this.authOptions());
   }
   //Method to mark expense as paid
   updateExpense(expense: any) {
-    return this.http.put(`${this.baseUrl}/expenses/${expense.id}/paid`, expense);
+    return this.http.put(`${this.baseUrl}/expenses/${expense.id}/paid`, expense, this.authOptions());
   }
   getUser(userId:any): Observable<any> {
-    return this.http.get(`${this.baseUrl}/users/${userId}`);
+    return this.http.get(`${this.baseUrl}/users/${userId}`, this.authOptions());
   }
   //Method to update username
   updateUsername(userId: any, data: { username: string }): Observable<any> {
-    return this.http.put(`${this.baseUrl}/users/${userId}/username`, data);
+    return this.http.put(`${this.baseUrl}/users/${userId}/username`, data, this.authOptions());
   }
   //Method to update password
   updatePassword(userId: any, data: { currentPassword: string, newPassword: string }): Observable<any> {
-    return this.http.put(`${this.baseUrl}/users/${userId}/password`, data);
+    return this.http.put(`${this.baseUrl}/users/${userId}/password`, data, this.authOptions());
   }
   //Method to update email
   updateEmail(userId: any, data: { email: string }): Observable<any> {
-    return this.http.put(`${this.baseUrl}/users/${userId}/email`, data);
+    return this.http.put(`${this.baseUrl}/users/${userId}/email`, data, this.authOptions());
   }
 }
\ No newline at end of file